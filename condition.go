@@ -0,0 +1,182 @@
+package govdf
+
+import (
+	"errors"
+	"strings"
+)
+
+// conditionExpr is a parsed conditional expression such as "$WIN32 || !$X360".
+// Conditionals follow a value or precede an opening brace and decide whether
+// the entry applies to the platform the file is loaded on.
+type conditionExpr interface {
+	eval(symbols map[string]bool) bool
+}
+
+// conditionSymbol is true when the symbol is defined.
+type conditionSymbol string
+
+func (c conditionSymbol) eval(symbols map[string]bool) bool {
+	return symbols[string(c)]
+}
+
+// conditionNot negates an expression.
+type conditionNot struct {
+	expr conditionExpr
+}
+
+func (c conditionNot) eval(symbols map[string]bool) bool {
+	return !c.expr.eval(symbols)
+}
+
+// conditionAnd is true when both expressions are true.
+type conditionAnd struct {
+	left, right conditionExpr
+}
+
+func (c conditionAnd) eval(symbols map[string]bool) bool {
+	return c.left.eval(symbols) && c.right.eval(symbols)
+}
+
+// conditionOr is true when either expression is true.
+type conditionOr struct {
+	left, right conditionExpr
+}
+
+func (c conditionOr) eval(symbols map[string]bool) bool {
+	return c.left.eval(symbols) || c.right.eval(symbols)
+}
+
+// normalizeSymbol returns the canonical form of a conditional symbol.
+// Symbols are compared case-insensitively and the leading '$' is optional.
+func normalizeSymbol(symbol string) string {
+	return strings.ToUpper(strings.TrimPrefix(symbol, "$"))
+}
+
+// parseCondition parses the text between the brackets of a conditional.
+// The grammar supports symbols, '!', '&&', '||' and parentheses, with the usual precedence:
+//
+//	or    = and { "||" and }
+//	and   = unary { "&&" unary }
+//	unary = "!" unary | "(" or ")" | symbol
+func parseCondition(text string) (conditionExpr, error) {
+	var c = conditionParser{input: text}
+	expr, err := c.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	c.skipSpace()
+	if c.pos < len(c.input) {
+		return nil, errors.New("unexpected " + string(c.input[c.pos]) + " in conditional")
+	}
+
+	return expr, nil
+}
+
+// conditionParser is a recursive descent parser for conditional expressions.
+type conditionParser struct {
+	input string
+	pos   int
+}
+
+// parseOr parses expressions joined by "||".
+func (c *conditionParser) parseOr() (conditionExpr, error) {
+	left, err := c.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for c.consume("||") {
+		right, err := c.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = conditionOr{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+// parseAnd parses expressions joined by "&&".
+func (c *conditionParser) parseAnd() (conditionExpr, error) {
+	left, err := c.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for c.consume("&&") {
+		right, err := c.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = conditionAnd{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+// parseUnary parses a negation, a parenthesised group or a symbol.
+func (c *conditionParser) parseUnary() (conditionExpr, error) {
+	switch {
+	case c.consume("!"):
+		expr, err := c.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return conditionNot{expr: expr}, nil
+
+	case c.consume("("):
+		expr, err := c.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !c.consume(")") {
+			return nil, errors.New("missing ')' in conditional")
+		}
+		return expr, nil
+	}
+
+	return c.parseSymbol()
+}
+
+// parseSymbol parses a symbol such as "$WIN32".
+func (c *conditionParser) parseSymbol() (conditionExpr, error) {
+	c.skipSpace()
+
+	var start = c.pos
+	if c.pos < len(c.input) && c.input[c.pos] == '$' {
+		c.pos++
+	}
+	for c.pos < len(c.input) && isSymbolChar(c.input[c.pos]) {
+		c.pos++
+	}
+
+	var symbol = c.input[start:c.pos]
+	if normalizeSymbol(symbol) == "" {
+		return nil, errors.New("expected symbol in conditional")
+	}
+
+	return conditionSymbol(normalizeSymbol(symbol)), nil
+}
+
+// consume skips whitespace and consumes op if it is next in the input.
+func (c *conditionParser) consume(op string) bool {
+	c.skipSpace()
+	if strings.HasPrefix(c.input[c.pos:], op) {
+		c.pos += len(op)
+		return true
+	}
+	return false
+}
+
+// skipSpace advances past any whitespace.
+func (c *conditionParser) skipSpace() {
+	for c.pos < len(c.input) && (c.input[c.pos] == ' ' || c.input[c.pos] == '\t') {
+		c.pos++
+	}
+}
+
+// isSymbolChar reports whether b can appear in a conditional symbol.
+func isSymbolChar(b byte) bool {
+	return b == '_' || ('0' <= b && b <= '9') || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z')
+}
@@ -0,0 +1,214 @@
+package govdf_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	govdf "github.com/lewisgibson/go-vdf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecode_Conditions(t *testing.T) {
+	t.Parallel()
+
+	var input = `"resource" {
+    "font" "Tahoma" [$WIN32]
+    "font" "Verdana" [$OSX]
+    "tall" "12" [!$X360]
+    "menu" [$X360 || $PS3] {
+        "visible" "1"
+    }
+    "wide" [$WIN32] "640"
+    "grouped" "yes" [($WIN32 || $LINUX) && !$DECK]
+}`
+
+	var testCases = map[string]struct {
+		options  []govdf.Option
+		expected map[string]string
+	}{
+		"conditions are recorded but not evaluated by default": {
+			options: nil,
+			expected: map[string]string{
+				"font":    "Verdana",
+				"tall":    "12",
+				"wide":    "640",
+				"grouped": "yes",
+				"visible": "1",
+			},
+		},
+		"windows": {
+			options: []govdf.Option{govdf.WithConditions("$WIN32")},
+			expected: map[string]string{
+				"font":    "Tahoma",
+				"tall":    "12",
+				"wide":    "640",
+				"grouped": "yes",
+			},
+		},
+		"mac": {
+			options: []govdf.Option{govdf.WithConditions("OSX")},
+			expected: map[string]string{
+				"font": "Verdana",
+				"tall": "12",
+			},
+		},
+		"steam deck on linux": {
+			options: []govdf.Option{govdf.WithConditions("$linux", "$deck")},
+			expected: map[string]string{
+				"tall": "12",
+			},
+		},
+		"console": {
+			options: []govdf.Option{govdf.WithConditions("$X360")},
+			expected: map[string]string{
+				"visible": "1",
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act: Unmarshal the input with the given options.
+			var node govdf.Node
+			require.NoError(t, govdf.Unmarshal([]byte(input), &node, tc.options...))
+
+			// Assert: Only the matching scalar values should remain.
+			var actual = make(map[string]string)
+			for key, child := range node.Children["resource"].Children {
+				if child.Type == govdf.NodeTypeScalar {
+					actual[key] = child.Value
+				}
+			}
+			if menu, ok := node.Children["resource"].Children["menu"]; ok {
+				actual["visible"] = menu.Children["visible"].Value
+			}
+			require.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestDecode_ConditionNodes(t *testing.T) {
+	t.Parallel()
+
+	// Act: Unmarshal conditionals in both positions.
+	var node govdf.Node
+	require.NoError(t, govdf.Unmarshal([]byte(`"a" "b" [$WIN32] "c" [!$X360] { "d" "e" }`), &node))
+
+	// Assert: The raw conditional should be kept on each node.
+	var expected = govdf.Node{
+		Type: govdf.NodeTypeMap,
+		Children: map[string]*govdf.Node{
+			"a": {
+				Type:      govdf.NodeTypeScalar,
+				Value:     "b",
+				Condition: "$WIN32",
+			},
+			"c": {
+				Type:      govdf.NodeTypeMap,
+				Condition: "!$X360",
+				Children: map[string]*govdf.Node{
+					"d": {Type: govdf.NodeTypeScalar, Value: "e"},
+				},
+			},
+		},
+	}
+	var ignore = cmpopts.IgnoreFields(govdf.Node{}, "Line", "Column", "KeyRange", "ValueRange", "Keys")
+	if diff := cmp.Diff(expected, node, ignore); diff != "" {
+		t.Errorf("unexpected node (-want +got):\n%s", diff)
+	}
+}
+
+func TestDecode_ConditionErrors(t *testing.T) {
+	t.Parallel()
+
+	var testCases = map[string]struct {
+		input       string
+		errorSubstr string
+	}{
+		"conditional without key": {
+			input:       `[$WIN32] "a" "b"`,
+			errorSubstr: "unexpected conditional",
+		},
+		"two conditionals after key": {
+			input:       `"a" [$WIN32] [$X360] "b"`,
+			errorSubstr: "unexpected conditional",
+		},
+		"leading and trailing conditional": {
+			input:       `"a" [$WIN32] "b" [$X360]`,
+			errorSubstr: "unexpected conditional",
+		},
+		"empty conditional": {
+			input:       `"a" "b" []`,
+			errorSubstr: "expected symbol",
+		},
+		"dangling operator": {
+			input:       `"a" "b" [$WIN32 ||]`,
+			errorSubstr: "expected symbol",
+		},
+		"missing parenthesis": {
+			input:       `"a" "b" [($WIN32 || $OSX]`,
+			errorSubstr: "missing ')'",
+		},
+		"unexpected character": {
+			input:       `"a" "b" [$WIN32 $OSX]`,
+			errorSubstr: "invalid conditional",
+		},
+		"unterminated conditional": {
+			input:       `"a" "b" [$WIN32`,
+			errorSubstr: "EOF",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var node govdf.Node
+			err := govdf.Unmarshal([]byte(tc.input), &node)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.errorSubstr)
+		})
+	}
+}
+
+func TestEncode_Conditions(t *testing.T) {
+	t.Parallel()
+
+	// Arrange: Create a node with conditionals on scalars and maps.
+	node := &govdf.Node{
+		Type: govdf.NodeTypeMap,
+		Children: map[string]*govdf.Node{
+			"font": {Type: govdf.NodeTypeScalar, Value: "Tahoma", Condition: "$WIN32"},
+			"menu": {
+				Type:      govdf.NodeTypeMap,
+				Condition: "$X360 || $PS3",
+				Children: map[string]*govdf.Node{
+					"visible": {Type: govdf.NodeTypeScalar, Value: "1", LineComment: "shown on consoles"},
+				},
+			},
+		},
+	}
+
+	// Act: Marshal the node.
+	result, err := govdf.Marshal(node)
+	require.NoError(t, err)
+
+	// Assert: Conditionals should be written after values and before opening braces.
+	expected := strings.Join([]string{
+		`"font" "Tahoma" [$WIN32]`,
+		`"menu" [$X360 || $PS3] {`,
+		`    "visible" "1"	// shown on consoles`,
+		`}`,
+	}, "\n")
+	require.Equal(t, expected, strings.TrimSpace(string(result)))
+
+	// Assert: The output should decode back into the same node.
+	var decoded govdf.Node
+	require.NoError(t, govdf.Unmarshal(result, &decoded))
+	var ignore = cmpopts.IgnoreFields(govdf.Node{}, "Line", "Column", "KeyRange", "ValueRange", "Keys")
+	if diff := cmp.Diff(*node, decoded, ignore); diff != "" {
+		t.Errorf("unexpected node (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,49 @@
+package govdf
+
+import (
+	"context"
+	"io"
+)
+
+// contextCheckInterval is the number of runes, bytes or entries processed between
+// checks for cancellation, which keeps the cost of checking a context low.
+const contextCheckInterval = 4096
+
+// contextChecker checks a context for cancellation every contextCheckInterval calls.
+// The zero value has no context and never reports an error.
+type contextChecker struct {
+	ctx   context.Context
+	count int
+
+	// The error of the context once it has been seen to be done
+	err error
+}
+
+// check returns the error of the context if it is done.
+// The context is consulted on the first call and then every contextCheckInterval calls,
+// and once it is done every later call returns its error.
+func (c *contextChecker) check() error {
+	if c.ctx == nil || c.err != nil {
+		return c.err
+	}
+
+	var due = c.count%contextCheckInterval == 0
+	c.count++
+	if due {
+		c.err = c.ctx.Err()
+	}
+	return c.err
+}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write writes p to the underlying writer and counts the bytes written.
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,179 @@
+package govdf_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	govdf "github.com/lewisgibson/go-vdf"
+	"github.com/stretchr/testify/require"
+)
+
+// cancelReader cancels a context the first time it is read from.
+type cancelReader struct {
+	r      io.Reader
+	cancel context.CancelFunc
+}
+
+func (c *cancelReader) Read(p []byte) (int, error) {
+	c.cancel()
+	return c.r.Read(p)
+}
+
+// cancelWriter cancels a context the first time it is written to.
+type cancelWriter struct {
+	w      io.Writer
+	cancel context.CancelFunc
+}
+
+func (c *cancelWriter) Write(p []byte) (int, error) {
+	c.cancel()
+	return c.w.Write(p)
+}
+
+// largeNode returns a map node with n scalar children.
+func largeNode(n int) *govdf.Node {
+	var node = &govdf.Node{Type: govdf.NodeTypeMap, Children: make(map[string]*govdf.Node, n)}
+	for i := range n {
+		node.Children[fmt.Sprintf("key%d", i)] = &govdf.Node{Type: govdf.NodeTypeScalar, Value: "value"}
+	}
+	return &govdf.Node{Type: govdf.NodeTypeMap, Children: map[string]*govdf.Node{"root": node}}
+}
+
+func TestDecoder_DecodeContext(t *testing.T) {
+	t.Parallel()
+
+	var input, err = govdf.Marshal(largeNode(10000))
+	require.NoError(t, err)
+
+	t.Run("completes", func(t *testing.T) {
+		t.Parallel()
+
+		// Act: Decode the input with a context that is never cancelled.
+		var node govdf.Node
+		err := govdf.NewDecoder(bytes.NewReader(input)).DecodeContext(context.Background(), &node)
+
+		// Assert: The whole document should be decoded.
+		require.NoError(t, err)
+		require.Len(t, node.Children["root"].Children, 10000)
+	})
+
+	t.Run("cancelled before decoding", func(t *testing.T) {
+		t.Parallel()
+
+		// Arrange: Create a cancelled context.
+		var ctx, cancel = context.WithCancel(context.Background())
+		cancel()
+
+		// Act: Decode the input.
+		var node govdf.Node
+		err := govdf.NewDecoder(bytes.NewReader(input)).DecodeContext(ctx, &node)
+
+		// Assert: The error should be the context error at the start of the input.
+		require.ErrorIs(t, err, context.Canceled)
+		var posErr *govdf.PositionError
+		require.ErrorAs(t, err, &posErr)
+		require.Equal(t, 1, posErr.Line)
+		require.Equal(t, 1, posErr.Column)
+	})
+
+	t.Run("cancelled while decoding", func(t *testing.T) {
+		t.Parallel()
+
+		// Arrange: Create a reader that cancels the context once decoding has started.
+		var ctx, cancel = context.WithCancel(context.Background())
+		var reader = &cancelReader{r: bytes.NewReader(input), cancel: cancel}
+
+		// Act: Decode the input.
+		var node govdf.Node
+		err := govdf.NewDecoder(reader).DecodeContext(ctx, &node)
+
+		// Assert: Decoding should stop part way through the input.
+		require.ErrorIs(t, err, context.Canceled)
+		var posErr *govdf.PositionError
+		require.ErrorAs(t, err, &posErr)
+		require.Greater(t, posErr.Line, 1)
+	})
+
+	t.Run("strict by default", func(t *testing.T) {
+		t.Parallel()
+
+		// Act: Decode an unclosed map with and without strict mode.
+		var node govdf.Node
+		strictErr := govdf.NewDecoder(strings.NewReader(`"a" { "b" "c"`)).DecodeContext(context.Background(), &node)
+		err := govdf.NewDecoder(strings.NewReader(`"a" { "b" "c"`), govdf.WithStrict(false)).DecodeContext(context.Background(), &node)
+
+		// Assert: Only the lenient decode should accept the map.
+		var parseErr *govdf.ParseError
+		require.ErrorAs(t, strictErr, &parseErr)
+		require.Equal(t, "unclosed '{'", parseErr.Message)
+		require.NoError(t, err)
+		require.Equal(t, "c", node.Children["a"].Children["b"].Value)
+	})
+}
+
+func TestBinaryDecoder_DecodeContext(t *testing.T) {
+	t.Parallel()
+
+	var input, err = govdf.MarshalBinary(largeNode(10000))
+	require.NoError(t, err)
+
+	// Arrange: Create a reader that cancels the context once decoding has started.
+	var ctx, cancel = context.WithCancel(context.Background())
+	var reader = &cancelReader{r: bytes.NewReader(input), cancel: cancel}
+
+	// Act: Decode the input.
+	var node govdf.Node
+	err = govdf.NewBinaryDecoder(reader).DecodeContext(ctx, &node)
+
+	// Assert: Decoding should stop part way through the input.
+	require.ErrorIs(t, err, context.Canceled)
+	require.Contains(t, err.Error(), "offset 4096: context canceled")
+}
+
+func TestEncoder_EncodeContext(t *testing.T) {
+	t.Parallel()
+
+	var node = largeNode(10000)
+
+	var testCases = map[string]struct {
+		encode func(ctx context.Context, w io.Writer) error
+	}{
+		"text": {
+			encode: func(ctx context.Context, w io.Writer) error {
+				return govdf.NewEncoder(w).EncodeContext(ctx, node)
+			},
+		},
+		"binary": {
+			encode: func(ctx context.Context, w io.Writer) error {
+				return govdf.NewBinaryEncoder(w).EncodeContext(ctx, node)
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Arrange: Create a writer that cancels the context on the first write.
+			var ctx, cancel = context.WithCancel(context.Background())
+			var buffer bytes.Buffer
+			var writer = &cancelWriter{w: &buffer, cancel: cancel}
+
+			// Act: Encode the node.
+			err := tc.encode(ctx, writer)
+
+			// Assert: Encoding should stop part way through the output.
+			require.ErrorIs(t, err, context.Canceled)
+			require.Contains(t, err.Error(), fmt.Sprintf("offset %d: ", buffer.Len()))
+			require.NotZero(t, buffer.Len())
+
+			// Assert: A context that is never cancelled should encode everything.
+			buffer.Reset()
+			require.NoError(t, tc.encode(context.Background(), &buffer))
+			require.Equal(t, 10000, strings.Count(buffer.String(), "value"))
+		})
+	}
+}
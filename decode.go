@@ -1,15 +1,18 @@
 package govdf
 
 import (
-	"bufio"
-	"bytes"
+	"context"
+	"encoding"
 	"errors"
 	"fmt"
 	"io"
 	"reflect"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
-	"unicode"
+	"sync"
+	"time"
 )
 
 // Unmarshaler is the interface implemented by types that can unmarshal a VDF description of themselves.
@@ -33,14 +36,26 @@ type Unmarshaler interface {
 }
 
 // Unmarshal parses the VDF-encoded data and stores the result in the value pointed to by v.
-// The target value v must be a pointer to a struct or a *Node.
+// The target value v must be a pointer to a struct, a map, an interface or a *Node.
+// A target of type any or map[string]any receives nested map[string]any values and strings,
+// and a target of type OrderedMap keeps the keys in source order.
+// Scalars are stored in fields implementing encoding.TextUnmarshaler with UnmarshalText,
+// unless the field implements Unmarshaler, which takes precedence.
+// A struct field tagged with the "required" option fails with a MissingFieldError when its key
+// is absent, and one tagged with "default=value" is set from value when its key is absent.
+// A default on a field without a scalar type, or one that is not valid for its field, fails
+// the first decode into the struct type. A struct field whose block is absent is handled like
+// an empty block, so its defaults are filled in and its required fields are reported missing,
+// while a pointer to a struct is left nil and neither applies.
+// The fields of embedded structs, and of struct fields tagged with the inline option, are read
+// from the block of the struct itself, following the rules of encoding/json.
 //
 // Example:
 //
 //	// Parse into a struct
 //	type Config struct {
-//	    Name string `vdf:"name"`
-//	    Port int    `vdf:"port"`
+//	    Name string `vdf:"name,required"`
+//	    Port int    `vdf:"port,default=27015"`
 //	}
 //	var config Config
 //	err := govdf.Unmarshal(vdfData, &config)
@@ -48,463 +63,711 @@ type Unmarshaler interface {
 //	// Parse into a Node for manual processing
 //	var node govdf.Node
 //	err := govdf.Unmarshal(vdfData, &node)
-func Unmarshal(in []byte, out any) error {
-	return NewDecoder(bytes.NewReader(in)).Decode(out)
+//
+//	// Parse into generic values
+//	var value any
+//	err := govdf.Unmarshal(vdfData, &value)
+func Unmarshal(in []byte, out any, opts ...Option) error {
+	var d = &Decoder{opts: newOptions(opts), whole: true}
+	d.scanner = newBytesScanner(in, &d.opts)
+	return d.Decode(out)
 }
 
 // Decoder is a VDF decoder that parses VDF data into Node structures.
 // It provides streaming parsing capabilities and maintains position information
 // for accurate error reporting. The decoder is not safe for concurrent use.
+//
+// Keys and values may be quoted or unquoted. Unquoted strings end at whitespace,
+// braces, quotes or the start of a comment, which allows the decoder to read
+// files such as VMT materials and gameinfo.txt:
+//
+//	LightmappedGeneric
+//	{
+//	    $basetexture concrete/floor01
+//	}
 type Decoder struct {
-	reader *bufio.Reader
-	line   int
-	column int
+	scanner *scanner
+	opts    options
+
+	// The files being loaded through directives, used to detect include cycles
+	chain []string
 
-	// Reusable buffers to avoid allocations during parsing
-	keyBuilder   *strings.Builder
-	valueBuilder *strings.Builder
+	// The state of the token API
+	tokens tokenState
+
+	// Whether Decode reads the whole input as a single document, as Unmarshal does
+	whole bool
+
+	// Where a comment on the line the last document ended on is stored, so that it can be
+	// attached when the next call to Decode reads it
+	trailing *string
+	lastLine int
 }
 
 // NewDecoder returns a new decoder that reads from r.
 // The decoder uses a buffered reader for efficient parsing of large VDF files.
-func NewDecoder(r io.Reader) *Decoder {
-	return &Decoder{
-		reader:       bufio.NewReaderSize(r, 4096),
-		line:         1,
-		column:       1,
-		keyBuilder:   &strings.Builder{},
-		valueBuilder: &strings.Builder{},
-	}
+// Parsing can be customised with options such as WithConditions.
+func NewDecoder(r io.Reader, opts ...Option) *Decoder {
+	var d = &Decoder{opts: newOptions(opts)}
+	d.scanner = newScanner(r, &d.opts)
+	return d
 }
 
-// Decode reads the next VDF-encoded value from its input and stores it in the value pointed to by v.
-// The target value v must be a pointer to a struct or a *Node.
-// This method parses the entire VDF document from the input stream.
+// Decode reads the next VDF-encoded document from its input and stores it in the value pointed to by v.
+// The target value v must be a pointer to a struct, a map, an interface or a *Node, as for Unmarshal.
+//
+// A document is a single top-level entry, along with any directives and comments before it,
+// so a stream of concatenated documents such as the output of steamcmd app_info_print
+// can be read one document at a time. When the input is exhausted, Decode returns io.EOF.
+// Positions keep counting from the start of the stream across calls.
+//
+// This is a breaking change from earlier versions, where Decode read the whole input as a
+// single document. A file with several top-level keys, such as "name" "x" "port" "1", now only
+// yields its first key without an error. Use Unmarshal to read such a file at once.
+//
+// Decode returns as soon as the closing brace or value of the entry has been read, so that it
+// never waits for the next document of a live stream. A trailing conditional is only applied
+// when it has already been received, and a comment on the same line as the end of the entry is
+// attached to its node by the next call to Decode.
+//
+// Example:
+//
+//	for {
+//	    var node govdf.Node
+//	    err := decoder.Decode(&node)
+//	    if err == io.EOF {
+//	        break
+//	    }
+//	    if err != nil {
+//	        return err
+//	    }
+//	}
 func (d *Decoder) Decode(v any) error {
 	// Decode the VDF data into a Node struct.
-	node, err := d.parse()
+	var p = newParser(d.scanner, &d.opts)
+	p.single = !d.whole
+	p.trailing, p.lastLine = d.trailing, d.lastLine
+	node, err := p.parse()
+	d.trailing, d.lastLine = p.trailing, p.lastLine
 	if err != nil {
-		return fmt.Errorf("line %d, column %d: %w", d.line, d.column, err)
+		// The end of the input inside a document is never a clean end of the stream
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return positionError(d.opts.filename, d.scanner.line, d.scanner.column, err)
 	}
 
-	// If the target is a node pointer, return the root node itself.
-	if _, ok := v.(*Node); ok {
-		reflect.ValueOf(v).Elem().Set(reflect.ValueOf(node).Elem())
-		return nil
+	// Collect the problems skipped over while recovering from errors
+	var diagnostics = d.diagnostics()
+	if p.single && len(node.Children) == 0 && len(node.Directives) == 0 {
+		if diagnostics != nil {
+			return diagnostics
+		}
+		return io.EOF
+	}
+
+	// Load the files referenced by #include and #base directives.
+	if d.opts.resolver != nil {
+		if d.chain == nil {
+			d.chain = []string{d.opts.filename}
+		}
+		if err := d.resolveDirectives(node); err != nil {
+			return err
+		}
+	}
+
+	if err := unmarshalNode(node, v, &d.opts); err != nil {
+		return err
 	}
 
-	// For struct targets, always map the root node to the struct.
-	return mapNodeToStruct(node, v)
+	if diagnostics != nil {
+		return diagnostics
+	}
+	return nil
 }
 
-// parse parses the VDF data into a Node struct.
-// This is the main parsing method that processes the entire VDF document.
-func (d *Decoder) parse() (*Node, error) {
-	// Reset state
-	d.line, d.column = 1, 1
-	d.keyBuilder.Reset()
-	d.valueBuilder.Reset()
+// DecodeContext is like Decode, but stops when ctx is cancelled or its deadline passes.
+// The context is checked periodically while reading the input, and its error is returned
+// wrapped in a PositionError holding the position reached. Unlike Decode, it is strict
+// unless the Decoder was created with WithStrict(false).
+//
+// Example:
+//
+//	var node govdf.Node
+//	if err := decoder.DecodeContext(r.Context(), &node); errors.Is(err, context.Canceled) {
+//	    return
+//	}
+func (d *Decoder) DecodeContext(ctx context.Context, v any) error {
+	d.scanner.cancel = contextChecker{ctx: ctx}
+	defer func() { d.scanner.cancel = contextChecker{} }()
+	defer d.strictByDefault()()
+	return d.Decode(v)
+}
 
-	// Create root node
-	root := &Node{
-		Type:     NodeTypeMap,
-		Line:     1,
-		Column:   1,
-		Children: make(map[string]*Node),
+// strictByDefault turns on strict mode for an entry point that is strict unless the Decoder was
+// created with WithStrict, and returns a function that restores the previous mode.
+func (d *Decoder) strictByDefault() func() {
+	if d.opts.strictSet {
+		return func() {}
 	}
+	d.opts.strict = true
+	return func() { d.opts.strict = false }
+}
 
-	// Parse the input
-	var stack = []*Node{root}
-	var currentKey string
-	var headComment string
-	for {
-		r, size, err := d.reader.ReadRune()
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
-			}
-			return root, err
-		}
+// diagnostics returns the problems recorded by the scanner and parser since the last call,
+// sorted by position, or nil if there are none.
+func (d *Decoder) diagnostics() ErrorList {
+	if len(d.scanner.diagnostics) == 0 {
+		return nil
+	}
 
-		// Update position
-		if r == '\n' {
-			d.line++
-			d.column = 1
-		} else {
-			d.column++
+	var list = ErrorList(d.scanner.diagnostics)
+	d.scanner.diagnostics = nil
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Line != list[j].Line {
+			return list[i].Line < list[j].Line
 		}
+		return list[i].Column < list[j].Column
+	})
+	return list
+}
 
-		// Handle invalid runes
-		if r == unicode.ReplacementChar && size == 1 {
-			return root, newPositionError(d.line, d.column, errors.New("invalid rune"))
-		}
+// InputOffset returns the number of bytes of input consumed by the decoder so far.
+// After a call to Decode, it is the offset just after the document that was read.
+// Input in an encoding other than UTF-8 is counted after conversion to UTF-8.
+func (d *Decoder) InputOffset() int64 {
+	return d.scanner.consumed()
+}
 
-		// Process the rune
-		if err := d.processRune(r, &stack, &currentKey, &headComment); err != nil {
-			return root, err
-		}
-	}
+// valueDecoder stores the contents of Nodes in Go values, keeping track of the path of keys
+// being decoded for errors and metadata. A valueDecoder is used for a single call to Decode.
+type valueDecoder struct {
+	opts *options
 
-	return root, nil
+	// The keys leading to the node being decoded
+	path Key
 }
 
-// processRune processes a single rune from the VDF input.
-// This method handles the state machine logic for parsing VDF syntax.
-func (d *Decoder) processRune(r rune, stack *[]*Node, currentKey *string, headComment *string) error {
-	switch r {
-	case ' ', '\t', '\n', '\r':
-		// Skip whitespace
+// unmarshalNode stores a decoded node in the value pointed to by v, which must be a *Node
+// or a non-nil pointer to a struct, map or interface.
+func unmarshalNode(node *Node, v any, opts *options) error {
+	if opts.metadata != nil {
+		*opts.metadata = Metadata{}
+	}
+
+	// If the target is a node pointer, return the root node itself.
+	if _, ok := v.(*Node); ok {
+		reflect.ValueOf(v).Elem().Set(reflect.ValueOf(node).Elem())
 		return nil
+	}
 
-	case '/':
-		// Handle comments
-		return d.handleComment(headComment)
+	var targetValue = reflect.ValueOf(v)
+	if targetValue.Kind() != reflect.Ptr || targetValue.IsNil() {
+		return newValidationError("target must be a non-nil pointer to a struct")
+	}
 
-	case '{':
-		// Start of a new map
-		if len(*stack) == 0 {
-			return newParseError(d.line, d.column, "unexpected '{' at root level")
-		}
+	var d = &valueDecoder{opts: opts}
+	var elem = targetValue.Elem()
+	switch {
+	case elem.Kind() == reflect.Struct:
+		return d.mapNodeToStruct(node, v)
+
+	case elem.Kind() == reflect.Map, elem.Kind() == reflect.Interface, elem.Type() == orderedMapType:
+		return d.setValue(elem, node)
+
+	default:
+		return newValidationError("target must be a pointer to a struct, map or interface")
+	}
+}
 
-		var current = (*stack)[len(*stack)-1]
-		if current.Children == nil {
-			current.Children = make(map[string]*Node)
+// mapNodeToStruct maps the contents of a Node to a user-defined struct.
+// This function uses reflection to map VDF key-value pairs to struct fields
+// using the "vdf" struct tag for field name mapping.
+func (d *valueDecoder) mapNodeToStruct(node *Node, target any) error {
+	var targetValue = reflect.ValueOf(target)
+	if targetValue.Kind() != reflect.Ptr || targetValue.IsNil() {
+		return newValidationError("target must be a non-nil pointer to a struct")
+	}
+	if targetValue = targetValue.Elem(); targetValue.Kind() != reflect.Struct {
+		return newValidationError("target must be a pointer to a struct")
+	}
+
+	// Build a map of field names to field info for efficient lookup.
+	// Keys are visited in source order, once each, so that errors and metadata are deterministic.
+	var fieldMap, err = buildFieldMap(targetValue.Type())
+	if err != nil {
+		return err
+	}
+	var decoded = make(map[string]bool, len(fieldMap))
+	for _, e := range node.entries(false) {
+		// A repeated key is visited at its first occurrence and decoded from its last one,
+		// as it is for maps and generic values.
+		var key = e.key
+		if e.node != node.Children[key] {
+			continue
 		}
+		var all = node.All(key)
+		var child = all[len(all)-1]
 
-		// Reuse existing map node to merge children from duplicate keys
-		var newNode, ok = current.Children[*currentKey]
-		if !ok || newNode.Type != NodeTypeMap {
-			newNode = &Node{
-				Type:        NodeTypeMap,
-				Column:      d.column - 1, // Position of the '{' character
-				Line:        d.line,
-				HeadComment: strings.TrimSpace(*headComment),
+		var fieldName = key
+		var fieldInfo, exists = fieldMap[key]
+		if !exists {
+			// Try case-insensitive match.
+			for vdfKey, info := range fieldMap {
+				if strings.EqualFold(vdfKey, key) {
+					fieldName, fieldInfo = vdfKey, info
+					exists = true
+					break
+				}
 			}
-			current.Children[*currentKey] = newNode
+		}
+		if !exists {
+			if err := d.unknownField(key, e.node); err != nil {
+				return err
+			}
+			continue
 		}
 
-		*stack = append(*stack, newNode)
-		*currentKey = ""
-		*headComment = ""
-		return nil
-
-	case '}':
-		// End of current map
-		if len(*stack) <= 1 {
-			return newParseError(d.line, d.column, "unexpected '}' at root level")
+		var field = fieldByIndex(targetValue, fieldInfo.Index, true)
+		if !field.CanSet() {
+			continue
 		}
-		*stack = (*stack)[:len(*stack)-1]
-		return nil
+		decoded[fieldName] = true
 
-	case 65279: // Byte Order Mark
-		return nil
+		var err error
+		d.path = append(d.path, key)
+		switch fieldInfo.List {
+		case listRepeated:
+			// Other policies merge or drop the occurrences of the key before they get here.
+			if d.opts.duplicates != DuplicateKeepAll {
+				err = newValidationError(fmt.Sprintf("list=repeated field %q must be decoded with WithDuplicateKeys(DuplicateKeepAll)", d.path.String()))
+				break
+			}
+			err = d.setRepeatedValue(field, node.All(key), nil)
 
-	case '"':
-		// Handle quoted strings (keys or values)
-		return d.handleQuotedString(stack, currentKey, headComment)
+		case listNumberedFromOne:
+			err = d.setListValue(field, child, 1)
+
+		default:
+			err = d.setValue(field, child)
+		}
+		d.path = d.path[:len(d.path)-1]
+		if err != nil {
+			return err
+		}
 	}
 
-	if unicode.IsSpace(r) {
-		return nil
+	// Check the fields that were not decoded, in declaration order, filling in their defaults
+	// and recording them in the metadata.
+	for _, name := range unsetFields(fieldMap, decoded) {
+		if err := d.setDefaults(targetValue, name, fieldMap[name]); err != nil {
+			return err
+		}
+		if d.opts.metadata != nil {
+			d.opts.metadata.Unset = append(d.opts.metadata.Unset, d.key(name))
+		}
 	}
 
-	return newParseErrorWithExpected(d.line, d.column, "unexpected character", "valid VDF character", string(r))
+	return nil
 }
 
-// handleComment processes comment lines starting with "//".
-// Comments are preserved and attached to the next VDF element.
-func (d *Decoder) handleComment(headComment *string) error {
-	// Read the second '/' character to confirm this is a comment
-	r, _, err := d.reader.ReadRune()
-	switch {
-	case err != nil:
-		return err
+// unsetFields returns the names of the fields of a struct that were not decoded, in declaration
+// order, leaving out the fields that receive the key of their map entry.
+func unsetFields(fieldMap map[string]fieldInfo, decoded map[string]bool) []string {
+	var unset []string
+	for name, info := range fieldMap {
+		if !decoded[name] && !info.Key {
+			unset = append(unset, name)
+		}
+	}
+	slices.SortFunc(unset, func(a, b string) int {
+		return slices.Compare(fieldMap[a].Index, fieldMap[b].Index)
+	})
+	return unset
+}
+
+// setDefaults handles the field name of a struct without a key, which is an error when the
+// field is required, and is otherwise filled in from the default in its tag. A struct field
+// without a block of its own is treated like an empty block, so its fields are handled in turn
+// and any required one is reported missing. Fields that already hold a value are left unchanged.
+func (d *valueDecoder) setDefaults(parent reflect.Value, name string, info fieldInfo) error {
+	if info.Required {
+		return &MissingFieldError{Key: d.key(name)}
+	}
 
-	case r != '/':
-		return newParseErrorWithExpected(d.line, d.column, "expected '//' for comment", "//", "/"+string(r))
+	var field = fieldByIndex(parent, info.Index, info.HasDefault)
+	if !field.CanSet() || !field.IsZero() {
+		return nil
+	}
+	if info.HasDefault {
+		return setScalarValue(field, info.Default)
 	}
 
-	// Read the rest of the line
-	line, err := d.reader.ReadString('\n')
-	if err != nil && !errors.Is(err, io.EOF) {
+	// Structs decoded by their own methods have no fields of their own to fill in.
+	if field.Kind() != reflect.Struct || field.Addr().Type().Implements(reflect.TypeOf((*Unmarshaler)(nil)).Elem()) ||
+		field.Addr().Type().Implements(reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()) {
+		return nil
+	}
+	var fieldMap, err = buildFieldMap(field.Type())
+	if err != nil {
 		return err
 	}
 
-	// Extract comment text
-	if comment := strings.TrimSpace(strings.TrimRight(line, "\n\r")); comment != "" {
-		if *headComment != "" {
-			*headComment += "\n"
+	d.path = append(d.path, name)
+	defer func() { d.path = d.path[:len(d.path)-1] }()
+	for _, name := range unsetFields(fieldMap, nil) {
+		if err := d.setDefaults(field, name, fieldMap[name]); err != nil {
+			return err
 		}
-		*headComment += comment
 	}
-
-	// Update position
-	d.line++
-	d.column = 1
-
 	return nil
 }
 
-// handleQuotedString processes quoted strings (keys or values).
-// This method determines whether the quoted string is a key or value based on context.
-func (d *Decoder) handleQuotedString(stack *[]*Node, currentKey *string, headComment *string) error {
-	if *currentKey == "" {
-		return d.readKey(currentKey)
+// unknownField reports a key without a matching struct field, which is an error when
+// unknown fields are disallowed, and otherwise recorded in the metadata.
+func (d *valueDecoder) unknownField(key string, node *Node) error {
+	if d.opts.disallowUnknownFields {
+		var start = node.KeyRange.Start
+		return &UnknownFieldError{Key: d.key(key), Line: start.Line, Column: start.Column, Offset: start.Offset}
+	}
+	if d.opts.metadata != nil {
+		d.opts.metadata.Undecoded = append(d.opts.metadata.Undecoded, d.key(key))
 	}
-	return d.readValue(stack, currentKey, headComment)
+	return nil
 }
 
-// readKey reads a quoted key from the VDF input.
-// Keys are used to identify values in VDF key-value pairs.
-func (d *Decoder) readKey(currentKey *string) error {
-	d.keyBuilder.Reset()
+// key returns the path of a key within the node being decoded.
+func (d *valueDecoder) key(key string) Key {
+	return append(slices.Clone(d.path), key)
+}
 
-	for {
-		r, _, err := d.reader.ReadRune()
-		if err != nil {
-			return err
-		}
+// setValue sets a field from a Node, using its Unmarshaler implementation when it has one.
+func (d *valueDecoder) setValue(field reflect.Value, node *Node) error {
+	// Check if field implements Unmarshaler interface.
+	if field.CanAddr() && field.Addr().Type().Implements(reflect.TypeOf((*Unmarshaler)(nil)).Elem()) {
+		var unmarshaler = field.Addr().Interface().(Unmarshaler)
+		return unmarshaler.UnmarshalVDF(node)
+	}
 
-		if r == '\n' {
-			d.line++
-			d.column = 1
-		} else {
-			d.column++
-		}
+	// Generic fields hold the contents of the node as strings and maps
+	switch {
+	case field.Kind() == reflect.Interface && field.NumMethod() == 0:
+		field.Set(reflect.ValueOf(genericValue(node, false)))
+		return nil
 
-		if r == '"' {
-			*currentKey = d.keyBuilder.String()
-			return nil
-		}
+	case field.Type() == orderedMapType && node.Type == NodeTypeMap:
+		field.Set(reflect.ValueOf(genericValue(node, true)))
+		return nil
+	}
 
-		d.keyBuilder.WriteRune(r)
+	switch node.Type {
+	case NodeTypeMap:
+		return d.setMapValue(field, node)
+
+	case NodeTypeScalar:
+		return setScalarValue(field, node.Value)
 	}
+	return nil
 }
 
-// readValue reads a quoted value from the VDF input.
-// Values can be scalar strings or nested VDF structures.
-func (d *Decoder) readValue(stack *[]*Node, currentKey *string, headComment *string) error {
-	d.valueBuilder.Reset()
+// orderedMapType is the type of OrderedMap, which is decoded as a generic value rather than a list.
+var orderedMapType = reflect.TypeOf(OrderedMap(nil))
 
-	for {
-		r, _, err := d.reader.ReadRune()
-		if err != nil {
-			return err
-		}
+// genericValue returns the contents of a node as a string for a scalar, and as a map[string]any
+// for a map, or an OrderedMap that keeps every entry when ordered is true.
+func genericValue(node *Node, ordered bool) any {
+	if node.Type == NodeTypeScalar {
+		return node.Value
+	}
 
-		if r == '\n' {
-			d.line++
-			d.column = 1
-		} else {
-			d.column++
+	var entries = node.entries(false)
+	if ordered {
+		var m = make(OrderedMap, 0, len(entries))
+		for _, e := range entries {
+			m = append(m, MapEntry{Key: e.key, Value: genericValue(e.node, true)})
 		}
+		return m
+	}
 
-		if r == '"' {
-			// Check if this is an escaped quote
-			if d.valueBuilder.Len() > 0 {
-				value := d.valueBuilder.String()
+	// Later occurrences of a repeated key replace earlier ones
+	var m = make(map[string]any, len(node.Children))
+	for _, e := range entries {
+		m[e.key] = genericValue(e.node, false)
+	}
+	return m
+}
 
-				// Count consecutive backslashes from the end
-				var backslashCount int
-				for i := len(value) - 1; i >= 0 && value[i] == '\\'; i-- {
-					backslashCount++
-				}
+// fieldInfo contains information about a struct field.
+// This is used internally for efficient field mapping during struct conversion.
+type fieldInfo struct {
+	Index []int     // Field index for reflection access
+	Tag   string    // VDF tag value for field name mapping
+	Key   bool      // Whether the field receives the key of its map entry
+	List  listStyle // How a slice or array field is laid out
+
+	Required   bool   // Whether decoding fails when the key is absent
+	Default    string // Value decoded into the field when the key is absent
+	HasDefault bool   // Whether the field has a default value
+}
 
-				// If odd number of backslashes, this quote is escaped
-				if backslashCount%2 == 1 {
-					// This is an escaped quote - remove the backslash and add the quote
-					currentValue := d.valueBuilder.String()
-					d.valueBuilder.Reset()
-					d.valueBuilder.WriteString(currentValue[:len(currentValue)-1]) // Remove the backslash
-					d.valueBuilder.WriteRune(r)                                    // Add the unescaped quote
-					continue
-				}
-			}
+// listStyle is the way a list is represented in VDF, chosen with the "list" tag option.
+type listStyle uint8
 
-			// End of value - create scalar node
-			value := d.valueBuilder.String()
+const (
+	// listNumbered stores the elements as children keyed "0", "1", "2" and so on.
+	// This is the default, selected explicitly with list=0.
+	listNumbered listStyle = iota
 
-			// Check if there's a line comment after the value
-			var lineComment string
-			if d.hasLineComment() {
-				lineComment = d.extractLineComment()
-			}
+	// listNumberedFromOne stores the elements as children keyed "1", "2", "3" and so on, selected with list=1.
+	listNumberedFromOne
 
-			var current = (*stack)[len(*stack)-1]
-			if current.Children == nil {
-				current.Children = make(map[string]*Node)
-			}
+	// listRepeated stores the elements as repeated occurrences of the field's own key, selected with list=repeated.
+	listRepeated
+)
 
-			current.Children[*currentKey] = &Node{
-				Type:        NodeTypeScalar,
-				Value:       value,
-				Column:      d.column - len(value) - 3 - strings.Count(value, "\""),
-				Line:        d.line,
-				HeadComment: strings.TrimSpace(*headComment),
-				LineComment: lineComment,
-			}
+// parseListStyle returns the list style selected by the options of a "vdf" tag.
+func parseListStyle(options []string) listStyle {
+	for _, option := range options {
+		switch option {
+		case "list=1":
+			return listNumberedFromOne
 
-			// Reset for next key-value pair
-			*currentKey = ""
-			*headComment = ""
-			return nil
+		case "list=repeated":
+			return listRepeated
 		}
-
-		d.valueBuilder.WriteRune(r)
 	}
+	return listNumbered
 }
 
-// hasLineComment checks if there's a line comment after the current value.
-// Line comments appear on the same line as a VDF value.
-func (d *Decoder) hasLineComment() bool {
-	peeked, err := d.reader.Peek(20)
-	if err != nil {
-		return false
+// parseTag returns the VDF key of a struct field and the options that follow it in the "vdf" tag.
+// Fields without a name in their tag, and for compatibility fields tagged just "-", use their
+// lowercased Go name. Fields tagged "-," have the name "-".
+func parseTag(field reflect.StructField) (string, []string) {
+	var tag = field.Tag.Get("vdf")
+	var name, options, _ = strings.Cut(tag, ",")
+	if name == "" || tag == "-" {
+		name = strings.ToLower(field.Name)
 	}
+	if options == "" {
+		return name, nil
+	}
+	return name, strings.Split(options, ",")
+}
 
-	// Look for whitespace followed by //
-	for i, b := range peeked {
-		switch {
-		case unicode.IsSpace(rune(b)):
-			continue
+// structField is a field of a struct type, or of a struct embedded in it, that is stored under a VDF key.
+type structField struct {
+	name    string   // VDF key of the field
+	index   []int    // Index sequence of the field, through any embedded structs
+	tag     string   // The "vdf" tag of the field
+	options []string // Options following the name in the tag
+	tagged  bool     // Whether the name was given in the tag
 
-		case b == '/' && i+1 < len(peeked) && peeked[i+1] == '/':
-			return true
+	typ reflect.Type // Type of an embedded struct, while its fields are being collected
+}
 
-		default:
-			return false
-		}
+// typeFields returns the fields of a struct type in declaration order, following the rules of
+// encoding/json. The fields of anonymous struct fields without a name in their tag, and of struct
+// fields tagged with the "inline" option, are promoted into the struct. When several fields have
+// the same name, the shallowest one wins, then the one with the name in its tag, and when that
+// still leaves more than one they are all dropped.
+// The error reports a "default=" tag option that cannot be decoded into its field.
+func typeFields(structType reflect.Type) ([]structField, error) {
+	if cached, ok := fieldCache.Load(structType); ok {
+		return cached.(*cachedFields).fields, cached.(*cachedFields).err
 	}
+	var fields, err = collectFields(structType)
+	var cached, _ = fieldCache.LoadOrStore(structType, &cachedFields{fields: fields, err: err})
+	return cached.(*cachedFields).fields, cached.(*cachedFields).err
+}
 
-	return false
+// fieldCache holds the fields of each struct type, keyed by reflect.Type.
+var fieldCache sync.Map
+
+// cachedFields is the entry of fieldCache for a struct type.
+type cachedFields struct {
+	fields []structField
+	err    error // Error for an invalid tag, returned each time the type is decoded
 }
 
-// extractLineComment extracts any line comment after the current value.
-// This method reads and parses the comment text following a VDF value.
-func (d *Decoder) extractLineComment() string {
-	line, err := d.reader.ReadString('\n')
-	if err != nil && !errors.Is(err, io.EOF) {
-		return ""
-	}
+// collectFields returns the fields of a struct type for typeFields.
+func collectFields(structType reflect.Type) ([]structField, error) {
+	var fields []structField
+	var tagErr error
+
+	// Walk the embedded structs breadth first, one depth at a time, counting the structs
+	// of each type at the current and next depths so that ambiguous fields are dropped.
+	var current, next = []structField{}, []structField{{typ: structType}}
+	var count, nextCount = map[reflect.Type]int{}, map[reflect.Type]int{structType: 1}
+	var visited = map[reflect.Type]bool{}
+	for len(next) > 0 {
+		current, next = next, current[:0]
+		count, nextCount = nextCount, map[reflect.Type]int{}
+
+		for _, parent := range current {
+			if visited[parent.typ] {
+				continue
+			}
+			visited[parent.typ] = true
 
-	var commentStart = strings.Index(line, "//")
-	if commentStart == -1 {
-		return ""
-	}
+			for j := range parent.typ.NumField() {
+				var field = parent.typ.Field(j)
+				var fieldType = field.Type
+				if fieldType.Kind() == reflect.Ptr {
+					fieldType = fieldType.Elem()
+				}
 
-	return strings.TrimSpace(line[commentStart+2:]) // +2 to skip the "//" prefix
-}
+				// Skip unexported fields, apart from embedded structs whose exported fields are promoted.
+				// Unexported embedded pointers cannot be allocated, so their fields are skipped too.
+				if !field.IsExported() && (!field.Anonymous || field.Type.Kind() != reflect.Struct) {
+					continue
+				}
 
-// mapNodeToStruct maps the contents of a Node to a user-defined struct.
-// This function uses reflection to map VDF key-value pairs to struct fields
-// using the "vdf" struct tag for field name mapping.
-func mapNodeToStruct(node *Node, target any) error {
-	var targetValue = reflect.ValueOf(target)
-	if targetValue.Kind() != reflect.Ptr || targetValue.IsNil() {
-		return newValidationError("target must be a non-nil pointer to a struct")
-	}
-	if targetValue = targetValue.Elem(); targetValue.Kind() != reflect.Struct {
-		return newValidationError("target must be a pointer to a struct")
-	}
+				// Determine the field name, skipping fields with "-" tag.
+				var name, options = parseTag(field)
+				if name == "-" {
+					continue
+				}
+				var tag = field.Tag.Get("vdf")
+				var tagName, _, _ = strings.Cut(tag, ",")
+				var tagged = tagName != "" && tag != "-"
+				var index = append(slices.Clone(parent.index), j)
+
+				// Promote the fields of embedded and inline structs.
+				var inline = slices.Contains(options, "inline") || (field.Anonymous && !tagged)
+				if inline && fieldType.Kind() == reflect.Struct {
+					if nextCount[fieldType]++; nextCount[fieldType] == 1 {
+						next = append(next, structField{index: index, typ: fieldType})
+					}
+					continue
+				}
+				if !field.IsExported() {
+					continue
+				}
+				if err := checkDefault(name, field.Type, options); err != nil && tagErr == nil {
+					tagErr = err
+				}
 
-	// Build a map of field names to field info for efficient lookup.
-	var fieldMap = buildFieldMap(targetValue.Type())
-	for key, child := range node.Children {
-		var fieldInfo, exists = fieldMap[key]
-		if !exists {
-			// Try case-insensitive match.
-			for vdfKey, info := range fieldMap {
-				if strings.EqualFold(vdfKey, key) {
-					fieldInfo = info
-					exists = true
-					break
+				fields = append(fields, structField{name: name, index: index, tag: tag, options: options, tagged: tagged})
+				if count[parent.typ] > 1 {
+					// The same struct was embedded more than once at this depth, so add the
+					// field again for it to be dropped as ambiguous.
+					fields = append(fields, fields[len(fields)-1])
 				}
 			}
 		}
-		if !exists {
-			continue // Skip unknown fields.
-		}
+	}
 
-		var field = targetValue.FieldByIndex(fieldInfo.Index)
-		if !field.CanSet() {
-			continue
+	// Keep the dominant field of each name: the shallowest, then the tagged one.
+	slices.SortStableFunc(fields, func(a, b structField) int {
+		if c := strings.Compare(a.name, b.name); c != 0 {
+			return c
 		}
-
-		// Check if field implements Unmarshaler interface.
-		if field.CanAddr() && field.Addr().Type().Implements(reflect.TypeOf((*Unmarshaler)(nil)).Elem()) {
-			var unmarshaler = field.Addr().Interface().(Unmarshaler)
-			if err := unmarshaler.UnmarshalVDF(child); err != nil {
-				return err
+		if c := len(a.index) - len(b.index); c != 0 {
+			return c
+		}
+		if a.tagged != b.tagged {
+			if a.tagged {
+				return -1
 			}
+			return 1
+		}
+		return slices.Compare(a.index, b.index)
+	})
+	var dominant = fields[:0]
+	for i := 0; i < len(fields); {
+		var j = i + 1
+		for j < len(fields) && fields[j].name == fields[i].name {
+			j++
+		}
+		if j-i == 1 || len(fields[i].index) != len(fields[i+1].index) || fields[i].tagged != fields[i+1].tagged {
+			dominant = append(dominant, fields[i])
+		}
+		i = j
+	}
+
+	slices.SortFunc(dominant, func(a, b structField) int {
+		return slices.Compare(a.index, b.index)
+	})
+	return dominant, tagErr
+}
+
+// checkDefault reports an error when the "default=" option of a field cannot be decoded into its type,
+// because the field does not hold a scalar value or the default is not a valid value for it.
+func checkDefault(name string, fieldType reflect.Type, options []string) error {
+	for _, option := range options {
+		value, ok := strings.CutPrefix(option, "default=")
+		if !ok {
 			continue
 		}
 
-		switch child.Type {
-		case NodeTypeMap:
-			if err := setMapValue(field, child); err != nil {
-				return err
-			}
+		var err = setScalarValue(reflect.New(fieldType).Elem(), value)
+		var validationErr *ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			return newValidationError(fmt.Sprintf("field %q of type %v cannot have a default value", name, fieldType))
 
-		case NodeTypeScalar:
-			if err := setScalarValue(field, child.Value); err != nil {
-				return err
-			}
+		case err != nil:
+			return fmt.Errorf("invalid default value for field %q: %w", name, err)
 		}
 	}
-
 	return nil
 }
 
-// fieldInfo contains information about a struct field.
-// This is used internally for efficient field mapping during struct conversion.
-type fieldInfo struct {
-	Index []int  // Field index for reflection access
-	Tag   string // VDF tag value for field name mapping
+// fieldByIndex returns the field of a struct with the given index sequence. Nil pointers to
+// embedded structs along the way are allocated when alloc is set, and otherwise the zero
+// Value is returned for them.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc || !v.CanSet() {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
 }
 
 // buildFieldMap creates a map of field names to field information.
 // This function processes struct tags to build an efficient lookup table for field mapping.
-func buildFieldMap(structType reflect.Type) map[string]fieldInfo {
-	var fieldMap = make(map[string]fieldInfo)
-	for i := range structType.NumField() {
-		// Skip unexported fields.
-		var field = structType.Field(i)
-		if !field.IsExported() {
-			continue
-		}
-
-		// Determine the field name.
-		var fieldName string
-		var vdfTag = field.Tag.Get("vdf")
-		if vdfTag != "" && vdfTag != "-" {
-			// Use the vdf tag value, but handle comma-separated options.
-			fieldName = strings.Split(vdfTag, ",")[0]
-		} else {
-			// Use the field name (lowercased for consistency with VDF keys).
-			fieldName = strings.ToLower(field.Name)
-		}
-
-		// Skip fields with "-" tag.
-		if fieldName == "-" {
-			continue
-		}
+// It returns an error for a struct type with an invalid "default=" tag option.
+func buildFieldMap(structType reflect.Type) (map[string]fieldInfo, error) {
+	var fields, err = typeFields(structType)
+	if err != nil {
+		return nil, err
+	}
 
-		fieldMap[fieldName] = fieldInfo{
-			Index: field.Index,
-			Tag:   vdfTag,
+	var fieldMap = make(map[string]fieldInfo)
+	for _, field := range fields {
+		var info = fieldInfo{
+			Index:    field.index,
+			Tag:      field.tag,
+			Key:      slices.Contains(field.options, "key"),
+			List:     parseListStyle(field.options),
+			Required: slices.Contains(field.options, "required"),
+		}
+		for _, option := range field.options {
+			if value, ok := strings.CutPrefix(option, "default="); ok {
+				info.Default, info.HasDefault = value, true
+			}
 		}
+		fieldMap[field.name] = info
 	}
-	return fieldMap
+	return fieldMap, nil
 }
 
 // setMapValue sets a map/struct value from a Node.
 // This function handles the conversion of VDF map nodes to Go struct or map types.
-func setMapValue(field reflect.Value, node *Node) error {
+func (d *valueDecoder) setMapValue(field reflect.Value, node *Node) error {
 	switch field.Kind() {
 	case reflect.Struct:
 		// Create a new instance of the struct type.
 		if field.CanAddr() {
-			return mapNodeToStruct(node, field.Addr().Interface())
+			return d.mapNodeToStruct(node, field.Addr().Interface())
 		}
 		return newValidationError("cannot set struct field")
 
@@ -512,29 +775,170 @@ func setMapValue(field reflect.Value, node *Node) error {
 		if field.IsNil() {
 			field.Set(reflect.New(field.Type().Elem()))
 		}
-		return mapNodeToStruct(node, field.Interface())
+		return d.mapNodeToStruct(node, field.Interface())
 
 	case reflect.Map:
 		if field.IsNil() {
 			field.Set(reflect.MakeMap(field.Type()))
 		}
 
-		// For maps, we need to determine the key and value types.
-		// This is a simplified implementation - in practice, VDF maps are usually structs.
-		return newValidationError("map type not supported for VDF decoding")
+		// Each child becomes an entry, with later occurrences of a repeated key replacing earlier ones.
+		var keyType, elemType = field.Type().Key(), field.Type().Elem()
+		for _, e := range node.entries(false) {
+			key, err := mapKey(keyType, e.key)
+			if err != nil {
+				return err
+			}
+
+			var elem = reflect.New(elemType).Elem()
+			d.path = append(d.path, e.key)
+			err = d.setValue(elem, e.node)
+			d.path = d.path[:len(d.path)-1]
+			if err != nil {
+				return err
+			}
+			if err := setKeyFields(elem, e.key); err != nil {
+				return err
+			}
+			field.SetMapIndex(key, elem)
+		}
+		return nil
+
+	case reflect.Slice, reflect.Array:
+		return d.setListValue(field, node, 0)
 
 	default:
 		return newValidationError(fmt.Sprintf("unsupported type for map value: %v", field.Kind()))
 	}
 }
 
+// setListValue sets a slice or array from a map node whose keys number its elements from base.
+// The keys must count up from base in order without gaps.
+func (d *valueDecoder) setListValue(field reflect.Value, node *Node, base int) error {
+	if node.Type != NodeTypeMap {
+		return newValidationError(fmt.Sprintf("expected numbered list for %v, got scalar", field.Type()))
+	}
+
+	var entries = node.entries(false)
+	var elems, keys = make([]*Node, len(entries)), make([]string, len(entries))
+	for i, e := range entries {
+		if want := strconv.Itoa(base + i); e.key != want {
+			return newValidationError(fmt.Sprintf("list key %q out of sequence, expected %q", e.key, want))
+		}
+		elems[i], keys[i] = e.node, e.key
+	}
+	return d.setRepeatedValue(field, elems, keys)
+}
+
+// setRepeatedValue sets a slice or array from the nodes of its elements in order, where keys
+// holds the key of each element or is nil when they share the key of the list.
+// A slice is replaced, and the elements of an array past the last node are zeroed.
+func (d *valueDecoder) setRepeatedValue(field reflect.Value, nodes []*Node, keys []string) error {
+	switch field.Kind() {
+	case reflect.Slice:
+		field.Set(reflect.MakeSlice(field.Type(), len(nodes), len(nodes)))
+
+	case reflect.Array:
+		if len(nodes) > field.Len() {
+			return newValidationError(fmt.Sprintf("%d elements do not fit in %v", len(nodes), field.Type()))
+		}
+		field.SetZero()
+
+	default:
+		return newValidationError(fmt.Sprintf("unsupported type for list: %v", field.Kind()))
+	}
+
+	for i, node := range nodes {
+		if keys != nil {
+			d.path = append(d.path, keys[i])
+		}
+		var err = d.setValue(field.Index(i), node)
+		if keys != nil {
+			d.path = d.path[:len(d.path)-1]
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapKey converts a VDF key to a value of keyType, which must be a string or integer type
+// or implement encoding.TextUnmarshaler.
+func mapKey(keyType reflect.Type, key string) (reflect.Value, error) {
+	if !reflect.PointerTo(keyType).Implements(reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()) {
+		switch keyType.Kind() {
+		case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+
+		default:
+			return reflect.Value{}, newValidationError(fmt.Sprintf("unsupported type for map key: %v", keyType))
+		}
+	}
+
+	var value = reflect.New(keyType).Elem()
+	if err := setScalarValue(value, key); err != nil {
+		return reflect.Value{}, err
+	}
+	return value, nil
+}
+
+// setKeyFields copies the key of a map entry into the fields of its struct value tagged with the "key" option.
+func setKeyFields(elem reflect.Value, key string) error {
+	for elem.Kind() == reflect.Ptr && !elem.IsNil() {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var fieldMap, err = buildFieldMap(elem.Type())
+	if err != nil {
+		return err
+	}
+	for _, info := range fieldMap {
+		if !info.Key {
+			continue
+		}
+		if err := setScalarValue(fieldByIndex(elem, info.Index, true), key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// durationType is the type of time.Duration, which is also read in the form of its String method.
+var durationType = reflect.TypeOf(time.Duration(0))
+
 // setScalarValue sets a scalar value from a string.
-// This function handles the conversion of VDF scalar values to Go primitive types.
+// This function handles the conversion of VDF scalar values to Go primitive types,
+// and to types implementing encoding.TextUnmarshaler.
 func setScalarValue(field reflect.Value, value string) error {
 	if !field.CanSet() {
 		return newValidationError("field cannot be set")
 	}
 
+	// Check if field implements encoding.TextUnmarshaler interface.
+	if field.CanAddr() && field.Addr().Type().Implements(reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()) {
+		var unmarshaler = field.Addr().Interface().(encoding.TextUnmarshaler)
+		if err := unmarshaler.UnmarshalText([]byte(value)); err != nil {
+			return newTypeError(field.Type().String(), value, err)
+		}
+		return nil
+	}
+
+	// Durations are read as nanoseconds, or in the form written by the stringer option, such as "1m0s".
+	if field.Type() == durationType {
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			var duration, err = time.ParseDuration(value)
+			if err != nil {
+				return newTypeError("time.Duration", value, err)
+			}
+			field.SetInt(int64(duration))
+			return nil
+		}
+	}
+
 	switch field.Kind() {
 	case reflect.Ptr:
 		if field.IsNil() {
@@ -1,6 +1,7 @@
 package govdf_test
 
 import (
+	"bytes"
 	"strings"
 	"testing"
 
@@ -283,3 +284,42 @@ func BenchmarkUnmarshal_OptionalFields(b *testing.B) {
 		require.NoError(b, govdf.Unmarshal([]byte(vdfData), &data))
 	}
 }
+
+func BenchmarkUnmarshal_Fixture(b *testing.B) {
+	data, err := fixtures.ReadFile("fixtures/csgo_english.vdf")
+	require.NoError(b, err)
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for b.Loop() {
+		var node govdf.Node
+		require.NoError(b, govdf.Unmarshal(data, &node))
+	}
+}
+
+func BenchmarkDecoder_Fixture(b *testing.B) {
+	data, err := fixtures.ReadFile("fixtures/csgo_english.vdf")
+	require.NoError(b, err)
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for b.Loop() {
+		var node govdf.Node
+		require.NoError(b, govdf.NewDecoder(bytes.NewReader(data)).Decode(&node))
+	}
+}
+
+func BenchmarkParseLazyDocument_Fixture(b *testing.B) {
+	data, err := fixtures.ReadFile("fixtures/csgo_english.vdf")
+	require.NoError(b, err)
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for b.Loop() {
+		_, err := govdf.ParseLazyDocument(data, govdf.WithStrict(false))
+		require.NoError(b, err)
+	}
+}
@@ -3,11 +3,11 @@ package govdf
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
-	"reflect"
 	"strconv"
 )
 
@@ -28,35 +28,55 @@ const (
 // UnmarshalBinary parses binary VDF-encoded data and stores the result
 // in the value pointed to by v. Binary VDF is Valve's binary serialization
 // of the KeyValues format, using type-tagged fields with null-terminated strings.
-func UnmarshalBinary(in []byte, out any) error {
-	return NewBinaryDecoder(bytes.NewReader(in)).Decode(out)
+// The key and value ranges of decoded nodes hold byte offsets that include the null terminators.
+// WithLimits and WithDuplicateKeys(DuplicateKeepAll) apply to binary input, as do
+// WithDisallowUnknownFields and WithMetadata when decoding into a struct. Other options are
+// ignored, and a repeated key otherwise replaces the earlier value.
+func UnmarshalBinary(in []byte, out any, opts ...Option) error {
+	return NewBinaryDecoder(bytes.NewReader(in), opts...).Decode(out)
 }
 
 // BinaryDecoder decodes binary VDF data into Node structures.
 type BinaryDecoder struct {
 	reader *bufio.Reader
+	opts   options
 	buf    bytes.Buffer
+
+	// The number of bytes read, and the number of nodes created by the current Decode
+	offset int64
+	nodes  int
+
+	// Checks the context of DecodeContext for cancellation
+	cancel contextChecker
 }
 
 // NewBinaryDecoder returns a new binary VDF decoder that reads from r.
-func NewBinaryDecoder(r io.Reader) *BinaryDecoder {
-	return &BinaryDecoder{reader: bufio.NewReader(r)}
+// WithLimits and WithDuplicateKeys(DuplicateKeepAll) apply to binary input, as do
+// WithDisallowUnknownFields and WithMetadata when decoding into a struct. Other options are
+// ignored, and a repeated key otherwise replaces the earlier value.
+func NewBinaryDecoder(r io.Reader, opts ...Option) *BinaryDecoder {
+	return &BinaryDecoder{reader: bufio.NewReader(r), opts: newOptions(opts)}
 }
 
 // Decode reads the binary VDF-encoded value and stores it in v.
-// The target value v must be a pointer to a *Node or a struct.
+// The target value v must be a pointer to a struct, a map, an interface or a *Node, as for Unmarshal.
 func (d *BinaryDecoder) Decode(v any) error {
+	d.nodes = 0
 	node, err := d.parseRoot()
 	if err != nil {
 		return err
 	}
 
-	if _, ok := v.(*Node); ok {
-		reflect.ValueOf(v).Elem().Set(reflect.ValueOf(node).Elem())
-		return nil
-	}
+	return unmarshalNode(node, v, &d.opts)
+}
 
-	return mapNodeToStruct(node, v)
+// DecodeContext is like Decode, but stops when ctx is cancelled or its deadline passes.
+// The context is checked periodically while reading the input, and its error is returned
+// wrapped with the offset reached.
+func (d *BinaryDecoder) DecodeContext(ctx context.Context, v any) error {
+	d.cancel = contextChecker{ctx: ctx}
+	defer func() { d.cancel = contextChecker{} }()
+	return d.Decode(v)
 }
 
 // parseRoot reads the top-level binary VDF object.
@@ -81,25 +101,38 @@ func (d *BinaryDecoder) parseRoot() (*Node, error) {
 			return nil, fmt.Errorf("expected object tag (0x00) at root, got 0x%02X", tag)
 		}
 
-		key, err := d.readNullTerminatedString()
+		var keyStart = d.offset
+		key, err := d.readNullTerminatedString("MaxKeyLength", d.opts.limits.MaxKeyLength)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read root key: %w", err)
 		}
+		var keyRange = offsetRange(keyStart, d.offset)
 
-		child, err := d.parseObject()
+		child, err := d.parseObject(1)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse root object %q: %w", key, err)
 		}
 
-		root.Children[key] = child
+		child.KeyRange = keyRange
+		d.addChild(root, key, child)
 	}
 }
 
 // parseObject reads an object's children until the end tag (0x08).
-func (d *BinaryDecoder) parseObject() (*Node, error) {
+// The depth is the nesting depth of the object, where a top-level object has depth 1.
+// The value range of the object runs from just after its key to the end of its end tag.
+func (d *BinaryDecoder) parseObject(depth int) (*Node, error) {
+	if limit := d.opts.limits.MaxDepth; limit > 0 && depth > limit {
+		return nil, d.limitError("MaxDepth", int64(limit))
+	}
+	if err := d.countNode(); err != nil {
+		return nil, err
+	}
+
 	var node = &Node{
-		Type:     NodeTypeMap,
-		Children: make(map[string]*Node),
+		Type:       NodeTypeMap,
+		Children:   make(map[string]*Node),
+		ValueRange: Range{Start: Position{Offset: d.offset}},
 	}
 	for {
 		tag, err := d.readByte()
@@ -108,70 +141,139 @@ func (d *BinaryDecoder) parseObject() (*Node, error) {
 		}
 
 		if tag == binaryTypeEnd {
+			node.ValueRange.End.Offset = d.offset
 			return node, nil
 		}
 
-		key, err := d.readNullTerminatedString()
+		var keyStart = d.offset
+		key, err := d.readNullTerminatedString("MaxKeyLength", d.opts.limits.MaxKeyLength)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read key: %w", err)
 		}
+		var keyRange = offsetRange(keyStart, d.offset)
 
+		// Objects count themselves once their depth has been checked
+		if tag != binaryTypeObject {
+			if err := d.countNode(); err != nil {
+				return nil, err
+			}
+		}
+
+		var child = &Node{Type: NodeTypeScalar}
+		var valueStart = d.offset
 		switch tag {
 		case binaryTypeObject:
-			child, err := d.parseObject()
-			if err != nil {
+			if child, err = d.parseObject(depth + 1); err != nil {
 				return nil, fmt.Errorf("failed to parse object %q: %w", key, err)
 			}
-			node.Children[key] = child
 
 		case binaryTypeString, binaryTypeWString:
-			value, err := d.readNullTerminatedString()
-			if err != nil {
+			if child.Value, err = d.readNullTerminatedString("MaxValueLength", d.opts.limits.MaxValueLength); err != nil {
 				return nil, fmt.Errorf("failed to read string value for %q: %w", key, err)
 			}
-			node.Children[key] = &Node{Type: NodeTypeScalar, Value: value}
 
 		case binaryTypeInt32, binaryTypeColor, binaryTypePointer:
 			var v int32
-			if err := binary.Read(d.reader, binary.LittleEndian, &v); err != nil {
+			if err := d.read(&v); err != nil {
 				return nil, fmt.Errorf("failed to read int32 value for %q: %w", key, err)
 			}
-			node.Children[key] = &Node{Type: NodeTypeScalar, Value: strconv.Itoa(int(v))}
+			child.Value = strconv.Itoa(int(v))
 
 		case binaryTypeFloat32:
 			var v float32
-			if err := binary.Read(d.reader, binary.LittleEndian, &v); err != nil {
+			if err := d.read(&v); err != nil {
 				return nil, fmt.Errorf("failed to read float32 value for %q: %w", key, err)
 			}
-			node.Children[key] = &Node{Type: NodeTypeScalar, Value: fmt.Sprintf("%g", v)}
+			child.Value = fmt.Sprintf("%g", v)
 
 		case binaryTypeUint64:
 			var v uint64
-			if err := binary.Read(d.reader, binary.LittleEndian, &v); err != nil {
+			if err := d.read(&v); err != nil {
 				return nil, fmt.Errorf("failed to read uint64 value for %q: %w", key, err)
 			}
-			node.Children[key] = &Node{Type: NodeTypeScalar, Value: strconv.FormatUint(v, 10)}
+			child.Value = strconv.FormatUint(v, 10)
 
 		case binaryTypeInt64:
 			var v int64
-			if err := binary.Read(d.reader, binary.LittleEndian, &v); err != nil {
+			if err := d.read(&v); err != nil {
 				return nil, fmt.Errorf("failed to read int64 value for %q: %w", key, err)
 			}
-			node.Children[key] = &Node{Type: NodeTypeScalar, Value: strconv.FormatInt(v, 10)}
+			child.Value = strconv.FormatInt(v, 10)
 
 		default:
 			return nil, fmt.Errorf("unknown binary VDF tag 0x%02X for key %q", tag, key)
 		}
+
+		child.KeyRange = keyRange
+		if child.Type == NodeTypeScalar {
+			child.ValueRange = offsetRange(valueStart, d.offset)
+		}
+		d.addChild(node, key, child)
 	}
 }
 
+// addChild adds child to parent under key. A repeated key replaces the earlier value, unless
+// every occurrence is kept with WithDuplicateKeys(DuplicateKeepAll).
+func (d *BinaryDecoder) addChild(parent *Node, key string, child *Node) {
+	if d.opts.duplicates == DuplicateKeepAll {
+		_, _ = addChild(parent, key, child, DuplicateKeepAll)
+		return
+	}
+	parent.set(key, child)
+}
+
+// offsetRange returns the range of binary input between two offsets.
+func offsetRange(start, end int64) Range {
+	return Range{Start: Position{Offset: start}, End: Position{Offset: end}}
+}
+
 // readByte reads a single byte from the reader.
 func (d *BinaryDecoder) readByte() (byte, error) {
-	return d.reader.ReadByte()
+	if err := d.cancel.check(); err != nil {
+		return 0, fmt.Errorf("offset %d: %w", d.offset, err)
+	}
+
+	b, err := d.reader.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	return b, d.advance(1)
+}
+
+// read reads a little-endian fixed-size value into v.
+func (d *BinaryDecoder) read(v any) error {
+	if err := binary.Read(d.reader, binary.LittleEndian, v); err != nil {
+		return err
+	}
+	return d.advance(int64(binary.Size(v)))
+}
+
+// advance counts n bytes of input against the MaxInputBytes limit.
+func (d *BinaryDecoder) advance(n int64) error {
+	d.offset += n
+	if limit := d.opts.limits.MaxInputBytes; limit > 0 && d.offset > limit {
+		return d.limitError("MaxInputBytes", limit)
+	}
+	return nil
+}
+
+// countNode counts a new node against the MaxNodes limit.
+func (d *BinaryDecoder) countNode() error {
+	d.nodes++
+	if limit := d.opts.limits.MaxNodes; limit > 0 && d.nodes > limit {
+		return d.limitError("MaxNodes", int64(limit))
+	}
+	return nil
+}
+
+// limitError returns a LimitError for the current offset.
+func (d *BinaryDecoder) limitError(limit string, max int64) *LimitError {
+	return &LimitError{Limit: limit, Max: max, Offset: d.offset}
 }
 
 // readNullTerminatedString reads bytes until a null terminator (0x00).
-func (d *BinaryDecoder) readNullTerminatedString() (string, error) {
+// Strings longer than max bytes are rejected with a LimitError for the named limit, unless max is zero.
+func (d *BinaryDecoder) readNullTerminatedString(limit string, max int) (string, error) {
 	d.buf.Reset()
 	for {
 		b, err := d.readByte()
@@ -181,6 +283,9 @@ func (d *BinaryDecoder) readNullTerminatedString() (string, error) {
 
 		case b == 0x00:
 			return d.buf.String(), nil
+
+		case max > 0 && d.buf.Len() >= max:
+			return "", d.limitError(limit, int64(max))
 		}
 		d.buf.WriteByte(b)
 	}
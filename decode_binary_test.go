@@ -332,6 +332,94 @@ func TestDecodeBinary_Struct(t *testing.T) {
 	require.Equal(t, "Game", root.AppInfo.Common.Type)
 }
 
+func TestDecodeBinary_DisallowUnknownFields(t *testing.T) {
+	t.Parallel()
+
+	type AppInfo struct {
+		AppID string `vdf:"appid"`
+	}
+	type Root struct {
+		AppInfo AppInfo `vdf:"appinfo"`
+	}
+
+	var buf bytes.Buffer
+	writeObject(&buf, "appinfo")
+	writeString(&buf, "appid", "730")
+	writeString(&buf, "name", "Counter-Strike 2")
+	writeEnd(&buf) // end appinfo
+	writeEnd(&buf) // end root
+
+	var root Root
+	err := govdf.UnmarshalBinary(buf.Bytes(), &root, govdf.WithDisallowUnknownFields())
+	require.EqualError(t, err, `offset 21: unknown field "appinfo/name"`)
+
+	var md govdf.Metadata
+	err = govdf.UnmarshalBinary(buf.Bytes(), &root, govdf.WithMetadata(&md))
+	require.NoError(t, err)
+	require.Equal(t, []govdf.Key{{"appinfo", "name"}}, md.Undecoded)
+}
+
+func TestDecodeBinary_RequiredAndDefault(t *testing.T) {
+	t.Parallel()
+
+	type AppInfo struct {
+		AppID int    `vdf:"appid,required"`
+		Type  string `vdf:"type,default=Game"`
+	}
+	type Root struct {
+		AppInfo AppInfo `vdf:"appinfo"`
+	}
+
+	var buf bytes.Buffer
+	writeObject(&buf, "appinfo")
+	writeInt32(&buf, "appid", 730)
+	writeEnd(&buf) // end appinfo
+	writeEnd(&buf) // end root
+
+	var root Root
+	err := govdf.UnmarshalBinary(buf.Bytes(), &root)
+	require.NoError(t, err)
+	require.Equal(t, AppInfo{AppID: 730, Type: "Game"}, root.AppInfo)
+
+	buf.Reset()
+	writeObject(&buf, "appinfo")
+	writeEnd(&buf) // end appinfo
+	writeEnd(&buf) // end root
+
+	err = govdf.UnmarshalBinary(buf.Bytes(), &root)
+	require.EqualError(t, err, `missing required field "appinfo/appid"`)
+}
+
+func TestDecodeBinary_RepeatedKeys(t *testing.T) {
+	t.Parallel()
+
+	type Depots struct {
+		Branches []string `vdf:"branch,list=repeated"`
+	}
+	type Root struct {
+		Depots Depots `vdf:"depots"`
+	}
+
+	var buf bytes.Buffer
+	writeObject(&buf, "depots")
+	writeString(&buf, "branch", "public")
+	writeString(&buf, "branch", "beta")
+	writeEnd(&buf) // end depots
+	writeEnd(&buf) // end root
+
+	// Act: Decode the repeated keys keeping every occurrence, and with the default policy.
+	var root Root
+	err := govdf.UnmarshalBinary(buf.Bytes(), &root, govdf.WithDuplicateKeys(govdf.DuplicateKeepAll))
+	require.NoError(t, err)
+	var node govdf.Node
+	require.NoError(t, govdf.UnmarshalBinary(buf.Bytes(), &node))
+
+	// Assert: Every occurrence should be kept only when asked for.
+	require.Equal(t, []string{"public", "beta"}, root.Depots.Branches)
+	require.Equal(t, "beta", node.Children["depots"].Children["branch"].Value)
+	require.Len(t, node.Children["depots"].All("branch"), 1)
+}
+
 func TestDecodeBinary_Decoder(t *testing.T) {
 	t.Parallel()
 
@@ -347,3 +435,92 @@ func TestDecodeBinary_Decoder(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, "730", node.Children["appinfo"].Children["appid"].Value)
 }
+
+func TestDecodeBinary_Limits(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	writeObject(&buf, "appinfo")
+	writeObject(&buf, "common")
+	writeString(&buf, "name", "Counter-Strike 2")
+	writeInt32(&buf, "appid", 730)
+	writeEnd(&buf)
+	writeEnd(&buf)
+	writeEnd(&buf)
+	var input = buf.Bytes()
+
+	var testCases = map[string]struct {
+		limits   govdf.Limits
+		expected *govdf.LimitError
+	}{
+		"within limits": {
+			limits: govdf.Limits{MaxDepth: 2, MaxKeyLength: 7, MaxValueLength: 16, MaxNodes: 4, MaxInputBytes: int64(len(input))},
+		},
+		"max depth": {
+			limits:   govdf.Limits{MaxDepth: 1},
+			expected: &govdf.LimitError{Limit: "MaxDepth", Max: 1, Offset: 17},
+		},
+		"max key length": {
+			limits:   govdf.Limits{MaxKeyLength: 6},
+			expected: &govdf.LimitError{Limit: "MaxKeyLength", Max: 6, Offset: 8},
+		},
+		"max value length": {
+			limits:   govdf.Limits{MaxValueLength: 7},
+			expected: &govdf.LimitError{Limit: "MaxValueLength", Max: 7, Offset: 31},
+		},
+		"max nodes": {
+			limits:   govdf.Limits{MaxNodes: 3},
+			expected: &govdf.LimitError{Limit: "MaxNodes", Max: 3, Offset: 47},
+		},
+		"max input bytes": {
+			limits:   govdf.Limits{MaxInputBytes: 20},
+			expected: &govdf.LimitError{Limit: "MaxInputBytes", Max: 20, Offset: 21},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act: Unmarshal the input with the limits.
+			var node govdf.Node
+			err := govdf.UnmarshalBinary(input, &node, govdf.WithLimits(tc.limits))
+
+			// Assert: The error should report the exceeded limit.
+			if tc.expected == nil {
+				require.NoError(t, err)
+				return
+			}
+			var limitErr *govdf.LimitError
+			require.ErrorAs(t, err, &limitErr)
+			require.Equal(t, tc.expected, limitErr)
+		})
+	}
+}
+
+func TestDecodeBinary_Ranges(t *testing.T) {
+	t.Parallel()
+
+	// Arrange: Build an object holding a string and an int32.
+	var buf bytes.Buffer
+	writeObject(&buf, "app")
+	writeString(&buf, "name", "cs")
+	writeInt32(&buf, "id", 730)
+	writeEnd(&buf)
+	writeEnd(&buf)
+
+	// Act: Unmarshal the input.
+	var node govdf.Node
+	require.NoError(t, govdf.UnmarshalBinary(buf.Bytes(), &node))
+
+	// Assert: Every node should record the byte offsets of its key and value.
+	var span = func(start, end int64) govdf.Range {
+		return govdf.Range{Start: govdf.Position{Offset: start}, End: govdf.Position{Offset: end}}
+	}
+	var app = node.Children["app"]
+	require.Equal(t, span(1, 5), app.KeyRange)
+	require.Equal(t, span(5, 23), app.ValueRange)
+	require.Equal(t, span(6, 11), app.Children["name"].KeyRange)
+	require.Equal(t, span(11, 14), app.Children["name"].ValueRange)
+	require.Equal(t, span(15, 18), app.Children["id"].KeyRange)
+	require.Equal(t, span(18, 22), app.Children["id"].ValueRange)
+}
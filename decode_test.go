@@ -1,14 +1,22 @@
 package govdf_test
 
 import (
+	"bytes"
 	"embed"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"math/big"
+	"net/netip"
+	"slices"
 	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	govdf "github.com/lewisgibson/go-vdf"
 	"github.com/stretchr/testify/require"
 )
@@ -282,8 +290,8 @@ func TestDecode_Node(t *testing.T) {
 								Type:  govdf.NodeTypeScalar,
 								Value: "Reload your gun",
 
-								Line:   2,
-								Column: 117,
+								Line:   3,
+								Column: 44,
 							},
 						},
 
@@ -348,6 +356,137 @@ func TestDecode_Node(t *testing.T) {
 					},
 				},
 
+				Line:   1,
+				Column: 1,
+			},
+		},
+		"unquoted key and value": {
+			input: `a b`,
+			expectedNode: govdf.Node{
+				Type: govdf.NodeTypeMap,
+				Children: map[string]*govdf.Node{
+					"a": {
+						Type:  govdf.NodeTypeScalar,
+						Value: "b",
+
+						Line:   1,
+						Column: 3,
+					},
+				},
+
+				Line:   1,
+				Column: 1,
+			},
+		},
+		"unquoted material": {
+			input: "LightmappedGeneric\n{\n\t$basetexture concrete/floor01\n\t$surfaceprop \"concrete\"\n}",
+			expectedNode: govdf.Node{
+				Type: govdf.NodeTypeMap,
+				Children: map[string]*govdf.Node{
+					"LightmappedGeneric": {
+						Type: govdf.NodeTypeMap,
+						Children: map[string]*govdf.Node{
+							"$basetexture": {
+								Type:  govdf.NodeTypeScalar,
+								Value: "concrete/floor01",
+
+								Line:   3,
+								Column: 15,
+							},
+							"$surfaceprop": {
+								Type:  govdf.NodeTypeScalar,
+								Value: "concrete",
+
+								Line:   4,
+								Column: 14,
+							},
+						},
+
+						Line:   2,
+						Column: 1,
+					},
+				},
+
+				Line:   1,
+				Column: 1,
+			},
+		},
+		"unquoted tokens terminated by braces and quotes": {
+			input: `a{b"c"d"e"}`,
+			expectedNode: govdf.Node{
+				Type: govdf.NodeTypeMap,
+				Children: map[string]*govdf.Node{
+					"a": {
+						Type: govdf.NodeTypeMap,
+						Children: map[string]*govdf.Node{
+							"b": {
+								Type:  govdf.NodeTypeScalar,
+								Value: "c",
+
+								Line:   1,
+								Column: 3,
+							},
+							"d": {
+								Type:  govdf.NodeTypeScalar,
+								Value: "e",
+
+								Line:   1,
+								Column: 7,
+							},
+						},
+
+						Line:   1,
+						Column: 2,
+					},
+				},
+
+				Line:   1,
+				Column: 1,
+			},
+		},
+		"unquoted value terminated by comment": {
+			input: "a {\n    // head\n    key value// line\n}",
+			expectedNode: govdf.Node{
+				Type: govdf.NodeTypeMap,
+				Children: map[string]*govdf.Node{
+					"a": {
+						Type: govdf.NodeTypeMap,
+						Children: map[string]*govdf.Node{
+							"key": {
+								Type:  govdf.NodeTypeScalar,
+								Value: "value",
+
+								Line:   3,
+								Column: 9,
+
+								HeadComment: "head",
+								LineComment: "line",
+							},
+						},
+
+						Line:   1,
+						Column: 3,
+					},
+				},
+
+				Line:   1,
+				Column: 1,
+			},
+		},
+		"unquoted value with single slashes": {
+			input: `path materials/models/weapons`,
+			expectedNode: govdf.Node{
+				Type: govdf.NodeTypeMap,
+				Children: map[string]*govdf.Node{
+					"path": {
+						Type:  govdf.NodeTypeScalar,
+						Value: "materials/models/weapons",
+
+						Line:   1,
+						Column: 6,
+					},
+				},
+
 				Line:   1,
 				Column: 1,
 			},
@@ -361,8 +500,8 @@ func TestDecode_Node(t *testing.T) {
 			node := govdf.Node{}
 			require.NoErrorf(t, govdf.Unmarshal([]byte(tc.input), &node), "output: %s", node)
 
-			// Assert: The node should match the expected node.
-			if diff := cmp.Diff(tc.expectedNode, node); diff != "" {
+			// Assert: The node should match the expected node. Key order is covered by TestDecode_KeyOrder.
+			if diff := cmp.Diff(tc.expectedNode, node, cmpopts.IgnoreFields(govdf.Node{}, "Keys", "KeyRange", "ValueRange")); diff != "" {
 				t.Errorf("unexpected node (-want +got):\n%s", diff)
 			}
 		})
@@ -579,6 +718,112 @@ func TestDecode_Struct(t *testing.T) {
 				}
 			},
 		},
+		"map with string keys": {
+			input: `"apps" { "730" "Counter-Strike 2" "570" "Dota 2" }`,
+			createStructs: func() (any, any) {
+				type AppsStruct struct {
+					Apps map[string]string `vdf:"apps"`
+				}
+				return &AppsStruct{}, &AppsStruct{
+					Apps: map[string]string{"730": "Counter-Strike 2", "570": "Dota 2"},
+				}
+			},
+		},
+		"map with integer keys and struct values": {
+			input: `"items" { "507" { "name" "knife" } "1" { "name" "deagle" } }`,
+			createStructs: func() (any, any) {
+				type Item struct {
+					Name string `vdf:"name"`
+				}
+				type ItemsStruct struct {
+					Items map[int]Item `vdf:"items"`
+				}
+				return &ItemsStruct{}, &ItemsStruct{
+					Items: map[int]Item{507: {Name: "knife"}, 1: {Name: "deagle"}},
+				}
+			},
+		},
+		"map with key field": {
+			input: `"items" { "507" { "name" "knife" } }`,
+			createStructs: func() (any, any) {
+				type Item struct {
+					ID   uint32 `vdf:",key"`
+					Name string `vdf:"name"`
+				}
+				type ItemsStruct struct {
+					Items map[uint32]*Item `vdf:"items"`
+				}
+				return &ItemsStruct{}, &ItemsStruct{
+					Items: map[uint32]*Item{507: {ID: 507, Name: "knife"}},
+				}
+			},
+		},
+		"map with text unmarshaler keys": {
+			input: `"servers" { "127.0.0.1" "local" "::1" "local6" }`,
+			createStructs: func() (any, any) {
+				type ServersStruct struct {
+					Servers map[netip.Addr]string `vdf:"servers"`
+				}
+				return &ServersStruct{}, &ServersStruct{
+					Servers: map[netip.Addr]string{
+						netip.MustParseAddr("127.0.0.1"): "local",
+						netip.MustParseAddr("::1"):       "local6",
+					},
+				}
+			},
+		},
+		"nested maps": {
+			input: `"lang" { "english" { "greeting" "hello" } "french" { "greeting" "bonjour" } }`,
+			createStructs: func() (any, any) {
+				type LangStruct struct {
+					Lang map[string]map[string]string `vdf:"lang"`
+				}
+				return &LangStruct{}, &LangStruct{
+					Lang: map[string]map[string]string{
+						"english": {"greeting": "hello"},
+						"french":  {"greeting": "bonjour"},
+					},
+				}
+			},
+		},
+		"map with unmarshaler values": {
+			input: `"fields" { "a" "x" "b" "y" }`,
+			createStructs: func() (any, any) {
+				type FieldsStruct struct {
+					Fields map[string]mockUnmarshaler `vdf:"fields"`
+				}
+				return &FieldsStruct{}, &FieldsStruct{
+					Fields: map[string]mockUnmarshaler{"a": "custom:x", "b": "custom:y"},
+				}
+			},
+		},
+		"numbered list": {
+			input: `"maps" { "0" "de_dust2" "1" "de_inferno" } "bots" { "1" { "name" "Rock" } "2" { "name" "Vitaliy" } }`,
+			createStructs: func() (any, any) {
+				type Bot struct {
+					Name string `vdf:"name"`
+				}
+				type ListsStruct struct {
+					Maps []string `vdf:"maps"`
+					Bots [3]Bot   `vdf:"bots,list=1"`
+				}
+				return &ListsStruct{}, &ListsStruct{
+					Maps: []string{"de_dust2", "de_inferno"},
+					Bots: [3]Bot{{Name: "Rock"}, {Name: "Vitaliy"}},
+				}
+			},
+		},
+		"nested numbered lists": {
+			input: `"grid" { "0" { "0" "1" "1" "2" } "1" { "0" "3" } }`,
+			createStructs: func() (any, any) {
+				type GridStruct struct {
+					Grid [][]int `vdf:"grid"`
+				}
+				return &GridStruct{Grid: [][]int{{9, 9, 9}}}, &GridStruct{
+					Grid: [][]int{{1, 2}, {3}},
+				}
+			},
+		},
 		"custom unmarshaler": {
 			input: `"custom_field" "test_value"`,
 			createStructs: func() (any, any) {
@@ -659,12 +904,12 @@ func TestDecode_ErrorHandling(t *testing.T) {
 		errorSubstr string
 	}{
 		"invalid rune": {
-			input:       string([]byte{0xFF, 0xFE}), // Invalid UTF-8
+			input:       string([]byte{0xFF, 0xFF}), // Invalid UTF-8, not a UTF-16 byte order mark
 			expectError: true,
 			errorSubstr: "invalid rune",
 		},
 		"unexpected character": {
-			input:       `"key" "value" unexpected`,
+			input:       "\"key\" \"value\" \x01",
 			expectError: true,
 			errorSubstr: "unexpected character",
 		},
@@ -696,19 +941,29 @@ func TestDecode_ErrorHandling(t *testing.T) {
 			expectError: false, // Empty input should result in empty map
 		},
 		"only whitespace": {
-			input:       `   \t\n\r   `,
-			expectError: true, // This actually causes an error
+			input:       "   \t\n\r   ",
+			expectError: false, // Whitespace only input should result in empty map
 		},
 		"unexpected character in key": {
-			input:       `"key" "value" x`,
+			input:       "\"key\" \"value\" x\x01",
 			expectError: true,
 			errorSubstr: "unexpected character",
 		},
 		"unexpected character after map": {
-			input:       `"key" { "nested" "value" } x`,
+			input:       "\"key\" { \"nested\" \"value\" } \x01",
 			expectError: true,
 			errorSubstr: "unexpected character",
 		},
+		"invalid rune in quoted string": {
+			input:       "\"key\" \"val\xffue\"",
+			expectError: true,
+			errorSubstr: "line 1, column 12: invalid rune",
+		},
+		"invalid rune in comment": {
+			input:       "// comment \xff\n\"key\" \"value\"",
+			expectError: true,
+			errorSubstr: "invalid rune",
+		},
 	}
 	for name, tc := range testCases {
 		t.Run(name, func(t *testing.T) {
@@ -888,7 +1143,7 @@ func TestDecode_EdgeCases(t *testing.T) {
 			node := govdf.Node{}
 			require.NoError(t, govdf.Unmarshal([]byte(tc.input), &node))
 
-			if diff := cmp.Diff(tc.expectedNode, node); diff != "" {
+			if diff := cmp.Diff(tc.expectedNode, node, cmpopts.IgnoreFields(govdf.Node{}, "Keys", "KeyRange", "ValueRange")); diff != "" {
 				t.Errorf("unexpected node (-want +got):\n%s", diff)
 			}
 		})
@@ -1329,6 +1584,23 @@ func TestParseError_WithoutExpected(t *testing.T) {
 	require.NotContains(t, result, "found")
 }
 
+func TestErrorList(t *testing.T) {
+	t.Parallel()
+
+	var list = govdf.ErrorList{
+		{Line: 1, Column: 1, Message: "unexpected '}' at root level"},
+		{Line: 4, Column: 2, Message: "unclosed '{'", Severity: govdf.SeverityWarning},
+	}
+
+	require.Equal(t, "line 1, column 1: unexpected '}' at root level (and 1 more)", list.Error())
+	require.Equal(t, "line 4, column 2: warning: unclosed '{'", list[1].Error())
+	require.Equal(t, "no errors", govdf.ErrorList{}.Error())
+
+	var parseErr *govdf.ParseError
+	require.ErrorAs(t, error(list), &parseErr)
+	require.Equal(t, 1, parseErr.Line)
+}
+
 func TestValidationError(t *testing.T) {
 	t.Parallel()
 
@@ -1346,76 +1618,1739 @@ func TestDecode_MapTypeField(t *testing.T) {
 		Data map[string]string `vdf:"data"`
 	}
 
-	var target WithMap
+	var target = WithMap{Data: map[string]string{"existing": "kept"}}
 	err := govdf.Unmarshal([]byte(`"data" { "key" "value" }`), &target)
-	require.Error(t, err)
-	require.Contains(t, err.Error(), "map type not supported")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"existing": "kept", "key": "value"}, target.Data)
 }
 
-func TestDecode_UnsupportedMapValueType(t *testing.T) {
+func TestDecode_MapErrors(t *testing.T) {
 	t.Parallel()
 
-	type WithChan struct {
-		Data chan int `vdf:"data"`
+	var testCases = map[string]struct {
+		input         string
+		target        any
+		expectedError string
+	}{
+		"invalid integer key": {
+			input: `"data" { "abc" "value" }`,
+			target: &struct {
+				Data map[int]string `vdf:"data"`
+			}{},
+			expectedError: `error converting "abc" to int: strconv.ParseInt: parsing "abc": invalid syntax`,
+		},
+		"integer key overflow": {
+			input: `"data" { "300" "value" }`,
+			target: &struct {
+				Data map[uint8]string `vdf:"data"`
+			}{},
+			expectedError: "uint value 300 overflows",
+		},
+		"invalid text unmarshaler key": {
+			input: `"data" { "not an address" "value" }`,
+			target: &struct {
+				Data map[netip.Addr]string `vdf:"data"`
+			}{},
+			expectedError: `error converting "not an address" to netip.Addr: ParseAddr("not an address"): unable to parse IP`,
+		},
+		"unsupported key type": {
+			input: `"data" { "1.5" "value" }`,
+			target: &struct {
+				Data map[float64]string `vdf:"data"`
+			}{},
+			expectedError: "validation error: unsupported type for map key: float64",
+		},
+		"invalid value": {
+			input: `"data" { "a" "x" }`,
+			target: &struct {
+				Data map[string]int `vdf:"data"`
+			}{},
+			expectedError: `error converting "x" to int: strconv.ParseInt: parsing "x": invalid syntax`,
+		},
 	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
 
-	var target WithChan
-	err := govdf.Unmarshal([]byte(`"data" { "key" "value" }`), &target)
-	require.Error(t, err)
-	require.Contains(t, err.Error(), "unsupported type")
+			// Act: Unmarshal the input into the target.
+			err := govdf.Unmarshal([]byte(tc.input), tc.target)
+
+			// Assert: The error should describe the key or value.
+			require.EqualError(t, err, tc.expectedError)
+		})
+	}
 }
 
-func TestDecode_IntOverflow(t *testing.T) {
+// rarity is an enum type that implements encoding.TextMarshaler and encoding.TextUnmarshaler for testing.
+type rarity int
+
+// rarityNames are the names of the rarity values.
+var rarityNames = []string{"common", "rare", "legendary"}
+
+// MarshalText implements the encoding.TextMarshaler interface for the rarity type.
+func (r rarity) MarshalText() ([]byte, error) {
+	if int(r) >= len(rarityNames) {
+		return nil, fmt.Errorf("unknown rarity %d", int(r))
+	}
+	return []byte(rarityNames[r]), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface for the rarity type.
+func (r *rarity) UnmarshalText(text []byte) error {
+	var i = slices.Index(rarityNames, string(text))
+	if i < 0 {
+		return fmt.Errorf("unknown rarity %q", text)
+	}
+	*r = rarity(i)
+	return nil
+}
+
+// textAndVDFUnmarshaler implements both UnmarshalVDF and UnmarshalText for testing precedence.
+type textAndVDFUnmarshaler string
+
+// UnmarshalVDF implements the Unmarshaler interface for the textAndVDFUnmarshaler type.
+func (u *textAndVDFUnmarshaler) UnmarshalVDF(node *govdf.Node) error {
+	*u = textAndVDFUnmarshaler("vdf:" + node.Value)
+	return nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface for the textAndVDFUnmarshaler type.
+func (u *textAndVDFUnmarshaler) UnmarshalText(text []byte) error {
+	*u = textAndVDFUnmarshaler("text:" + string(text))
+	return nil
+}
+
+func TestDecode_TextUnmarshaler(t *testing.T) {
 	t.Parallel()
 
-	type Small struct {
-		Val int8 `vdf:"val"`
+	type Item struct {
+		Rarity   rarity                `vdf:"rarity"`
+		Optional *rarity               `vdf:"optional"`
+		Server   netip.Addr            `vdf:"server"`
+		Price    *big.Int              `vdf:"price"`
+		Both     textAndVDFUnmarshaler `vdf:"both"`
+		ByRarity map[rarity]string     `vdf:"by_rarity"`
 	}
 
-	var target Small
-	err := govdf.Unmarshal([]byte(`"val" "999"`), &target)
-	require.Error(t, err)
-	require.Error(t, err)
+	// Arrange: Create an input with text values.
+	var input = `"rarity" "legendary" "optional" "rare" "server" "10.0.0.1" "price" "123456789012345678901234567890" "both" "x" "by_rarity" { "common" "a" "rare" "b" }`
+
+	// Act: Unmarshal the input.
+	var item Item
+	err := govdf.Unmarshal([]byte(input), &item)
+
+	// Assert: The text unmarshalers should be used, with Unmarshaler taking precedence.
+	require.NoError(t, err)
+	var price, _ = new(big.Int).SetString("123456789012345678901234567890", 10)
+	var rare = rarity(1)
+	require.Equal(t, rarity(2), item.Rarity)
+	require.Equal(t, &rare, item.Optional)
+	require.Equal(t, netip.MustParseAddr("10.0.0.1"), item.Server)
+	require.Zero(t, price.Cmp(item.Price))
+	require.Equal(t, textAndVDFUnmarshaler("vdf:x"), item.Both)
+	require.Equal(t, map[rarity]string{0: "a", 1: "b"}, item.ByRarity)
 }
 
-func TestDecode_UintOverflow(t *testing.T) {
+func TestDecode_TextUnmarshalerError(t *testing.T) {
 	t.Parallel()
 
-	type Small struct {
-		Val uint8 `vdf:"val"`
+	type Item struct {
+		Rarity rarity `vdf:"rarity"`
 	}
 
-	var target Small
-	err := govdf.Unmarshal([]byte(`"val" "999"`), &target)
-	require.Error(t, err)
-	require.Error(t, err)
+	var item Item
+	err := govdf.Unmarshal([]byte(`"rarity" "mythic"`), &item)
+
+	var typeErr *govdf.TypeError
+	require.ErrorAs(t, err, &typeErr)
+	require.EqualError(t, err, `error converting "mythic" to govdf_test.rarity: unknown rarity "mythic"`)
 }
 
-func TestDecode_FloatOverflow(t *testing.T) {
+func TestDecode_Generic(t *testing.T) {
 	t.Parallel()
 
-	type Small struct {
-		Val float32 `vdf:"val"`
+	var input = `"root" { "name" "test" "wave" "a.wav" "wave" "b.wav" "nested" { "x" "1" } }`
+
+	var testCases = map[string]struct {
+		target   func() any
+		expected any
+	}{
+		"any": {
+			target: func() any { return new(any) },
+			expected: func() *any {
+				var v any = map[string]any{
+					"root": map[string]any{
+						"name":   "test",
+						"wave":   "b.wav",
+						"nested": map[string]any{"x": "1"},
+					},
+				}
+				return &v
+			}(),
+		},
+		"map of any": {
+			target: func() any { return &map[string]any{} },
+			expected: &map[string]any{
+				"root": map[string]any{
+					"name":   "test",
+					"wave":   "b.wav",
+					"nested": map[string]any{"x": "1"},
+				},
+			},
+		},
+		"ordered map": {
+			target: func() any { return &govdf.OrderedMap{} },
+			expected: &govdf.OrderedMap{
+				{Key: "root", Value: govdf.OrderedMap{
+					{Key: "name", Value: "test"},
+					{Key: "wave", Value: "a.wav"},
+					{Key: "wave", Value: "b.wav"},
+					{Key: "nested", Value: govdf.OrderedMap{{Key: "x", Value: "1"}}},
+				}},
+			},
+		},
+		"struct fields": {
+			target: func() any {
+				return &struct {
+					Root struct {
+						Name   any            `vdf:"name"`
+						Nested map[string]any `vdf:"nested"`
+					} `vdf:"root"`
+				}{}
+			},
+			expected: &struct {
+				Root struct {
+					Name   any            `vdf:"name"`
+					Nested map[string]any `vdf:"nested"`
+				} `vdf:"root"`
+			}{Root: struct {
+				Name   any            `vdf:"name"`
+				Nested map[string]any `vdf:"nested"`
+			}{Name: "test", Nested: map[string]any{"x": "1"}}},
+		},
 	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
 
-	var target Small
-	err := govdf.Unmarshal([]byte(`"val" "1e+999"`), &target)
-	require.Error(t, err)
-	require.Error(t, err)
+			// Act: Unmarshal the input keeping every occurrence of repeated keys.
+			var target = tc.target()
+			err := govdf.Unmarshal([]byte(input), target, govdf.WithDuplicateKeys(govdf.DuplicateKeepAll))
+
+			// Assert: The target should hold the generic values.
+			require.NoError(t, err)
+			if diff := cmp.Diff(tc.expected, target); diff != "" {
+				t.Errorf("unexpected value (-want +got):\n%s", diff)
+			}
+		})
+	}
 }
 
-func TestDecode_CannotSetStructField(t *testing.T) {
+func TestDecode_Lists(t *testing.T) {
 	t.Parallel()
 
-	type Inner struct {
-		Val string `vdf:"val"`
+	type Solid struct {
+		ID int `vdf:"id"`
 	}
-	type Outer struct {
-		Inner Inner `vdf:"inner"`
+	type World struct {
+		Solids []Solid `vdf:"solid,list=repeated"`
+	}
+	type Map struct {
+		World World `vdf:"world"`
 	}
 
-	var target Outer
-	err := govdf.Unmarshal([]byte(`"inner" { "val" "test" }`), &target)
+	// Arrange: Create a VMF-like input with repeated blocks.
+	var input = `"world" { "solid" { "id" "1" } "solid" { "id" "2" } "solid" { "id" "3" } }`
+
+	// Act: Unmarshal the input keeping every occurrence of repeated keys.
+	var target Map
+	err := govdf.Unmarshal([]byte(input), &target, govdf.WithDuplicateKeys(govdf.DuplicateKeepAll))
 	require.NoError(t, err)
-	require.Equal(t, "test", target.Inner.Val)
+
+	// Assert: Every block should be decoded in order, and encode back the same way.
+	require.Equal(t, []Solid{{ID: 1}, {ID: 2}, {ID: 3}}, target.World.Solids)
+
+	output, err := govdf.Marshal(target)
+	require.NoError(t, err)
+
+	var roundtrip Map
+	require.NoError(t, govdf.Unmarshal(output, &roundtrip, govdf.WithDuplicateKeys(govdf.DuplicateKeepAll)))
+	require.Equal(t, target, roundtrip)
+}
+
+func TestDecode_ListErrors(t *testing.T) {
+	t.Parallel()
+
+	var testCases = map[string]struct {
+		input         string
+		target        any
+		expectedError string
+	}{
+		"gap": {
+			input: `"items" { "0" "a" "2" "c" }`,
+			target: &struct {
+				Items []string `vdf:"items"`
+			}{},
+			expectedError: `validation error: list key "2" out of sequence, expected "1"`,
+		},
+		"out of order": {
+			input: `"items" { "1" "a" "0" "b" }`,
+			target: &struct {
+				Items []string `vdf:"items"`
+			}{},
+			expectedError: `validation error: list key "1" out of sequence, expected "0"`,
+		},
+		"numbered from one": {
+			input: `"items" { "0" "a" }`,
+			target: &struct {
+				Items []string `vdf:"items,list=1"`
+			}{},
+			expectedError: `validation error: list key "0" out of sequence, expected "1"`,
+		},
+		"scalar": {
+			input: `"items" "a"`,
+			target: &struct {
+				Items []string `vdf:"items"`
+			}{},
+			expectedError: "validation error: unsupported type for scalar value: slice",
+		},
+		"repeated without keep all": {
+			input: `"rndwave" { "wave" "a.wav" "wave" "b.wav" "pitch" "100" }`,
+			target: &struct {
+				RandomWave struct {
+					Waves []string `vdf:"wave,list=repeated"`
+					Pitch int      `vdf:"pitch"`
+				} `vdf:"rndwave"`
+			}{},
+			expectedError: `validation error: list=repeated field "rndwave/wave" must be decoded with WithDuplicateKeys(DuplicateKeepAll)`,
+		},
+		"array too short": {
+			input: `"items" { "0" "a" "1" "b" "2" "c" }`,
+			target: &struct {
+				Items [2]string `vdf:"items"`
+			}{},
+			expectedError: "validation error: 3 elements do not fit in [2]string",
+		},
+		"invalid element": {
+			input: `"items" { "0" "x" }`,
+			target: &struct {
+				Items []int `vdf:"items"`
+			}{},
+			expectedError: `error converting "x" to int: strconv.ParseInt: parsing "x": invalid syntax`,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act: Unmarshal the input into the target.
+			err := govdf.Unmarshal([]byte(tc.input), tc.target)
+
+			// Assert: The error should describe the list.
+			require.EqualError(t, err, tc.expectedError)
+		})
+	}
+}
+
+func TestDecode_DisallowUnknownFields(t *testing.T) {
+	t.Parallel()
+
+	type Server struct {
+		Host  string            `vdf:"host"`
+		Ports []int             `vdf:"ports"`
+		Tags  map[string]string `vdf:"tags"`
+	}
+	type Config struct {
+		Name    string            `vdf:"name"`
+		Server  Server            `vdf:"server"`
+		Servers map[string]Server `vdf:"servers"`
+		Extra   any               `vdf:"extra"`
+	}
+
+	var testCases = map[string]struct {
+		input         string
+		expectedError string
+		expectedKey   govdf.Key
+		expectedLine  int
+	}{
+		"top level": {
+			input:         "\"name\" \"a\"\n\"nmae\" \"b\"",
+			expectedError: `line 2, column 1: unknown field "nmae"`,
+			expectedKey:   govdf.Key{"nmae"},
+			expectedLine:  2,
+		},
+		"nested": {
+			input:         "\"server\"\n{\n\t\"host\" \"localhost\"\n\t\"prot\" \"80\"\n}",
+			expectedError: `line 4, column 2: unknown field "server/prot"`,
+			expectedKey:   govdf.Key{"server", "prot"},
+			expectedLine:  4,
+		},
+		"map value": {
+			input:         `"servers" { "eu" { "host" "a" } "us" { "hots" "b" } }`,
+			expectedError: `line 1, column 40: unknown field "servers/us/hots"`,
+			expectedKey:   govdf.Key{"servers", "us", "hots"},
+			expectedLine:  1,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act: Unmarshal the input with unknown fields disallowed.
+			var config Config
+			err := govdf.Unmarshal([]byte(tc.input), &config, govdf.WithDisallowUnknownFields())
+
+			// Assert: The error should report the path and position of the unknown key.
+			require.EqualError(t, err, tc.expectedError)
+			var unknownErr *govdf.UnknownFieldError
+			require.ErrorAs(t, err, &unknownErr)
+			require.Equal(t, tc.expectedKey, unknownErr.Key)
+			require.Equal(t, tc.expectedLine, unknownErr.Line)
+		})
+	}
+
+	t.Run("known fields", func(t *testing.T) {
+		t.Parallel()
+
+		// Arrange: Create an input whose keys all have a field, including maps, lists and generic values.
+		var input = `"NAME" "a" "server" { "ports" { "0" "80" } "tags" { "any" "key" } } "extra" { "any" "key" }`
+
+		// Act: Unmarshal the input with unknown fields disallowed.
+		var config Config
+		err := govdf.Unmarshal([]byte(input), &config, govdf.WithDisallowUnknownFields())
+
+		// Assert: Keys decoded into maps and generic values should be accepted.
+		require.NoError(t, err)
+		require.Equal(t, "a", config.Name)
+		require.Equal(t, []int{80}, config.Server.Ports)
+	})
+}
+
+func TestDecode_Metadata(t *testing.T) {
+	t.Parallel()
+
+	type Server struct {
+		Host string `vdf:"host"`
+		Port int    `vdf:"port"`
+	}
+	type Config struct {
+		Name    string   `vdf:"name"`
+		Debug   bool     `vdf:"debug"`
+		Server  Server   `vdf:"server"`
+		Servers []Server `vdf:"servers"`
+		Backup  *Server  `vdf:"backup"`
+	}
+
+	// Arrange: Create an input with misspelt keys and missing settings.
+	var input = `"server" { "host" "a" "prot" "80" } "nmae" { "x" "y" } "servers" { "0" { "port" "1" } "1" { "host" "b" "extra" "c" } } "debug" "1"`
+
+	// Act: Unmarshal the input recording the metadata.
+	var config Config
+	var md = govdf.Metadata{Undecoded: []govdf.Key{{"stale"}}}
+	err := govdf.Unmarshal([]byte(input), &config, govdf.WithMetadata(&md))
+	require.NoError(t, err)
+
+	// Assert: The unknown keys should be listed in source order, and the unset fields in declaration order.
+	var expected = govdf.Metadata{
+		Undecoded: []govdf.Key{{"server", "prot"}, {"nmae"}, {"servers", "1", "extra"}},
+		Unset:     []govdf.Key{{"server", "port"}, {"servers", "0", "host"}, {"servers", "1", "port"}, {"name"}, {"backup"}},
+	}
+	if diff := cmp.Diff(expected, md); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	require.Equal(t, "servers/1/extra", md.Undecoded[2].String())
+}
+
+func TestDecode_RequiredAndDefault(t *testing.T) {
+	t.Parallel()
+
+	type Server struct {
+		Host    string   `vdf:"host,required"`
+		Port    int      `vdf:"port,default=27015"`
+		Timeout *float64 `vdf:"timeout,default=1.5"`
+		Level   level    `vdf:"level,default=3"`
+	}
+	type Rates struct {
+		Tick int `vdf:"tick,default=64"`
+	}
+	type Config struct {
+		Name    string            `vdf:"name,default=server"`
+		Server  Server            `vdf:"server"`
+		Backup  *Server           `vdf:"backup"`
+		Servers map[string]Server `vdf:"servers"`
+		Rarity  rarity            `vdf:"rarity,default=rare"`
+		Rates   Rates             `vdf:"rates"`
+	}
+
+	var timeout = 1.5
+
+	var testCases = map[string]struct {
+		input    string
+		expected Config
+	}{
+		"defaults": {
+			input: `"server" { "host" "a" }`,
+			expected: Config{
+				Name:   "server",
+				Server: Server{Host: "a", Port: 27015, Timeout: &timeout, Level: 3},
+				Rarity: 1,
+				Rates:  Rates{Tick: 64},
+			},
+		},
+		"values": {
+			input: `"name" "b" "server" { "host" "a" "port" "80" "timeout" "1.5" "level" "1" } "rarity" "legendary" "rates" { "tick" "128" }`,
+			expected: Config{
+				Name:   "b",
+				Server: Server{Host: "a", Port: 80, Timeout: &timeout, Level: 1},
+				Rarity: 2,
+				Rates:  Rates{Tick: 128},
+			},
+		},
+		"absent struct": {
+			input: `"name" "b" "server" { "host" "a" }`,
+			expected: Config{
+				Name:   "b",
+				Server: Server{Host: "a", Port: 27015, Timeout: &timeout, Level: 3},
+				Rarity: 1,
+				Rates:  Rates{Tick: 64},
+			},
+		},
+		"pointer and map": {
+			input: `"server" { "host" "a" } "backup" { "host" "b" "port" "1" } "servers" { "eu" { "host" "c" } }`,
+			expected: Config{
+				Name:    "server",
+				Server:  Server{Host: "a", Port: 27015, Timeout: &timeout, Level: 3},
+				Backup:  &Server{Host: "b", Port: 1, Timeout: &timeout, Level: 3},
+				Servers: map[string]Server{"eu": {Host: "c", Port: 27015, Timeout: &timeout, Level: 3}},
+				Rarity:  1,
+				Rates:   Rates{Tick: 64},
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act: Unmarshal the input.
+			var config Config
+			err := govdf.Unmarshal([]byte(tc.input), &config)
+
+			// Assert: Absent keys should be filled in from their defaults.
+			require.NoError(t, err)
+			if diff := cmp.Diff(tc.expected, config); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("existing value", func(t *testing.T) {
+		t.Parallel()
+
+		// Act: Unmarshal into a struct that already holds a value.
+		var config = Config{Name: "kept"}
+		err := govdf.Unmarshal([]byte(`"server" { "host" "a" }`), &config)
+
+		// Assert: The default should not replace the value.
+		require.NoError(t, err)
+		require.Equal(t, "kept", config.Name)
+	})
+}
+
+func TestDecode_RequiredAndDefaultErrors(t *testing.T) {
+	t.Parallel()
+
+	type Server struct {
+		Host string `vdf:"host,required"`
+		Port int    `vdf:"port,default=27015"`
+	}
+
+	var testCases = map[string]struct {
+		input         string
+		target        any
+		expectedError string
+	}{
+		"missing top level": {
+			input: `"port" "1"`,
+			target: &struct {
+				Host string `vdf:"host,required"`
+			}{},
+			expectedError: `missing required field "host"`,
+		},
+		"missing nested": {
+			input: `"server" { "port" "1" }`,
+			target: &struct {
+				Server Server `vdf:"server"`
+			}{},
+			expectedError: `missing required field "server/host"`,
+		},
+		"missing block": {
+			input: `"name" "a"`,
+			target: &struct {
+				Name   string `vdf:"name"`
+				Server Server `vdf:"server"`
+			}{},
+			expectedError: `missing required field "server/host"`,
+		},
+		"missing block in missing block": {
+			input: `"name" "a"`,
+			target: &struct {
+				Name  string `vdf:"name"`
+				Outer struct {
+					Server Server `vdf:"server"`
+				} `vdf:"outer"`
+			}{},
+			expectedError: `missing required field "outer/server/host"`,
+		},
+		"missing in pointer": {
+			input: `"backup" { }`,
+			target: &struct {
+				Backup *Server `vdf:"backup"`
+			}{},
+			expectedError: `missing required field "backup/host"`,
+		},
+		"missing in map": {
+			input: `"servers" { "eu" { "host" "a" } "us" { } }`,
+			target: &struct {
+				Servers map[string]Server `vdf:"servers"`
+			}{},
+			expectedError: `missing required field "servers/us/host"`,
+		},
+		"missing required struct": {
+			input: `"name" "a"`,
+			target: &struct {
+				Name   string  `vdf:"name"`
+				Server *Server `vdf:"server,required"`
+			}{},
+			expectedError: `missing required field "server"`,
+		},
+		"invalid default": {
+			input: `"host" "a"`,
+			target: &struct {
+				Host string `vdf:"host"`
+				Port int    `vdf:"port,default=http"`
+			}{},
+			expectedError: `invalid default value for field "port": error converting "http" to int: strconv.ParseInt: parsing "http": invalid syntax`,
+		},
+		"invalid default with key": {
+			input: `"host" "a" "port" "27015"`,
+			target: &struct {
+				Host string `vdf:"host"`
+				Port int    `vdf:"port,default=http"`
+			}{},
+			expectedError: `invalid default value for field "port": error converting "http" to int: strconv.ParseInt: parsing "http": invalid syntax`,
+		},
+		"default on slice": {
+			input: `"ports" { "0" "1" }`,
+			target: &struct {
+				Ports []int `vdf:"ports,default=1"`
+			}{},
+			expectedError: `validation error: field "ports" of type []int cannot have a default value`,
+		},
+		"default in nested struct": {
+			input: `"name" "a"`,
+			target: &struct {
+				Name   string `vdf:"name"`
+				Server struct {
+					Tags map[string]string `vdf:"tags,default=none"`
+				} `vdf:"server"`
+			}{},
+			expectedError: `validation error: field "tags" of type map[string]string cannot have a default value`,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act: Unmarshal the input into the target.
+			err := govdf.Unmarshal([]byte(tc.input), tc.target)
+
+			// Assert: The error should describe the field.
+			require.EqualError(t, err, tc.expectedError)
+		})
+	}
+
+	t.Run("error type", func(t *testing.T) {
+		t.Parallel()
+
+		// Act: Unmarshal an input without a required key.
+		var target struct {
+			Server Server `vdf:"server"`
+		}
+		err := govdf.Unmarshal([]byte(`"server" { }`), &target)
+
+		// Assert: The error should hold the path of the missing key.
+		var missingErr *govdf.MissingFieldError
+		require.ErrorAs(t, err, &missingErr)
+		require.Equal(t, govdf.Key{"server", "host"}, missingErr.Key)
+	})
+}
+
+func TestDecode_Embedded(t *testing.T) {
+	t.Parallel()
+
+	type BaseItem struct {
+		Name   string `vdf:"name"`
+		Rarity string `vdf:"rarity,default=common"`
+	}
+	type Stats struct {
+		Damage int `vdf:"damage"`
+	}
+	type Sounds struct {
+		Fire string `vdf:"fire_sound"`
+	}
+	type base struct {
+		ID int `vdf:"id"`
+	}
+	type Weapon struct {
+		BaseItem
+		*Stats
+		base
+		Sounds Sounds   `vdf:",inline"`
+		Rarity string   `vdf:"rarity"`
+		Nested BaseItem `vdf:"nested"`
+	}
+
+	// Arrange: Create an input with the fields of the embedded structs in the weapon's own block.
+	var input = `"name" "ak47" "rarity" "rare" "damage" "36" "id" "7" "fire_sound" "ak.wav" "nested" { "name" "inner" }`
+
+	// Act: Unmarshal the input.
+	var weapon Weapon
+	err := govdf.Unmarshal([]byte(input), &weapon, govdf.WithDisallowUnknownFields())
+
+	// Assert: Promoted fields should be decoded, with the shallowest field winning a name and hiding the others.
+	require.NoError(t, err)
+	var expected = Weapon{
+		BaseItem: BaseItem{Name: "ak47"},
+		Stats:    &Stats{Damage: 36},
+		base:     base{ID: 7},
+		Sounds:   Sounds{Fire: "ak.wav"},
+		Rarity:   "rare",
+		Nested:   BaseItem{Name: "inner", Rarity: "common"},
+	}
+	if diff := cmp.Diff(expected, weapon, cmp.AllowUnexported(Weapon{})); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDecode_EmbeddedConflicts(t *testing.T) {
+	t.Parallel()
+
+	type A struct {
+		Name  string `vdf:"name"`
+		Value string
+	}
+	type B struct {
+		Name  string `vdf:"name"`
+		Value string `vdf:"value"`
+	}
+	type C struct {
+		Name string `vdf:"name"`
+	}
+	type Ambiguous struct {
+		A
+		B
+	}
+	type Deeper struct {
+		Ambiguous
+		C
+	}
+
+	var input = `"name" "n" "value" "v"`
+
+	t.Run("same depth", func(t *testing.T) {
+		t.Parallel()
+
+		// Act: Unmarshal into a struct embedding two structs with the same field names.
+		var target Ambiguous
+		var md govdf.Metadata
+		err := govdf.Unmarshal([]byte(input), &target, govdf.WithMetadata(&md))
+
+		// Assert: The untagged field should lose to the tagged one, and the ambiguous fields should be dropped.
+		require.NoError(t, err)
+		require.Equal(t, Ambiguous{B: B{Value: "v"}}, target)
+		require.Equal(t, []govdf.Key{{"name"}}, md.Undecoded)
+	})
+
+	t.Run("shallower", func(t *testing.T) {
+		t.Parallel()
+
+		// Act: Unmarshal into a struct where one of the fields is shallower.
+		var target Deeper
+		err := govdf.Unmarshal([]byte(input), &target)
+
+		// Assert: The shallower field should win.
+		require.NoError(t, err)
+		require.Equal(t, Deeper{Ambiguous: Ambiguous{B: B{Value: "v"}}, C: C{Name: "n"}}, target)
+	})
+}
+
+func TestDecode_UnsupportedMapValueType(t *testing.T) {
+	t.Parallel()
+
+	type WithChan struct {
+		Data chan int `vdf:"data"`
+	}
+
+	var target WithChan
+	err := govdf.Unmarshal([]byte(`"data" { "key" "value" }`), &target)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unsupported type")
+}
+
+func TestDecode_IntOverflow(t *testing.T) {
+	t.Parallel()
+
+	type Small struct {
+		Val int8 `vdf:"val"`
+	}
+
+	var target Small
+	err := govdf.Unmarshal([]byte(`"val" "999"`), &target)
+	require.Error(t, err)
+	require.Error(t, err)
+}
+
+func TestDecode_UintOverflow(t *testing.T) {
+	t.Parallel()
+
+	type Small struct {
+		Val uint8 `vdf:"val"`
+	}
+
+	var target Small
+	err := govdf.Unmarshal([]byte(`"val" "999"`), &target)
+	require.Error(t, err)
+	require.Error(t, err)
+}
+
+func TestDecode_FloatOverflow(t *testing.T) {
+	t.Parallel()
+
+	type Small struct {
+		Val float32 `vdf:"val"`
+	}
+
+	var target Small
+	err := govdf.Unmarshal([]byte(`"val" "1e+999"`), &target)
+	require.Error(t, err)
+	require.Error(t, err)
+}
+
+func TestDecode_CannotSetStructField(t *testing.T) {
+	t.Parallel()
+
+	type Inner struct {
+		Val string `vdf:"val"`
+	}
+	type Outer struct {
+		Inner Inner `vdf:"inner"`
+	}
+
+	var target Outer
+	err := govdf.Unmarshal([]byte(`"inner" { "val" "test" }`), &target)
+	require.NoError(t, err)
+	require.Equal(t, "test", target.Inner.Val)
+}
+
+func TestDecode_EscapeSequences(t *testing.T) {
+	t.Parallel()
+
+	var testCases = map[string]struct {
+		input    string
+		options  []govdf.Option
+		expected map[string]string
+	}{
+		"escapes are kept verbatim by default": {
+			input:    `"a\tb" "c\nd\\"`,
+			expected: map[string]string{`a\tb`: `c\nd\\`},
+		},
+		"escaped quote in value is unescaped by default": {
+			input:    `"a" "say \"hi\""`,
+			expected: map[string]string{"a": `say "hi"`},
+		},
+		"escapes in keys and values": {
+			input:    `"a\tb" "c\nd\\"`,
+			options:  []govdf.Option{govdf.WithEscapeSequences()},
+			expected: map[string]string{"a\tb": "c\nd\\"},
+		},
+		"escaped quotes in keys and values": {
+			input:    `"say \"hi\"" "\"quoted\""`,
+			options:  []govdf.Option{govdf.WithEscapeSequences()},
+			expected: map[string]string{`say "hi"`: `"quoted"`},
+		},
+		"trailing escaped backslash": {
+			input:    `"path" "C:\\dir\\" "next" "1"`,
+			options:  []govdf.Option{govdf.WithEscapeSequences()},
+			expected: map[string]string{"path": `C:\dir\`, "next": "1"},
+		},
+		"unknown escapes are kept": {
+			input:    `"a" "\x\r"`,
+			options:  []govdf.Option{govdf.WithEscapeSequences()},
+			expected: map[string]string{"a": `\x\r`},
+		},
+		"unquoted strings are not unescaped": {
+			input:    `a\n b\t`,
+			options:  []govdf.Option{govdf.WithEscapeSequences()},
+			expected: map[string]string{`a\n`: `b\t`},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act: Unmarshal the input with the given options.
+			var node govdf.Node
+			require.NoError(t, govdf.Unmarshal([]byte(tc.input), &node, tc.options...))
+
+			// Assert: The keys and values should be decoded as expected.
+			var actual = make(map[string]string)
+			for key, child := range node.Children {
+				actual[key] = child.Value
+			}
+			require.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestDecode_DuplicateKeys(t *testing.T) {
+	t.Parallel()
+
+	var input = `"rndwave" {
+    "wave" "a.wav"
+    "wave" "b.wav"
+    "group" { "x" "1" }
+    "group" { "y" "2" }
+    "wave" "c.wav"
+}`
+
+	var testCases = map[string]struct {
+		policy govdf.DuplicatePolicy
+		waves  []string
+		groups []map[string]string
+	}{
+		"merge by default": {
+			policy: govdf.DuplicateMerge,
+			waves:  []string{"c.wav"},
+			groups: []map[string]string{{"x": "1", "y": "2"}},
+		},
+		"keep all": {
+			policy: govdf.DuplicateKeepAll,
+			waves:  []string{"a.wav", "b.wav", "c.wav"},
+			groups: []map[string]string{{"x": "1"}, {"y": "2"}},
+		},
+		"first wins": {
+			policy: govdf.DuplicateFirstWins,
+			waves:  []string{"a.wav"},
+			groups: []map[string]string{{"x": "1"}},
+		},
+		"last wins": {
+			policy: govdf.DuplicateLastWins,
+			waves:  []string{"c.wav"},
+			groups: []map[string]string{{"y": "2"}},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act: Unmarshal the input with the duplicate policy.
+			var node govdf.Node
+			require.NoError(t, govdf.Unmarshal([]byte(input), &node, govdf.WithDuplicateKeys(tc.policy)))
+
+			// Assert: The kept occurrences should match the policy.
+			var rndwave = node.Children["rndwave"]
+			var waves []string
+			for _, wave := range rndwave.All("wave") {
+				waves = append(waves, wave.Value)
+			}
+			require.Equal(t, tc.waves, waves)
+
+			var groups []map[string]string
+			for _, group := range rndwave.All("group") {
+				var values = make(map[string]string)
+				for key, child := range group.Children {
+					values[key] = child.Value
+				}
+				groups = append(groups, values)
+			}
+			require.Equal(t, tc.groups, groups)
+		})
+	}
+}
+
+func TestDecode_DuplicateKeysTargets(t *testing.T) {
+	t.Parallel()
+
+	type Sound struct {
+		Wave   string            `vdf:"wave"`
+		Volume map[string]string `vdf:"volume"`
+	}
+
+	// Arrange: Create an input with repeated scalars and maps, keeping every occurrence.
+	var input = `"wave" "a.wav" "volume" { "min" "1" } "wave" "b.wav" "volume" { "max" "2" }`
+	var keepAll = govdf.WithDuplicateKeys(govdf.DuplicateKeepAll)
+
+	// Act: Decode the input into a struct, a map and a generic value.
+	var sound Sound
+	require.NoError(t, govdf.Unmarshal([]byte(input), &sound, keepAll))
+	var m map[string]any
+	require.NoError(t, govdf.Unmarshal([]byte(input), &m, keepAll))
+	var generic any
+	require.NoError(t, govdf.Unmarshal([]byte(input), &generic, keepAll))
+
+	// Assert: Every target should get the last occurrence of each key.
+	require.Equal(t, Sound{Wave: "b.wav", Volume: map[string]string{"max": "2"}}, sound)
+	var expected = map[string]any{"wave": "b.wav", "volume": map[string]any{"max": "2"}}
+	require.Equal(t, expected, m)
+	require.Equal(t, expected, generic)
+}
+
+func TestDecode_DuplicateKeysError(t *testing.T) {
+	t.Parallel()
+
+	var testCases = map[string]struct {
+		input  string
+		line   int
+		column int
+	}{
+		"duplicate scalar": {
+			input:  "\"a\" \"1\"\n\"a\" \"2\"",
+			line:   2,
+			column: 1,
+		},
+		"duplicate map": {
+			input:  "\"root\" {\n    \"solid\" { }\n    \"solid\" { }\n}",
+			line:   3,
+			column: 5,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act: Unmarshal the input with duplicates disallowed.
+			var node govdf.Node
+			err := govdf.Unmarshal([]byte(tc.input), &node, govdf.WithDuplicateKeys(govdf.DuplicateError))
+
+			// Assert: The error should point at the repeated key.
+			var parseErr *govdf.ParseError
+			require.ErrorAs(t, err, &parseErr)
+			require.Contains(t, parseErr.Message, "duplicate key")
+			require.Equal(t, tc.line, parseErr.Line)
+			require.Equal(t, tc.column, parseErr.Column)
+		})
+	}
+}
+
+func TestDecode_KeyOrder(t *testing.T) {
+	t.Parallel()
+
+	var testCases = map[string]struct {
+		input   string
+		options []govdf.Option
+		keys    []string
+	}{
+		"source order": {
+			input: `"zeta" "1" "alpha" { } "mid" "3"`,
+			keys:  []string{"zeta", "alpha", "mid"},
+		},
+		"merged duplicates keep their first position": {
+			input: `"b" "1" "a" "2" "b" "3"`,
+			keys:  []string{"b", "a"},
+		},
+		"kept duplicates are listed once per occurrence": {
+			input:   `"b" "1" "a" "2" "b" "3"`,
+			options: []govdf.Option{govdf.WithDuplicateKeys(govdf.DuplicateKeepAll)},
+			keys:    []string{"b", "a", "b"},
+		},
+		"excluded conditionals are not listed": {
+			input:   `"b" "1" [$X360] "a" "2"`,
+			options: []govdf.Option{govdf.WithConditions("$WIN32")},
+			keys:    []string{"a"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act: Unmarshal the input.
+			var node govdf.Node
+			require.NoError(t, govdf.Unmarshal([]byte(tc.input), &node, tc.options...))
+
+			// Assert: The keys should be recorded in source order.
+			require.Equal(t, tc.keys, node.Keys)
+		})
+	}
+}
+
+func TestDecode_MultipleDocuments(t *testing.T) {
+	t.Parallel()
+
+	type document struct {
+		Key         string
+		Value       string
+		LineComment string
+		Line        int
+		Offset      int64
+	}
+
+	var testCases = map[string]struct {
+		input    string
+		options  []govdf.Option
+		expected []document
+	}{
+		"empty stream": {
+			input: "",
+		},
+		"only comments": {
+			input: "// nothing here\n",
+		},
+		"single document": {
+			input: `"a" { "b" "c" }`,
+			expected: []document{
+				{Key: "a", Line: 1, Offset: 15},
+			},
+		},
+		"concatenated maps": {
+			input: "\"570\"\n{\n\t\"name\" \"Dota 2\"\n}\n\"730\"\n{\n\t\"name\" \"Counter-Strike 2\"\n}\n",
+			expected: []document{
+				{Key: "570", Line: 2, Offset: 26},
+				{Key: "730", Line: 6, Offset: 63},
+			},
+		},
+		"scalars with trailing conditional and comment": {
+			input: "\"a\" \"1\" [$WIN32] // first\n\"b\" \"2\"",
+			expected: []document{
+				{Key: "a", Value: "1", LineComment: "first", Line: 1, Offset: 16},
+				{Key: "b", Value: "2", Line: 2, Offset: 33},
+			},
+		},
+		"excluded entries are skipped": {
+			input:   `"a" "1" [$X360] "b" "2" "c" "3" [$X360]`,
+			options: []govdf.Option{govdf.WithConditions("$WIN32")},
+			expected: []document{
+				{Key: "b", Value: "2", Line: 1, Offset: 23},
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Arrange: Create a decoder for the stream.
+			var decoder = govdf.NewDecoder(strings.NewReader(tc.input), tc.options...)
+
+			// Act: Decode documents until the stream is exhausted.
+			var nodes []*govdf.Node
+			var documents []document
+			for {
+				var node govdf.Node
+				err := decoder.Decode(&node)
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				require.NoError(t, err)
+				require.Len(t, node.Keys, 1)
+
+				nodes = append(nodes, node.Children[node.Keys[0]])
+				documents = append(documents, document{Key: node.Keys[0], Offset: decoder.InputOffset()})
+			}
+
+			// A comment on the last line of a document is attached by the next call to Decode
+			for i, child := range nodes {
+				documents[i].Value, documents[i].LineComment, documents[i].Line = child.Value, child.LineComment, child.Line
+			}
+
+			// Assert: Each top-level entry should be decoded as its own document.
+			if diff := cmp.Diff(tc.expected, documents); diff != "" {
+				t.Errorf("Decode() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDecode_MultipleDocumentsPipe(t *testing.T) {
+	t.Parallel()
+
+	var testCases = map[string]struct {
+		first  string
+		second string
+	}{
+		"map":                      {first: "\"a\" { \"b\" \"c\" }", second: "\n\"d\" \"e\"\n"},
+		"scalar":                   {first: "\"a\" \"b\"", second: "\n\"d\" \"e\"\n"},
+		"scalar with conditional":  {first: "\"a\" \"b\" [$WIN32]", second: " // comment\n\"d\" \"e\"\n"},
+		"map with trailing spaces": {first: "\"a\" { }  ", second: "// comment\n\"d\" \"e\"\n"},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Arrange: Create a decoder for a stream that only holds the first document so far.
+			var reader, writer = io.Pipe()
+			var decoder = govdf.NewDecoder(reader)
+			go func() {
+				_, _ = writer.Write([]byte(tc.first))
+			}()
+
+			// Act: Decode the first document.
+			var first govdf.Node
+			var done = make(chan error)
+			go func() {
+				done <- decoder.Decode(&first)
+			}()
+
+			// Assert: Decode should return without waiting for the rest of the stream.
+			select {
+			case err := <-done:
+				require.NoError(t, err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("Decode did not return before the next document was written")
+			}
+			require.Equal(t, []string{"a"}, first.Keys)
+
+			// Act: Write and decode the rest of the stream.
+			go func() {
+				_, _ = writer.Write([]byte(tc.second))
+				_ = writer.Close()
+			}()
+			var second govdf.Node
+			require.NoError(t, decoder.Decode(&second))
+
+			// Assert: The second document should be decoded, and the stream exhausted.
+			require.Equal(t, "e", second.Children["d"].Value)
+			require.ErrorIs(t, decoder.Decode(&second), io.EOF)
+		})
+	}
+}
+
+func TestDecode_MultipleDocumentsErrors(t *testing.T) {
+	t.Parallel()
+
+	// Arrange: Create a decoder for a stream whose second document is cut short.
+	var decoder = govdf.NewDecoder(strings.NewReader("\"a\" \"1\"\n\"b\" \"2"))
+
+	// Act: Decode both documents.
+	var first govdf.Node
+	require.NoError(t, decoder.Decode(&first))
+
+	var second govdf.Node
+	err := decoder.Decode(&second)
+
+	// Assert: The truncated document should not look like the end of the stream.
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	var posErr *govdf.PositionError
+	require.ErrorAs(t, err, &posErr)
+	require.Equal(t, 2, posErr.Line)
+}
+
+func TestDecode_Comments(t *testing.T) {
+	t.Parallel()
+
+	var input = strings.Join([]string{
+		`/* File header */`,
+		`"root" { // opening`,
+		`	// head`,
+		`	"a" "1" /* line */`,
+		`	"empty"`,
+		`	{`,
+		`		// nothing here`,
+		`	} // end of empty`,
+		`	/* multi`,
+		`	   line */`,
+		`	"b" "2"`,
+		`	// after the last child`,
+		`}`,
+		`// end of file`,
+	}, "\n")
+
+	// Act: Unmarshal the input.
+	var node govdf.Node
+	require.NoError(t, govdf.Unmarshal([]byte(input), &node))
+
+	// Assert: Every comment should be attached to the tree.
+	var root = node.Children["root"]
+	require.Equal(t, "File header", root.HeadComment)
+	require.Equal(t, "opening", root.LineComment)
+	require.Equal(t, "after the last child", root.FootComment)
+	require.Equal(t, "head", root.Children["a"].HeadComment)
+	require.Equal(t, "line", root.Children["a"].LineComment)
+	require.Equal(t, "nothing here", root.Children["empty"].FootComment)
+	require.Equal(t, "end of empty", root.Children["empty"].EndComment)
+	require.Equal(t, "multi\n\t   line", root.Children["b"].HeadComment)
+	require.Equal(t, "end of file", node.FootComment)
+}
+
+func TestDecode_BlockCommentErrors(t *testing.T) {
+	t.Parallel()
+
+	// Act: Unmarshal a block comment that is never closed.
+	var node govdf.Node
+	err := govdf.Unmarshal([]byte(`"a" "b" /* unterminated`), &node)
+
+	// Assert: The end of the input should be unexpected.
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestDecode_Recovery(t *testing.T) {
+	t.Parallel()
+
+	type diagnostic struct {
+		Severity  govdf.Severity
+		Message   string
+		Line      int
+		Column    int
+		EndLine   int
+		EndColumn int
+	}
+
+	var testCases = map[string]struct {
+		input       string
+		expected    []diagnostic
+		expectedVDF string
+	}{
+		"stray closing brace": {
+			input: "\"a\" \"1\"\n}\n\"b\" \"2\"",
+			expected: []diagnostic{
+				{Message: "unexpected '}' at root level", Line: 2, Column: 1, EndLine: 2, EndColumn: 2},
+			},
+			expectedVDF: "\"a\" \"1\"\n\"b\" \"2\"\n",
+		},
+		"unexpected character": {
+			input: "\"a\" \x01 \"1\"\n\"b\" \"2\"",
+			expected: []diagnostic{
+				{Message: "unexpected character", Line: 1, Column: 5, EndLine: 1, EndColumn: 6},
+			},
+			expectedVDF: "\"a\" \"1\"\n\"b\" \"2\"\n",
+		},
+		"invalid rune": {
+			input: "\"a\" \"b\xffc\"",
+			expected: []diagnostic{
+				{Message: "invalid rune", Line: 1, Column: 7, EndLine: 1, EndColumn: 8},
+			},
+			expectedVDF: "\"a\" \"b\uFFFDc\"\n",
+		},
+		"dangling key": {
+			input: "\"root\" {\n\t\"a\" \"1\"\n\t\"b\"\n}\n\"c\" \"3\"",
+			expected: []diagnostic{
+				{Message: "expected value after key", Line: 3, Column: 2, EndLine: 3, EndColumn: 5},
+			},
+			expectedVDF: "\"root\" {\n    \"a\" \"1\"\n}\n\"c\" \"3\"\n",
+		},
+		"unterminated string": {
+			input: "\"root\" {\n\t\"a\" \"1\"\n\t\"b\" \"2\n}",
+			expected: []diagnostic{
+				{Message: "unterminated string", Line: 3, Column: 6, EndLine: 3, EndColumn: 8},
+			},
+			expectedVDF: "\"root\" {\n    \"a\" \"1\"\n    \"b\" \"2\"\n}\n",
+		},
+		"unclosed map": {
+			input: "\"root\"\n{\n\t\"a\" \"1\"\n",
+			expected: []diagnostic{
+				{Severity: govdf.SeverityWarning, Message: "unclosed '{'", Line: 2, Column: 1, EndLine: 2, EndColumn: 2},
+			},
+			expectedVDF: "\"root\" {\n    \"a\" \"1\"\n}\n",
+		},
+		"map without key": {
+			input: "\"c\" \"d\" { \"e\" \"f\" }\n\"g\" \"h\"",
+			expected: []diagnostic{
+				{Message: "unexpected '{'", Line: 1, Column: 9, EndLine: 1, EndColumn: 10},
+			},
+			expectedVDF: "\"c\" \"d\"\n\"g\" \"h\"\n",
+		},
+		"several problems": {
+			input: "}\n\"a\" \"1\" [$WIN32] [$X360]\n\"b\" \x02\"2\"\n\"c\"",
+			expected: []diagnostic{
+				{Message: "unexpected '}' at root level", Line: 1, Column: 1, EndLine: 1, EndColumn: 2},
+				{Message: "unexpected conditional", Line: 2, Column: 18, EndLine: 2, EndColumn: 25},
+				{Message: "unexpected character", Line: 3, Column: 5, EndLine: 3, EndColumn: 6},
+				{Message: "expected value after key", Line: 4, Column: 1, EndLine: 4, EndColumn: 4},
+			},
+			expectedVDF: "\"a\" \"1\" [$WIN32]\n\"b\" \"2\"\n",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act: Unmarshal the input, recovering from errors.
+			var node govdf.Node
+			err := govdf.Unmarshal([]byte(tc.input), &node, govdf.WithRecovery())
+
+			// Assert: Every problem should be reported.
+			var list govdf.ErrorList
+			require.ErrorAs(t, err, &list)
+
+			var diagnostics []diagnostic
+			for _, d := range list {
+				diagnostics = append(diagnostics, diagnostic{
+					Severity:  d.Severity,
+					Message:   d.Message,
+					Line:      d.Line,
+					Column:    d.Column,
+					EndLine:   d.EndLine,
+					EndColumn: d.EndColumn,
+				})
+			}
+			if diff := cmp.Diff(tc.expected, diagnostics); diff != "" {
+				t.Errorf("diagnostics mismatch (-want +got):\n%s", diff)
+			}
+
+			// Assert: The rest of the document should still be decoded.
+			result, err := govdf.Marshal(&node)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedVDF, string(result))
+		})
+	}
+}
+
+func TestDecode_RecoveryWithoutErrors(t *testing.T) {
+	t.Parallel()
+
+	// Act: Unmarshal valid input, recovering from errors.
+	var node govdf.Node
+	err := govdf.Unmarshal([]byte(`"a" { "b" "c" }`), &node, govdf.WithRecovery())
+
+	// Assert: There should be no diagnostics.
+	require.NoError(t, err)
+	require.Equal(t, "c", node.Children["a"].Children["b"].Value)
+}
+
+func TestDecode_Limits(t *testing.T) {
+	t.Parallel()
+
+	var testCases = map[string]struct {
+		input    string
+		limits   govdf.Limits
+		options  []govdf.Option
+		expected *govdf.LimitError
+	}{
+		"within limits": {
+			input:  `"a" { "b" "c" }`,
+			limits: govdf.Limits{MaxDepth: 1, MaxKeyLength: 1, MaxValueLength: 1, MaxNodes: 2, MaxInputBytes: 15},
+		},
+		"max depth": {
+			input:    `"a" { "b" { "c" { } } }`,
+			limits:   govdf.Limits{MaxDepth: 2},
+			expected: &govdf.LimitError{Limit: "MaxDepth", Max: 2, Line: 1, Column: 17, Offset: 16},
+		},
+		"max depth while recovering": {
+			input:    `"a" { "b" { "c" { } } }`,
+			limits:   govdf.Limits{MaxDepth: 2},
+			options:  []govdf.Option{govdf.WithRecovery()},
+			expected: &govdf.LimitError{Limit: "MaxDepth", Max: 2, Line: 1, Column: 17, Offset: 16},
+		},
+		"max key length": {
+			input:    `"abcd" "x"`,
+			limits:   govdf.Limits{MaxKeyLength: 3},
+			expected: &govdf.LimitError{Limit: "MaxKeyLength", Max: 3, Line: 1, Column: 6, Offset: 5},
+		},
+		"max key length unquoted": {
+			input:    `abcd x`,
+			limits:   govdf.Limits{MaxKeyLength: 3},
+			expected: &govdf.LimitError{Limit: "MaxKeyLength", Max: 3, Line: 1, Column: 5, Offset: 4},
+		},
+		"max value length": {
+			input:    `"a" "abcd"`,
+			limits:   govdf.Limits{MaxValueLength: 3},
+			expected: &govdf.LimitError{Limit: "MaxValueLength", Max: 3, Line: 1, Column: 10, Offset: 9},
+		},
+		"max nodes": {
+			input:    `"a" { "b" "1" "c" "2" }`,
+			limits:   govdf.Limits{MaxNodes: 2},
+			expected: &govdf.LimitError{Limit: "MaxNodes", Max: 2, Line: 1, Column: 19, Offset: 18},
+		},
+		"max input bytes": {
+			input:    "\"a\"\n{\n\t\"b\" \"c\"\n}",
+			limits:   govdf.Limits{MaxInputBytes: 10},
+			expected: &govdf.LimitError{Limit: "MaxInputBytes", Max: 10, Line: 3, Column: 5, Offset: 11},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act: Unmarshal the input with the limits.
+			var node govdf.Node
+			err := govdf.Unmarshal([]byte(tc.input), &node, append(tc.options, govdf.WithLimits(tc.limits))...)
+
+			// Assert: The error should report the exceeded limit.
+			if tc.expected == nil {
+				require.NoError(t, err)
+				return
+			}
+			var limitErr *govdf.LimitError
+			require.ErrorAs(t, err, &limitErr)
+			if diff := cmp.Diff(tc.expected, limitErr); diff != "" {
+				t.Errorf("LimitError mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLimitError(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "line 2, column 5: MaxDepth limit of 8 exceeded", (&govdf.LimitError{Limit: "MaxDepth", Max: 8, Line: 2, Column: 5, Offset: 12}).Error())
+	require.Equal(t, "offset 12: MaxNodes limit of 100 exceeded", (&govdf.LimitError{Limit: "MaxNodes", Max: 100, Offset: 12}).Error())
+}
+
+func TestDecode_ErrorMessages(t *testing.T) {
+	t.Parallel()
+
+	type target struct {
+		A string `vdf:"a"`
+	}
+
+	var testCases = map[string]struct {
+		decode   func() error
+		expected string
+	}{
+		"limit": {
+			decode: func() error {
+				var node govdf.Node
+				return govdf.Unmarshal([]byte(`"a" { "b" { "c" { } } }`), &node, govdf.WithLimits(govdf.Limits{MaxDepth: 2}))
+			},
+			expected: "line 1, column 17: MaxDepth limit of 2 exceeded",
+		},
+		"parse error": {
+			decode: func() error {
+				var node govdf.Node
+				return govdf.Unmarshal([]byte(`"a" { "b" }`), &node, govdf.WithStrict(true))
+			},
+			expected: `line 1, column 7: expected value after key (expected "value", found "}")`,
+		},
+		"parse error with file name": {
+			decode: func() error {
+				var node govdf.Node
+				return govdf.Unmarshal([]byte(`"a" { "b" }`), &node, govdf.WithStrict(true), govdf.WithFilename("game.vdf"))
+			},
+			expected: `game.vdf: line 1, column 7: expected value after key (expected "value", found "}")`,
+		},
+		"unknown field": {
+			decode: func() error {
+				var v target
+				return govdf.Unmarshal([]byte(`"a" "1" "b" "2"`), &v, govdf.WithDisallowUnknownFields())
+			},
+			expected: `line 1, column 9: unknown field "b"`,
+		},
+		"error without position": {
+			decode: func() error {
+				var node govdf.Node
+				return govdf.Unmarshal([]byte(`"a" "b`), &node, govdf.WithFilename("game.vdf"))
+			},
+			expected: "game.vdf: line 1, column 7: unexpected EOF",
+		},
+		"document": {
+			decode: func() error {
+				_, err := govdf.ParseDocument([]byte(`"a" { "b" }`))
+				return err
+			},
+			expected: `line 1, column 11: expected value after key (expected "value or '{'", found "}")`,
+		},
+		"lazy document": {
+			decode: func() error {
+				_, err := govdf.ParseLazyDocument([]byte(`"a" { "b" }`))
+				return err
+			},
+			expected: `line 1, column 7: expected value after key (expected "value", found "}")`,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act: Decode the input.
+			err := tc.decode()
+
+			// Assert: The message should hold the position once.
+			require.EqualError(t, err, tc.expected)
+		})
+	}
+}
+
+func TestDecode_Strict(t *testing.T) {
+	t.Parallel()
+
+	var testCases = map[string]struct {
+		input    string
+		options  []govdf.Option
+		expected *govdf.ParseError
+	}{
+		"key without value before closing brace": {
+			input:    "\"a\"\n{\n\t\"b\"\n}",
+			expected: &govdf.ParseError{Line: 3, Column: 2, Message: "expected value after key", Expected: "value", Found: "}"},
+		},
+		"key without value at end of input": {
+			input:    `"a" "b" "c"`,
+			expected: &govdf.ParseError{Line: 1, Column: 9, Message: "expected value after key", Expected: "value", Found: "end of input"},
+		},
+		"map without key": {
+			input:    "\"c\" \"d\"\n{ \"e\" \"f\" }",
+			expected: &govdf.ParseError{Line: 2, Column: 1, Message: "unexpected '{'", Expected: "key", Found: "{"},
+		},
+		"unterminated string": {
+			input:    "\"a\" {\n\t\"b\" \"c\n}",
+			expected: &govdf.ParseError{Line: 2, Column: 6, Message: "unterminated string", Expected: `closing '"'`, Found: "end of input"},
+		},
+		"unclosed map": {
+			input:    "\"a\"\n{\n\t\"b\"\n\t{\n\t\t\"c\" \"d\"\n",
+			expected: &govdf.ParseError{Line: 4, Column: 2, EndLine: 4, EndColumn: 3, Message: "unclosed '{'", Expected: "}", Found: "end of input"},
+		},
+		"lenient": {
+			input:   "\"a\" { \"b\" \"c\" \"d\" ",
+			options: []govdf.Option{govdf.WithStrict(false)},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act: Unmarshal the input in strict mode, or with the options of the test case.
+			var options = tc.options
+			if options == nil {
+				options = []govdf.Option{govdf.WithStrict(true)}
+			}
+			var node govdf.Node
+			err := govdf.Unmarshal([]byte(tc.input), &node, options...)
+
+			// Assert: The error should describe the problem.
+			if tc.expected == nil {
+				require.NoError(t, err)
+				return
+			}
+			var parseErr *govdf.ParseError
+			require.ErrorAs(t, err, &parseErr)
+			if diff := cmp.Diff(tc.expected, parseErr); diff != "" {
+				t.Errorf("ParseError mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDecode_StrictRecovery(t *testing.T) {
+	t.Parallel()
+
+	// Act: Unmarshal input with two unclosed maps in strict mode, recovering from errors.
+	var node govdf.Node
+	err := govdf.Unmarshal([]byte("\"a\"\n{\n\t\"b\"\n\t{\n"), &node, govdf.WithStrict(true), govdf.WithRecovery())
+
+	// Assert: Both maps should be reported as errors.
+	var list govdf.ErrorList
+	require.ErrorAs(t, err, &list)
+	require.Len(t, list, 2)
+	for _, diagnostic := range list {
+		require.Equal(t, "unclosed '{'", diagnostic.Message)
+		require.Equal(t, govdf.SeverityError, diagnostic.Severity)
+	}
+}
+
+func TestDecode_Ranges(t *testing.T) {
+	t.Parallel()
+
+	// Arrange: Create input with quoted and unquoted strings, a conditional and a multi-byte character.
+	var input = "\"root\"\n{\n\tname \"Grüße\" [$WIN32]\n\t\"empty\" {}\n}"
+
+	// Act: Unmarshal the input.
+	var node govdf.Node
+	require.NoError(t, govdf.Unmarshal([]byte(input), &node))
+
+	// Assert: Every node should record the exact range of its key and value.
+	var pos = func(line, column int, offset int64) govdf.Position {
+		return govdf.Position{Line: line, Column: column, Offset: offset}
+	}
+	var root = node.Children["root"]
+	var testCases = map[string]struct {
+		actual   govdf.Range
+		expected govdf.Range
+	}{
+		"map key":      {root.KeyRange, govdf.Range{Start: pos(1, 1, 0), End: pos(1, 7, 6)}},
+		"map value":    {root.ValueRange, govdf.Range{Start: pos(2, 1, 7), End: pos(5, 2, 47)}},
+		"scalar key":   {root.Children["name"].KeyRange, govdf.Range{Start: pos(3, 2, 10), End: pos(3, 6, 14)}},
+		"scalar value": {root.Children["name"].ValueRange, govdf.Range{Start: pos(3, 7, 15), End: pos(3, 14, 24)}},
+		"empty key":    {root.Children["empty"].KeyRange, govdf.Range{Start: pos(4, 2, 35), End: pos(4, 9, 42)}},
+		"empty value":  {root.Children["empty"].ValueRange, govdf.Range{Start: pos(4, 10, 43), End: pos(4, 12, 45)}},
+		"root":         {node.KeyRange, govdf.Range{}},
+	}
+	for name, tc := range testCases {
+		if diff := cmp.Diff(tc.expected, tc.actual); diff != "" {
+			t.Errorf("%s range mismatch (-want +got):\n%s", name, diff)
+		}
+	}
+	require.Equal(t, "Grüße", input[root.Children["name"].ValueRange.Start.Offset+1:root.Children["name"].ValueRange.End.Offset-1])
+}
+
+func TestDecode_RangesUnclosedMap(t *testing.T) {
+	t.Parallel()
+
+	// Act: Unmarshal a map that is still open at the end of the input.
+	var node govdf.Node
+	require.NoError(t, govdf.Unmarshal([]byte("\"a\" {\n\t\"b\" \"c\"\n"), &node))
+
+	// Assert: The map should end at the end of the input.
+	require.Equal(t, govdf.Position{Line: 3, Column: 1, Offset: 15}, node.Children["a"].ValueRange.End)
+}
+
+func TestDecoder_ReaderBoundaries(t *testing.T) {
+	t.Parallel()
+
+	var fixture, err = fixtures.ReadFile("fixtures/csgo_english.vdf")
+	require.NoError(t, err)
+
+	var testCases = map[string]struct {
+		input   []byte
+		options []govdf.Option
+	}{
+		"fixture": {
+			input: fixture,
+		},
+		"multi-byte characters": {
+			input: []byte("\"root\" {\n" + strings.Repeat("\"ключ\" \"значение 🎮\" // комментарий\n\"k\" { \"v\" \"é\" }\n", 200) + "}"),
+		},
+		"escape sequences": {
+			input:   []byte("\"root\" {\n" + strings.Repeat("\"a\\tb\" \"line\\none \\\"quoted\\\"\"\n", 300) + "}"),
+			options: []govdf.Option{govdf.WithEscapeSequences(), govdf.WithDuplicateKeys(govdf.DuplicateKeepAll)},
+		},
+		"escaped quotes": {
+			input:   []byte("\"root\" {\n" + strings.Repeat("\"a\" \"say \\\"hi\\\" \\\\\"\n", 300) + "}"),
+			options: []govdf.Option{govdf.WithDuplicateKeys(govdf.DuplicateKeepAll)},
+		},
+		"unquoted strings and block comments": {
+			input:   []byte("\"root\" {\n" + strings.Repeat("Material /* block\ncomment */ { $basetexture concrete/floor01 }\n", 300) + "}"),
+			options: []govdf.Option{govdf.WithDuplicateKeys(govdf.DuplicateKeepAll)},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Arrange: Decode the input from memory.
+			var expected govdf.Node
+			require.NoError(t, govdf.Unmarshal(tc.input, &expected, tc.options...))
+
+			// Act: Decode the input from a reader that returns a single byte at a time.
+			// Decode reads a single top-level entry, so repeated entries are kept in a root map.
+			var node govdf.Node
+			require.NoError(t, govdf.NewDecoder(iotest.OneByteReader(bytes.NewReader(tc.input)), tc.options...).Decode(&node))
+
+			// Assert: Both should produce the same tree, including positions.
+			if diff := cmp.Diff(expected, node); diff != "" {
+				t.Errorf("Decode() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDecoder_ReaderError(t *testing.T) {
+	t.Parallel()
+
+	// Arrange: Create a reader that fails after part of the input.
+	var readErr = errors.New("connection reset")
+	var reader = io.MultiReader(strings.NewReader(`"a" { "b" "c" `), iotest.ErrReader(readErr))
+
+	// Act: Decode the input.
+	var node govdf.Node
+	err := govdf.NewDecoder(reader).Decode(&node)
+
+	// Assert: The read error should be returned.
+	require.ErrorIs(t, err, readErr)
 }
@@ -0,0 +1,630 @@
+package govdf
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Document is a lossless concrete syntax tree of a VDF text document.
+// It records every byte of the source, including whitespace, alignment tabs, comments,
+// blank lines and brace style, so that a document can be edited programmatically and
+// written back with untouched regions left byte-for-byte identical.
+//
+// Example:
+//
+//	doc, err := govdf.ParseDocument(data)
+//	if err != nil {
+//	    return err
+//	}
+//	doc.Lookup("UserLocalConfigStore", "streaming").Block().Set("quality", "2")
+//	err = os.WriteFile(path, doc.Bytes(), 0o644)
+type Document struct {
+	root    Block
+	opts    options
+	newline string
+}
+
+// Block is the list of entries of a document or of a nested map, in source order.
+type Block struct {
+	doc     *Document
+	owner   *Entry // The entry that opens this block, nil for the document root
+	entries []*Entry
+
+	// Raw text following the opening brace on the same line and the raw text
+	// before the closing brace, which is missing when the input ended early
+	head     string
+	trailing string
+	closed   bool
+}
+
+// Entry is a single key-value pair or nested map within a Block.
+type Entry struct {
+	key       string
+	value     string
+	condition string
+	block     *Block
+	parent    *Block
+
+	// Raw text before the key, such as indentation, blank lines and head comments
+	leading string
+
+	// Raw text from the key up to the value or opening brace, including any conditional.
+	// The value of a scalar entry is kept at valueIndex so it can be replaced.
+	parts      []string
+	valueIndex int
+
+	// Raw text after the entry on the same line, such as a line comment and the newline
+	trailing string
+}
+
+// ParseDocument parses VDF text into a Document.
+// Options such as WithEscapeSequences decide how keys and values are read and written.
+// Unlike Unmarshal, the text is parsed in strict mode unless WithStrict(false) is given.
+func ParseDocument(in []byte, opts ...Option) (*Document, error) {
+	var d = &Decoder{opts: newOptions(opts)}
+	d.scanner = newBytesScanner(in, &d.opts)
+	return d.DecodeDocument()
+}
+
+// DecodeDocument reads the VDF text from the input and returns it as a Document.
+// Unlike Decode, conditionals are not evaluated, directives are not resolved and
+// duplicate keys are kept, so that the document can be written back unchanged.
+// Unlike Decode, it is strict unless the Decoder was created with WithStrict(false).
+func (d *Decoder) DecodeDocument() (*Document, error) {
+	d.scanner.record = true
+	defer d.strictByDefault()()
+
+	var doc = &Document{opts: d.opts, newline: "\n"}
+	doc.root.doc = doc
+
+	var r = &documentReader{scanner: d.scanner, doc: doc}
+	if err := r.readBlock(&doc.root, nil); err != nil {
+		return nil, positionError(d.opts.filename, d.scanner.line, d.scanner.column, err)
+	}
+
+	// Inserted entries use the line endings of the source
+	if bytes.Contains(doc.Bytes(), []byte("\r\n")) {
+		doc.newline = "\r\n"
+	}
+
+	return doc, nil
+}
+
+// Root returns the top-level entries of the document.
+func (d *Document) Root() *Block {
+	return &d.root
+}
+
+// Lookup returns the first entry found by following path from the root, or nil if there is none.
+// Every key except the last must name a nested map.
+func (d *Document) Lookup(path ...string) *Entry {
+	var block = &d.root
+	var entry *Entry
+	for _, key := range path {
+		if block == nil {
+			return nil
+		}
+		if entry = block.Get(key); entry == nil {
+			return nil
+		}
+		block = entry.block
+	}
+	return entry
+}
+
+// Bytes returns the VDF text of the document.
+// A document that has not been edited returns its source exactly,
+// except that text decoded from another encoding is returned as UTF-8.
+func (d *Document) Bytes() []byte {
+	var buffer bytes.Buffer
+	d.root.writeTo(&buffer)
+	return buffer.Bytes()
+}
+
+// String returns the VDF text of the document.
+func (d *Document) String() string {
+	return string(d.Bytes())
+}
+
+// WriteTo writes the VDF text of the document to w.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(d.Bytes())
+	return int64(n), err
+}
+
+// Node decodes the current text of the document into a Node tree,
+// using the options the document was parsed with.
+func (d *Document) Node() (*Node, error) {
+	var node Node
+	var opts = func(o *options) {
+		*o = d.opts
+		o.encoding = EncodingUTF8
+	}
+	if err := Unmarshal(d.Bytes(), &node, opts); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// Entries returns the entries of the block in source order.
+func (b *Block) Entries() []*Entry {
+	return append([]*Entry(nil), b.entries...)
+}
+
+// Get returns the first entry with the given key, or nil if there is none.
+func (b *Block) Get(key string) *Entry {
+	for _, entry := range b.entries {
+		if entry.key == key {
+			return entry
+		}
+	}
+	return nil
+}
+
+// Set sets the value of the first scalar entry with the given key,
+// or appends a new scalar entry to the block when there is none.
+func (b *Block) Set(key, value string) *Entry {
+	for _, entry := range b.entries {
+		if entry.key == key && entry.block == nil {
+			entry.SetValue(value)
+			return entry
+		}
+	}
+	return b.Insert(len(b.entries), key, value)
+}
+
+// Insert adds a scalar entry at index, formatted like the entries around it.
+// An index outside the block appends the entry.
+func (b *Block) Insert(index int, key, value string) *Entry {
+	var entry = b.newEntry(index, key)
+
+	// Separate the key and value like a sibling scalar does
+	var separator = " "
+	if sibling := b.sibling(index, false); sibling != nil && sibling.condition == "" && !strings.ContainsAny(sibling.parts[1], "\r\n") {
+		separator = sibling.parts[1]
+	}
+	entry.value = value
+	entry.valueIndex = 2
+	entry.parts = append(entry.parts, separator, b.doc.formatString(value, isQuoted(entry.parts[0])))
+
+	b.insert(index, entry)
+	return entry
+}
+
+// InsertBlock adds an empty nested map at index, formatted like the entries around it.
+// An index outside the block appends the entry.
+func (b *Block) InsertBlock(index int, key string) *Entry {
+	var entry = b.newEntry(index, key)
+
+	// Place the opening brace like a sibling map does
+	var separator = " "
+	if sibling := b.sibling(index, true); sibling != nil && sibling.condition == "" {
+		separator = sibling.parts[1]
+	}
+	entry.parts = append(entry.parts, separator, "{")
+	entry.block = &Block{
+		doc:      b.doc,
+		owner:    entry,
+		head:     b.doc.newline,
+		trailing: indentOf(entry.leading),
+		closed:   true,
+	}
+
+	b.insert(index, entry)
+	return entry
+}
+
+// Delete removes every entry with the given key, along with its comments,
+// and returns the number of entries removed.
+func (b *Block) Delete(key string) int {
+	var kept = b.entries[:0]
+	for _, entry := range b.entries {
+		if entry.key != key {
+			kept = append(kept, entry)
+		}
+	}
+
+	var removed = len(b.entries) - len(kept)
+	clear(b.entries[len(kept):])
+	b.entries = kept
+	return removed
+}
+
+// Remove removes entry from the block and reports whether it was found.
+func (b *Block) Remove(entry *Entry) bool {
+	for i, e := range b.entries {
+		if e == entry {
+			b.entries = append(b.entries[:i], b.entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Key returns the key of the entry.
+func (e *Entry) Key() string {
+	return e.key
+}
+
+// Value returns the value of a scalar entry. It is empty for nested maps.
+func (e *Entry) Value() string {
+	return e.value
+}
+
+// Condition returns the conditional attached to the entry without its brackets, if any.
+func (e *Entry) Condition() string {
+	return e.condition
+}
+
+// Block returns the entries of a nested map, or nil for a scalar entry.
+func (e *Entry) Block() *Block {
+	return e.block
+}
+
+// SetValue replaces the value of a scalar entry, keeping the surrounding text and
+// the quoting style of the previous value. It does nothing for nested maps.
+func (e *Entry) SetValue(value string) {
+	if e.block != nil {
+		return
+	}
+
+	e.value = value
+	e.parts[e.valueIndex] = e.parent.doc.formatString(value, isQuoted(e.parts[e.valueIndex]))
+}
+
+// newEntry returns an entry for key, indented and quoted like its siblings.
+// A sibling on the line of the opening brace or of another entry has no indentation of its own,
+// so the entry is then indented like the entries of an empty block.
+func (b *Block) newEntry(index int, key string) *Entry {
+	var indent, quoted = b.childIndent(), true
+	if neighbour := b.neighbour(index); neighbour != nil {
+		quoted = isQuoted(neighbour.parts[0])
+		if b.startsLine(neighbour) {
+			indent = indentOf(neighbour.leading)
+		}
+	}
+
+	return &Entry{
+		key:      key,
+		leading:  indent,
+		parts:    []string{b.doc.formatString(key, quoted)},
+		trailing: b.doc.newline,
+		parent:   b,
+	}
+}
+
+// insert places a new entry at index, making sure it starts and ends on its own line.
+func (b *Block) insert(index int, entry *Entry) {
+	if index < 0 || index > len(b.entries) {
+		index = len(b.entries)
+	}
+
+	// Start a new line when the text before the entry does not end one
+	var before = b.head
+	if index > 0 {
+		before = b.entries[index-1].trailing
+	}
+	if (index > 0 || b.owner != nil) && !strings.HasSuffix(before, "\n") {
+		entry.leading = b.doc.newline + entry.leading
+
+		// The entry that followed that text now follows the new line ended by the entry, so it
+		// drops the line break it started with, or is indented when it shared the line.
+		if index < len(b.entries) {
+			var next = b.entries[index]
+			if i := strings.IndexByte(next.leading, '\n'); i >= 0 && strings.TrimSpace(next.leading[:i]) == "" {
+				next.leading = next.leading[i+1:]
+			} else {
+				next.leading = indentOf(entry.leading) + strings.TrimLeft(next.leading, " \t")
+			}
+		}
+	}
+
+	// Move the closing brace onto its own line, ending the line of the last entry when the
+	// new entry goes before it
+	if b.owner != nil && !strings.Contains(b.trailing, "\n") {
+		switch {
+		case index == len(b.entries):
+			b.trailing = indentOf(b.owner.leading)
+
+		case !strings.HasSuffix(b.entries[len(b.entries)-1].trailing, "\n"):
+			var last = b.entries[len(b.entries)-1]
+			last.trailing = strings.TrimRight(last.trailing, " \t") + b.doc.newline
+			b.trailing = indentOf(b.owner.leading)
+		}
+	}
+
+	b.entries = append(b.entries, nil)
+	copy(b.entries[index+1:], b.entries[index:])
+	b.entries[index] = entry
+}
+
+// startsLine reports whether an entry of the block starts its own line rather than following
+// the opening brace or another entry on the same line.
+func (b *Block) startsLine(entry *Entry) bool {
+	if strings.Contains(entry.leading, "\n") {
+		return true
+	}
+
+	switch i := slices.Index(b.entries, entry); {
+	case i > 0:
+		return strings.HasSuffix(b.entries[i-1].trailing, "\n")
+
+	case b.owner == nil:
+		// The first entry of the document
+		return true
+
+	default:
+		return strings.HasSuffix(b.head, "\n")
+	}
+}
+
+// neighbour returns the entry just before index, or the first entry when inserting at the start.
+func (b *Block) neighbour(index int) *Entry {
+	switch {
+	case len(b.entries) == 0:
+		return nil
+
+	case index <= 0:
+		return b.entries[0]
+
+	case index > len(b.entries):
+		return b.entries[len(b.entries)-1]
+
+	default:
+		return b.entries[index-1]
+	}
+}
+
+// sibling returns the entry closest to index that is a nested map when block is set,
+// or a scalar otherwise. Entries before index are preferred.
+func (b *Block) sibling(index int, block bool) *Entry {
+	if index < 0 || index > len(b.entries) {
+		index = len(b.entries)
+	}
+
+	for i := index - 1; i >= 0; i-- {
+		if (b.entries[i].block != nil) == block {
+			return b.entries[i]
+		}
+	}
+	for i := index; i < len(b.entries); i++ {
+		if (b.entries[i].block != nil) == block {
+			return b.entries[i]
+		}
+	}
+	return nil
+}
+
+// childIndent returns the indentation of entries in an empty block.
+func (b *Block) childIndent() string {
+	if b.owner == nil {
+		return ""
+	}
+	return indentOf(b.owner.leading) + "\t"
+}
+
+// writeTo writes the raw text of the block and its entries.
+func (b *Block) writeTo(buffer *bytes.Buffer) {
+	buffer.WriteString(b.head)
+	for _, entry := range b.entries {
+		entry.writeTo(buffer)
+	}
+	buffer.WriteString(b.trailing)
+}
+
+// writeTo writes the raw text of the entry.
+func (e *Entry) writeTo(buffer *bytes.Buffer) {
+	buffer.WriteString(e.leading)
+	for _, part := range e.parts {
+		buffer.WriteString(part)
+	}
+	if e.block != nil {
+		e.block.writeTo(buffer)
+		if e.block.closed {
+			buffer.WriteByte('}')
+		}
+	}
+	buffer.WriteString(e.trailing)
+}
+
+// formatString returns s as it should be written for a new key or value.
+// Strings are quoted unless quoted is false and they can be written unquoted.
+func (d *Document) formatString(s string, quoted bool) string {
+	if !quoted && canWriteUnquoted(s) {
+		return s
+	}
+	if d.opts.escapeSequences {
+		s = escapeReplacer.Replace(s)
+	}
+	return `"` + s + `"`
+}
+
+// isQuoted reports whether a raw key or value was written with quotes.
+func isQuoted(raw string) bool {
+	return strings.HasPrefix(raw, `"`)
+}
+
+// indentOf returns the whitespace at the start of the last line of leading text.
+func indentOf(leading string) string {
+	var line = leading[strings.LastIndexByte(leading, '\n')+1:]
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+// documentReader builds a Document from the tokens of a recording scanner.
+type documentReader struct {
+	scanner *scanner
+	doc     *Document
+
+	// A item read ahead while looking for a trailing conditional
+	pending *documentItem
+}
+
+// documentItem is a item along with the raw text preceding it and its own raw text.
+type documentItem struct {
+	item
+	trivia string
+	raw    string
+}
+
+// next reads the next item, folding whitespace and comments into its trivia.
+func (r *documentReader) next(value bool) (documentItem, error) {
+	if r.pending != nil {
+		var tok = *r.pending
+		r.pending = nil
+		return tok, nil
+	}
+
+	var trivia strings.Builder
+	for {
+		tok, err := r.scanner.next(value)
+		if err != nil {
+			return documentItem{}, err
+		}
+
+		trivia.Write(r.scanner.raw[:r.scanner.start])
+		var raw = string(r.scanner.raw[r.scanner.start:])
+		r.scanner.raw = r.scanner.raw[:0]
+
+		if tok.kind == itemComment {
+			trivia.WriteString(raw)
+			continue
+		}
+		return documentItem{item: tok, trivia: trivia.String(), raw: raw}, nil
+	}
+}
+
+// readBlock reads entries into b until its closing brace or the end of the input.
+// Text on the same line as the previous item is added to prev.
+func (r *documentReader) readBlock(b *Block, prev *string) error {
+	for {
+		tok, err := r.next(false)
+		if err != nil {
+			return err
+		}
+
+		// Text up to the end of the line belongs to the previous item
+		var leading = tok.trivia
+		if prev != nil {
+			var sameLine string
+			sameLine, leading = splitTrivia(tok.trivia)
+			*prev += sameLine
+		}
+
+		switch tok.kind {
+		case itemEOF:
+			b.trailing = leading
+			return nil
+
+		case itemCloseBrace:
+			if b.owner == nil {
+				return newParseError(tok.line, tok.column, "unexpected '}' at root level")
+			}
+			b.trailing, b.closed = leading, true
+			return nil
+
+		case itemString:
+			var entry = &Entry{key: tok.value, leading: leading, parts: []string{tok.raw}, parent: b}
+			value, err := r.next(true)
+			if err != nil {
+				return err
+			}
+			if err := r.readValue(entry, value); err != nil {
+				return err
+			}
+			b.entries = append(b.entries, entry)
+			prev = &entry.trailing
+
+		case itemOpenBrace:
+			// A map without a key is read as the empty key, like Decode does
+			var entry = &Entry{leading: leading, parts: []string{""}, parent: b}
+			tok.trivia = ""
+			if err := r.readValue(entry, tok); err != nil {
+				return err
+			}
+			b.entries = append(b.entries, entry)
+			prev = &entry.trailing
+
+		default:
+			return newParseErrorWithExpected(tok.line, tok.column, "unexpected token", "key", tok.raw)
+		}
+	}
+}
+
+// readValue reads the value of entry, starting with the item that follows its key.
+func (r *documentReader) readValue(entry *Entry, value documentItem) error {
+	// A conditional may appear between the key and its value
+	if value.kind == itemCondition {
+		entry.condition = value.value
+		entry.parts = append(entry.parts, value.trivia, value.raw)
+
+		var err error
+		if value, err = r.next(true); err != nil {
+			return err
+		}
+	}
+	entry.parts = append(entry.parts, value.trivia)
+
+	switch value.kind {
+	case itemString:
+		entry.value = value.value
+		entry.valueIndex = len(entry.parts)
+		entry.parts = append(entry.parts, value.raw)
+
+		// A conditional may follow the value
+		after, err := r.next(false)
+		if err != nil {
+			return err
+		}
+		if after.kind == itemCondition && entry.condition == "" {
+			entry.condition = after.value
+			entry.parts = append(entry.parts, after.trivia, after.raw)
+		} else {
+			r.pending = &after
+		}
+		return nil
+
+	case itemOpenBrace:
+		entry.parts = append(entry.parts, value.raw)
+		entry.block = &Block{doc: r.doc, owner: entry}
+		if err := r.readBlock(entry.block, &entry.block.head); err != nil {
+			return err
+		}
+		if !entry.block.closed && r.scanner.opts.strict {
+			return newParseErrorWithExpected(value.line, value.column, "unclosed '{'", "}", "end of input")
+		}
+		return nil
+
+	default:
+		return newParseErrorWithExpected(value.line, value.column, "expected value after key", "value or '{'", value.raw)
+	}
+}
+
+// splitTrivia splits trivia after the first newline that is not inside a block comment.
+// The first part ends the line of the previous item and the second part leads the next item.
+func splitTrivia(trivia string) (string, string) {
+	for i := 0; i < len(trivia); i++ {
+		switch {
+		case trivia[i] == '\n':
+			return trivia[:i+1], trivia[i+1:]
+
+		case strings.HasPrefix(trivia[i:], "//"):
+			// A line comment ends at the newline, so skip to it
+			var end = strings.IndexByte(trivia[i:], '\n')
+			if end < 0 {
+				return "", trivia
+			}
+			i += end - 1
+
+		case strings.HasPrefix(trivia[i:], "/*"):
+			// A block comment that starts on the line stays in one piece
+			var end = strings.Index(trivia[i+2:], "*/")
+			if end < 0 {
+				return trivia, ""
+			}
+			i += end + 3
+		}
+	}
+	return "", trivia
+}
@@ -0,0 +1,390 @@
+package govdf_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	govdf "github.com/lewisgibson/go-vdf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocument_Roundtrip(t *testing.T) {
+	t.Parallel()
+
+	var testCases = map[string]string{
+		"empty":               "",
+		"only whitespace":     " \n\t\n",
+		"tabs and alignment":  "\"root\"\n{\n\t\"name\"\t\t\"value\"\n\t\"longer_name\"\t\"other\"\n}\n",
+		"brace on same line":  "\"root\" {\n    \"a\" \"b\"\n}",
+		"comments":            "// header\n\n\"root\" // after key\n{\n\t// head\n\t\"a\" \"b\" // line\n\n\n\t\"c\" \"d\"\n\t// dangling\n}\n// footer",
+		"conditionals":        "\"root\"\n{\n\t\"font\" \"Tahoma\" [$WIN32]\n\t\"menu\" [$X360] { \"x\" \"1\" }\n\t\"tall\" [!$OSX] \"12\"\n}\n",
+		"directives":          "#base \"base.res\"\n#include \"extra.res\"\n\"a\" \"b\"\n",
+		"unquoted strings":    "LightmappedGeneric\n{\n    $basetexture concrete/floor01\n    $surfaceprop concrete\n}\n",
+		"windows line ending": "\"root\"\r\n{\r\n\t\"a\"\t\"b\"\r\n}\r\n",
+		"byte order mark":     "\uFEFF\"a\" \"b\"",
+		"escaped quotes":      `"a" "say \"hi\""`,
+		"one line":            `"a" { "b" "c" "d" { } }`,
+		"keyless map":         "{ \"a\" \"b\" }",
+		"duplicate keys":      "\"wave\" \"a.wav\"\n\"wave\" \"b.wav\"\n",
+		"block comments":      "/* header */\n\"root\" /* key */ {\n\t\"a\" \"b\" /* spans\n\tlines */\n\t\"c\" \"d\"\n}\n",
+	}
+	for name, input := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act: Parse the input into a document.
+			doc, err := govdf.ParseDocument([]byte(input))
+			require.NoError(t, err)
+
+			// Assert: The document should be written back unchanged.
+			require.Equal(t, input, doc.String())
+		})
+	}
+}
+
+func TestDocument_Lenient(t *testing.T) {
+	t.Parallel()
+
+	var input = "\"a\" {\n\t\"b\" \"c\"\n"
+
+	// Act: Parse an unterminated map with and without strict mode.
+	_, strictErr := govdf.ParseDocument([]byte(input))
+	_, decodeErr := govdf.NewDecoder(strings.NewReader(input)).DecodeDocument()
+	doc, err := govdf.ParseDocument([]byte(input), govdf.WithStrict(false))
+	decoded, decodedErr := govdf.NewDecoder(strings.NewReader(input), govdf.WithStrict(false)).DecodeDocument()
+
+	// Assert: Only the lenient parses should accept the map, and write it back unchanged.
+	require.ErrorContains(t, strictErr, "unclosed '{'")
+	require.ErrorContains(t, decodeErr, "unclosed '{'")
+	require.NoError(t, err)
+	require.Equal(t, input, doc.String())
+	require.NoError(t, decodedErr)
+	require.Equal(t, input, decoded.String())
+}
+
+func TestDocument_RoundtripFixtures(t *testing.T) {
+	t.Parallel()
+
+	dirents, err := fixtures.ReadDir("fixtures")
+	require.NoError(t, err)
+
+	for _, dirent := range dirents {
+		if strings.HasSuffix(dirent.Name(), ".vdf") {
+			t.Run(dirent.Name(), func(t *testing.T) {
+				t.Parallel()
+
+				// Arrange: Load the fixture.
+				file, err := fixtures.Open("fixtures/" + dirent.Name())
+				require.NoError(t, err)
+
+				data, err := io.ReadAll(file)
+				require.NoError(t, err)
+
+				// Act: Parse the fixture into a document.
+				doc, err := govdf.ParseDocument(data)
+				require.NoError(t, err)
+
+				// Assert: The document should be written back byte-for-byte.
+				require.Equal(t, data, doc.Bytes())
+			})
+		}
+	}
+}
+
+func TestDocument_Edits(t *testing.T) {
+	t.Parallel()
+
+	var input = strings.Join([]string{
+		`// Settings`,
+		`"root"`,
+		`{`,
+		`	"name"		"old"	// keep this comment`,
+		`	"size"		"10"`,
+		``,
+		`	// Remove me`,
+		`	"remove"	"1"`,
+		`	"nested"`,
+		`	{`,
+		`		"x"	"1"`,
+		`	}`,
+		`}`,
+		``,
+	}, "\n")
+
+	var testCases = map[string]struct {
+		edit     func(doc *govdf.Document)
+		expected []string
+	}{
+		"set value": {
+			edit: func(doc *govdf.Document) {
+				doc.Lookup("root", "name").SetValue("new value")
+			},
+			expected: []string{
+				`// Settings`,
+				`"root"`,
+				`{`,
+				`	"name"		"new value"	// keep this comment`,
+				`	"size"		"10"`,
+				``,
+				`	// Remove me`,
+				`	"remove"	"1"`,
+				`	"nested"`,
+				`	{`,
+				`		"x"	"1"`,
+				`	}`,
+				`}`,
+				``,
+			},
+		},
+		"delete entry with its comment": {
+			edit: func(doc *govdf.Document) {
+				require.Equal(t, 1, doc.Lookup("root").Block().Delete("remove"))
+			},
+			expected: []string{
+				`// Settings`,
+				`"root"`,
+				`{`,
+				`	"name"		"old"	// keep this comment`,
+				`	"size"		"10"`,
+				`	"nested"`,
+				`	{`,
+				`		"x"	"1"`,
+				`	}`,
+				`}`,
+				``,
+			},
+		},
+		"append to nested block": {
+			edit: func(doc *govdf.Document) {
+				doc.Lookup("root", "nested").Block().Set("y", "2")
+			},
+			expected: []string{
+				`// Settings`,
+				`"root"`,
+				`{`,
+				`	"name"		"old"	// keep this comment`,
+				`	"size"		"10"`,
+				``,
+				`	// Remove me`,
+				`	"remove"	"1"`,
+				`	"nested"`,
+				`	{`,
+				`		"x"	"1"`,
+				`		"y"	"2"`,
+				`	}`,
+				`}`,
+				``,
+			},
+		},
+		"insert between entries": {
+			edit: func(doc *govdf.Document) {
+				doc.Lookup("root").Block().Insert(1, "color", "red")
+			},
+			expected: []string{
+				`// Settings`,
+				`"root"`,
+				`{`,
+				`	"name"		"old"	// keep this comment`,
+				`	"color"		"red"`,
+				`	"size"		"10"`,
+				``,
+				`	// Remove me`,
+				`	"remove"	"1"`,
+				`	"nested"`,
+				`	{`,
+				`		"x"	"1"`,
+				`	}`,
+				`}`,
+				``,
+			},
+		},
+		"insert block": {
+			edit: func(doc *govdf.Document) {
+				var block = doc.Lookup("root").Block().InsertBlock(-1, "added").Block()
+				block.Set("z", "3")
+			},
+			expected: []string{
+				`// Settings`,
+				`"root"`,
+				`{`,
+				`	"name"		"old"	// keep this comment`,
+				`	"size"		"10"`,
+				``,
+				`	// Remove me`,
+				`	"remove"	"1"`,
+				`	"nested"`,
+				`	{`,
+				`		"x"	"1"`,
+				`	}`,
+				`	"added"`,
+				`	{`,
+				`		"z" "3"`,
+				`	}`,
+				`}`,
+				``,
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Arrange: Parse the input into a document.
+			doc, err := govdf.ParseDocument([]byte(input))
+			require.NoError(t, err)
+
+			// Act: Edit the document.
+			tc.edit(doc)
+
+			// Assert: Only the edited region should change.
+			require.Equal(t, strings.Join(tc.expected, "\n"), doc.String())
+		})
+	}
+}
+
+func TestDocument_EditsFormatting(t *testing.T) {
+	t.Parallel()
+
+	var testCases = map[string]struct {
+		input    string
+		options  []govdf.Option
+		edit     func(doc *govdf.Document)
+		expected string
+	}{
+		"keeps windows line endings": {
+			input: "\"root\"\r\n{\r\n\t\"a\"\t\"1\"\r\n}\r\n",
+			edit: func(doc *govdf.Document) {
+				doc.Lookup("root").Block().Set("b", "2")
+			},
+			expected: "\"root\"\r\n{\r\n\t\"a\"\t\"1\"\r\n\t\"b\"\t\"2\"\r\n}\r\n",
+		},
+		"keeps unquoted style": {
+			input: "Material\n{\n    $basetexture a\n}\n",
+			edit: func(doc *govdf.Document) {
+				doc.Lookup("Material").Block().Set("$detail", "detail/noise")
+				doc.Lookup("Material", "$basetexture").SetValue("concrete floor")
+			},
+			expected: "Material\n{\n    $basetexture \"concrete floor\"\n    $detail detail/noise\n}\n",
+		},
+		"empty one line block": {
+			input: `"a" {}`,
+			edit: func(doc *govdf.Document) {
+				doc.Lookup("a").Block().Set("b", "c")
+			},
+			expected: "\"a\" {\n\t\"b\" \"c\"\n}",
+		},
+		"set in one line block": {
+			input: "\"root\"\n{\n\t\"sub\" { \"x\" \"y\" }\n}\n",
+			edit: func(doc *govdf.Document) {
+				doc.Lookup("root", "sub").Block().Set("z", "w")
+			},
+			expected: "\"root\"\n{\n\t\"sub\" { \"x\" \"y\"\n\t\t\"z\" \"w\"\n\t}\n}\n",
+		},
+		"insert at start of one line block": {
+			input: "\"sub\" { \"x\" \"y\" }\n",
+			edit: func(doc *govdf.Document) {
+				doc.Lookup("sub").Block().Insert(0, "a", "b")
+			},
+			expected: "\"sub\" {\n\t\"a\" \"b\"\n\t\"x\" \"y\"\n}\n",
+		},
+		"insert before entry on its own line": {
+			input: "\"sub\" {\n\t\"x\" \"y\"\n}\n",
+			edit: func(doc *govdf.Document) {
+				doc.Lookup("sub").Block().Insert(0, "a", "b")
+			},
+			expected: "\"sub\" {\n\t\"a\" \"b\"\n\t\"x\" \"y\"\n}\n",
+		},
+		"append to document without trailing newline": {
+			input: `"a" "b"`,
+			edit: func(doc *govdf.Document) {
+				doc.Root().Set("c", "d")
+			},
+			expected: "\"a\" \"b\"\n\"c\" \"d\"\n",
+		},
+		"escape sequences": {
+			input:   `"a" "b"`,
+			options: []govdf.Option{govdf.WithEscapeSequences()},
+			edit: func(doc *govdf.Document) {
+				doc.Lookup("a").SetValue("say \"hi\"\n")
+			},
+			expected: `"a" "say \"hi\"\n"`,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Arrange: Parse the input into a document.
+			doc, err := govdf.ParseDocument([]byte(tc.input), tc.options...)
+			require.NoError(t, err)
+
+			// Act: Edit the document.
+			tc.edit(doc)
+
+			// Assert: The new text should follow the style of the document.
+			require.Equal(t, tc.expected, doc.String())
+		})
+	}
+}
+
+func TestDocument_Node(t *testing.T) {
+	t.Parallel()
+
+	// Arrange: Parse a document and edit it.
+	doc, err := govdf.ParseDocument([]byte("\"root\" { \"a\" \"1\" \"wave\" \"x\" \"wave\" \"y\" }"))
+	require.NoError(t, err)
+	doc.Lookup("root").Block().Set("a", "2")
+
+	var root = doc.Lookup("root").Block()
+	require.Len(t, root.Entries(), 3)
+	require.Equal(t, "wave", root.Entries()[2].Key())
+	require.Equal(t, "y", root.Entries()[2].Value())
+
+	// Act: Convert the document into a node.
+	node, err := doc.Node()
+	require.NoError(t, err)
+
+	// Assert: The node should reflect the edit.
+	require.Equal(t, "2", node.Children["root"].Children["a"].Value)
+}
+
+func TestDocument_Errors(t *testing.T) {
+	t.Parallel()
+
+	var testCases = map[string]struct {
+		input       string
+		options     []govdf.Option
+		errorSubstr string
+	}{
+		"unexpected closing brace": {
+			input:       `"a" "b" }`,
+			errorSubstr: "unexpected '}' at root level",
+		},
+		"missing value": {
+			input:       `"a" }`,
+			errorSubstr: "expected value after key",
+		},
+		"conditional without key": {
+			input:       `[$WIN32] "a" "b"`,
+			errorSubstr: "unexpected token",
+		},
+		"unclosed map": {
+			input:       "\"a\" {\n\t\"b\" { \"c\" \"d\" }\n",
+			errorSubstr: "line 1, column 5: unclosed '{'",
+		},
+		"unterminated string": {
+			input:       `"a" "b`,
+			errorSubstr: "line 1, column 5: unterminated string",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := govdf.ParseDocument([]byte(tc.input), tc.options...)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.errorSubstr)
+		})
+	}
+}
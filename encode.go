@@ -2,12 +2,16 @@ package govdf
 
 import (
 	"bytes"
+	"context"
+	"encoding"
 	"fmt"
 	"io"
 	"reflect"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/lewisgibson/go-vdf/internal"
 )
@@ -46,8 +50,14 @@ type Marshaler interface {
 }
 
 // Marshal returns the VDF encoding of v.
-// The input v can be a struct, a *Node, or any type implementing Marshaler.
-// Struct fields are mapped to VDF keys using the "vdf" struct tag.
+// The input v can be a struct, a map, an OrderedMap, a *Node, or any type implementing Marshaler.
+// Struct fields are mapped to VDF keys using the "vdf" struct tag, and the keys of maps are sorted.
+// The fields of embedded structs, and of struct fields tagged with the inline option, are written
+// in the block of the struct itself, following the rules of encoding/json.
+// Values implementing encoding.TextMarshaler are written as scalars, as are fmt.Stringer values
+// of fields tagged with the stringer option, such as `vdf:"timeout,stringer"`. Marshaler takes
+// precedence over both. Unmarshal reads a time.Duration back from its String form, but other
+// stringer values can only be read back when they implement encoding.TextUnmarshaler.
 //
 // Example:
 //
@@ -57,10 +67,10 @@ type Marshaler interface {
 //	}
 //	config := Config{Name: "server", Port: 8080}
 //	vdfData, err := govdf.Marshal(config)
-func Marshal(in any) ([]byte, error) {
+func Marshal(in any, opts ...Option) ([]byte, error) {
 	var buffer = getBuffer()
 	defer putBuffer(buffer)
-	if err := NewEncoder(buffer).Encode(in); err != nil {
+	if err := NewEncoder(buffer, opts...).Encode(in); err != nil {
 		return nil, err
 	}
 	// Copy the data to avoid race condition when buffer is reused
@@ -70,19 +80,27 @@ func Marshal(in any) ([]byte, error) {
 // Encoder writes VDF values to an output stream.
 // It provides streaming encoding capabilities and is not safe for concurrent use.
 type Encoder struct {
-	w io.Writer
+	w    io.Writer
+	opts options
+
+	// Checks the context of EncodeContext for cancellation, and counts the bytes it has written
+	cancel  contextChecker
+	written *countingWriter
 }
 
 // NewEncoder returns a new encoder that writes to w.
 // The encoder will write properly formatted VDF data to the provided writer.
-func NewEncoder(w io.Writer) *Encoder {
+// The output can be customised with options such as WithUnquotedStrings.
+func NewEncoder(w io.Writer, opts ...Option) *Encoder {
+	var o = newOptions(opts)
 	return &Encoder{
-		w: w,
+		w:    newTextWriter(w, o.encoding),
+		opts: o,
 	}
 }
 
 // Encode writes the VDF encoding of v to the stream.
-// The input v can be a struct, a *Node, or any type implementing Marshaler.
+// The input v can be a struct, a map, an OrderedMap, a *Node, or any type implementing Marshaler.
 // The output is properly formatted with indentation and preserved comments.
 func (e *Encoder) Encode(v any) error {
 	if v == nil {
@@ -115,6 +133,30 @@ func (e *Encoder) Encode(v any) error {
 	return e.encodeNode(node, 0)
 }
 
+// EncodeContext is like Encode, but stops when ctx is cancelled or its deadline passes.
+// The context is checked periodically while writing entries, and its error is returned
+// wrapped with the number of bytes written so far.
+func (e *Encoder) EncodeContext(ctx context.Context, v any) error {
+	var w = e.w
+	e.written = &countingWriter{w: w}
+	e.w, e.cancel = e.written, contextChecker{ctx: ctx}
+	defer func() { e.w, e.cancel, e.written = w, contextChecker{}, nil }()
+
+	if err := e.checkContext(); err != nil {
+		return err
+	}
+	return e.Encode(v)
+}
+
+// checkContext returns the error of the context of EncodeContext, wrapped with the output offset,
+// when it is done.
+func (e *Encoder) checkContext() error {
+	if err := e.cancel.check(); err != nil {
+		return fmt.Errorf("offset %d: %w", e.written.n, err)
+	}
+	return nil
+}
+
 // encodeNode writes a Node to the output stream with proper indentation.
 // This is an internal method that handles the actual VDF formatting and output.
 func (e *Encoder) encodeNode(node *Node, indent int) error {
@@ -137,76 +179,114 @@ func (e *Encoder) encodeNode(node *Node, indent int) error {
 // encodeMap writes a map node to the output stream.
 // This method handles the formatting of VDF key-value pairs and nested structures.
 func (e *Encoder) encodeMap(node *Node, indent int) error {
-	if len(node.Children) == 0 {
-		return nil
+	// Write directives at the top of the document
+	for _, directive := range node.Directives {
+		if _, err := io.WriteString(e.w, directive.Kind.String()+" "); err != nil {
+			return err
+		}
+		if err := e.writeQuotedString(directive.Path); err != nil {
+			return err
+		}
+		if _, err := e.w.Write([]byte("\n")); err != nil {
+			return err
+		}
 	}
 
-	// Get sorted keys for deterministic output
-	var keys = make([]string, 0, len(node.Children))
-	for key := range node.Children {
-		keys = append(keys, key)
+	// Write each key-value pair in source order, including every occurrence of duplicate keys
+	for _, child := range node.entries(e.opts.sortedKeys) {
+		if child.node == nil {
+			continue
+		}
+		if err := e.encodeEntry(child.key, child.node, indent); err != nil {
+			return err
+		}
 	}
-	sort.Strings(keys)
 
-	// Write each key-value pair
-	for _, key := range keys {
-		var child = node.Children[key]
-		if child == nil {
-			continue
+	// Write the comments that follow the last child
+	if node.FootComment != "" {
+		if err := e.writeHeadComment(node.FootComment, indent); err != nil {
+			return err
 		}
+	}
 
-		// Write head comment if present for this child
-		if child.HeadComment != "" {
-			if err := e.writeHeadComment(child.HeadComment, indent); err != nil {
-				return err
-			}
+	return nil
+}
+
+// encodeEntry writes a single key-value pair of a map node.
+func (e *Encoder) encodeEntry(key string, child *Node, indent int) error {
+	if err := e.checkContext(); err != nil {
+		return err
+	}
+
+	// Write head comment if present for this child
+	if child.HeadComment != "" {
+		if err := e.writeHeadComment(child.HeadComment, indent); err != nil {
+			return err
 		}
+	}
 
-		// Write the key
+	// Write the key
+	if err := e.writeIndent(indent); err != nil {
+		return err
+	}
+	if err := e.writeString(key); err != nil {
+		return err
+	}
+
+	// Write the value based on its type
+	switch child.Type {
+	case NodeTypeMap:
+		// Write conditional if present
+		if err := e.writeCondition(child.Condition); err != nil {
+			return err
+		}
+		// Write opening brace and its line comment
+		if _, err := e.w.Write([]byte(" {")); err != nil {
+			return err
+		}
+		if err := e.writeLineComment(child.LineComment); err != nil {
+			return err
+		}
+		if _, err := e.w.Write([]byte("\n")); err != nil {
+			return err
+		}
+		// Write map contents
+		if err := e.encodeMap(child, indent+1); err != nil {
+			return err
+		}
+		// Write closing brace
 		if err := e.writeIndent(indent); err != nil {
 			return err
 		}
-		if err := e.writeQuotedString(key); err != nil {
+		if _, err := e.w.Write([]byte("}")); err != nil {
+			return err
+		}
+		if err := e.writeLineComment(child.EndComment); err != nil {
+			return err
+		}
+		if _, err := e.w.Write([]byte("\n")); err != nil {
 			return err
 		}
 
-		// Write the value based on its type
-		switch child.Type {
-		case NodeTypeMap:
-			// Write opening brace
-			if _, err := e.w.Write([]byte(" {\n")); err != nil {
-				return err
-			}
-			// Write map contents
-			if err := e.encodeMap(child, indent+1); err != nil {
-				return err
-			}
-			// Write closing brace
-			if err := e.writeIndent(indent); err != nil {
-				return err
-			}
-			if _, err := e.w.Write([]byte("}\n")); err != nil {
-				return err
-			}
-
-		case NodeTypeScalar:
-			// Write space before value
-			if _, err := e.w.Write([]byte(" ")); err != nil {
-				return err
-			}
-			// Write scalar value
-			if err := e.writeQuotedString(child.Value); err != nil {
-				return err
-			}
-			// Write line comment if present
-			if child.LineComment != "" {
-				if _, err := e.w.Write([]byte("\t// " + child.LineComment)); err != nil {
-					return err
-				}
-			}
-			if _, err := e.w.Write([]byte("\n")); err != nil {
-				return err
-			}
+	case NodeTypeScalar:
+		// Write space before value
+		if _, err := e.w.Write([]byte(" ")); err != nil {
+			return err
+		}
+		// Write scalar value
+		if err := e.writeString(child.Value); err != nil {
+			return err
+		}
+		// Write conditional if present
+		if err := e.writeCondition(child.Condition); err != nil {
+			return err
+		}
+		// Write line comment if present
+		if err := e.writeLineComment(child.LineComment); err != nil {
+			return err
+		}
+		if _, err := e.w.Write([]byte("\n")); err != nil {
+			return err
 		}
 	}
 
@@ -224,15 +304,18 @@ func (e *Encoder) encodeScalar(node *Node) error {
 	}
 
 	// Write the value
-	if err := e.writeQuotedString(node.Value); err != nil {
+	if err := e.writeString(node.Value); err != nil {
+		return err
+	}
+
+	// Write conditional if present
+	if err := e.writeCondition(node.Condition); err != nil {
 		return err
 	}
 
 	// Write line comment if present
-	if node.LineComment != "" {
-		if _, err := e.w.Write([]byte("\t// " + node.LineComment)); err != nil {
-			return err
-		}
+	if err := e.writeLineComment(node.LineComment); err != nil {
+		return err
 	}
 
 	// Add newline for scalar nodes
@@ -243,6 +326,44 @@ func (e *Encoder) encodeScalar(node *Node) error {
 	return nil
 }
 
+// writeString writes a key or value, leaving it unquoted when the encoder
+// is configured to do so and the string can be read back unchanged.
+func (e *Encoder) writeString(s string) error {
+	if e.opts.unquotedStrings && canWriteUnquoted(s) {
+		_, err := io.WriteString(e.w, s)
+		return err
+	}
+	return e.writeQuotedString(s)
+}
+
+// canWriteUnquoted reports whether s can be written as an unquoted string.
+// Unquoted strings end at whitespace, braces, quotes and comments, so any string
+// containing them must be quoted. Backslashes are quoted to avoid ambiguity with escapes,
+// a leading '[' would be read as a conditional and directive names are always quoted.
+func canWriteUnquoted(s string) bool {
+	if s == "" || s[0] == '[' {
+		return false
+	}
+	if _, ok := parseDirectiveKind(s); ok {
+		return false
+	}
+
+	for i, r := range s {
+		switch {
+		case isSpace(r), unicode.IsControl(r):
+			return false
+
+		case r == '"', r == '{', r == '}', r == '\\':
+			return false
+
+		case r == '/' && (strings.HasPrefix(s[i+1:], "/") || strings.HasPrefix(s[i+1:], "*")):
+			return false
+		}
+	}
+
+	return true
+}
+
 // writeQuotedString writes a string with proper VDF quoting and escaping.
 // VDF strings are enclosed in double quotes and handle escaping internally.
 func (e *Encoder) writeQuotedString(s string) error {
@@ -250,9 +371,12 @@ func (e *Encoder) writeQuotedString(s string) error {
 		return err
 	}
 
-	// In VDF, quotes inside strings are not escaped - they're included as-is
+	// Without escape sequences quotes are included as-is
 	// The only escaping is when a quote appears at the end of a value
 	// but is not actually the end of the value (which is handled by the parser)
+	if e.opts.escapeSequences {
+		s = escapeReplacer.Replace(s)
+	}
 	if _, err := e.w.Write([]byte(s)); err != nil {
 		return err
 	}
@@ -264,6 +388,19 @@ func (e *Encoder) writeQuotedString(s string) error {
 	return nil
 }
 
+// escapeReplacer escapes the characters that have an escape sequence in quoted strings.
+var escapeReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+
+// writeCondition writes a conditional such as " [$WIN32]" after a value or before an opening brace.
+// Nothing is written when the conditional is empty.
+func (e *Encoder) writeCondition(condition string) error {
+	if condition == "" {
+		return nil
+	}
+	_, err := io.WriteString(e.w, " ["+condition+"]")
+	return err
+}
+
 // writeIndent writes the appropriate indentation spaces.
 // VDF uses 4 spaces per indentation level for consistent formatting.
 func (e *Encoder) writeIndent(indent int) error {
@@ -274,6 +411,21 @@ func (e *Encoder) writeIndent(indent int) error {
 	return nil
 }
 
+// writeLineComment writes a comment at the end of the current line.
+// Comments spanning several lines, such as those read from block comments, are written as a block comment.
+// Nothing is written when the comment is empty.
+func (e *Encoder) writeLineComment(comment string) error {
+	if comment == "" {
+		return nil
+	}
+	if strings.Contains(comment, "\n") && !strings.Contains(comment, "*/") {
+		_, err := io.WriteString(e.w, "\t/* "+comment+" */")
+		return err
+	}
+	_, err := io.WriteString(e.w, "\t// "+strings.ReplaceAll(comment, "\n", " "))
+	return err
+}
+
 // writeHeadComment writes a head comment with proper indentation.
 // Head comments appear before a VDF key-value pair and are preserved during encoding.
 func (e *Encoder) writeHeadComment(comment string, indent int) error {
@@ -300,8 +452,17 @@ func structToNode(v any) (*Node, error) {
 		val = val.Elem()
 	}
 
+	// Maps become the top-level entries of the document
+	if val.Kind() == reflect.Map || val.Type() == orderedMapType {
+		node, err := valueToNode(val, false)
+		if node == nil && err == nil {
+			node = &Node{Type: NodeTypeMap, Children: make(map[string]*Node)}
+		}
+		return node, err
+	}
+
 	if val.Kind() != reflect.Struct {
-		return nil, newValidationError(fmt.Sprintf("expected struct, got %v", val.Kind()))
+		return nil, newValidationError(fmt.Sprintf("expected struct or map, got %v", val.Kind()))
 	}
 
 	node := &Node{
@@ -309,35 +470,46 @@ func structToNode(v any) (*Node, error) {
 		Children: make(map[string]*Node),
 	}
 
-	// Process each field
-	for i := range val.NumField() {
-		// Skip unexported fields
-		var fieldType = val.Type().Field(i)
-		if !fieldType.IsExported() {
+	// Process each field, including the fields promoted from embedded structs.
+	// Defaults only apply to decoding, so an invalid one does not stop the struct from being encoded.
+	var fields, _ = typeFields(val.Type())
+	for _, info := range fields {
+		// Skip fields of nil embedded structs
+		var field = fieldByIndex(val, info.index, false)
+		if !field.IsValid() {
 			continue
 		}
 
-		// Determine the field name
-		var fieldName string
-		if vdfTag := fieldType.Tag.Get("vdf"); vdfTag != "" && vdfTag != "-" {
-			fieldName = strings.Split(vdfTag, ",")[0]
-		} else {
-			fieldName = strings.ToLower(fieldType.Name)
-		}
-
-		// Skip fields with "-" tag
-		if fieldName == "-" {
+		// Lists are written as repeated keys, or as a map of numbered elements
+		var fieldName, options = info.name, info.options
+		var style = parseListStyle(options)
+		var stringer = slices.Contains(options, "stringer")
+		if style == listRepeated && (field.Kind() == reflect.Slice || field.Kind() == reflect.Array) {
+			elems, err := listToNodes(field, stringer)
+			if err != nil {
+				return nil, err
+			}
+			for _, elem := range elems {
+				_, _ = addChild(node, fieldName, elem, DuplicateKeepAll)
+			}
 			continue
 		}
 
 		// Convert field value to node
-		childNode, err := valueToNode(val.Field(i))
+		var childNode *Node
+		var err error
+		if style == listNumberedFromOne && (field.Kind() == reflect.Slice || field.Kind() == reflect.Array) {
+			childNode, err = listToNode(field, 1, stringer)
+		} else {
+			childNode, err = valueToNode(field, stringer)
+		}
 		switch {
 		case err != nil:
 			return nil, err
 
 		case childNode != nil:
-			node.Children[fieldName] = childNode
+			// Fields are written in declaration order
+			node.set(fieldName, childNode)
 		}
 	}
 
@@ -347,20 +519,24 @@ func structToNode(v any) (*Node, error) {
 // valueToNode converts a reflect.Value to a Node.
 // This function handles the conversion of Go values to VDF nodes, including
 // custom Marshaler implementations and basic type conversions.
-func valueToNode(val reflect.Value) (*Node, error) {
-	// Handle nil pointers
-	if val.Kind() == reflect.Ptr && val.IsNil() {
+func valueToNode(val reflect.Value, stringer bool) (*Node, error) {
+	// Handle nil pointers and interfaces
+	if (val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface) && val.IsNil() {
 		return nil, nil
 	}
 
+	// Encode the value held by an interface
+	if val.Kind() == reflect.Interface {
+		return valueToNode(val.Elem(), stringer)
+	}
+
 	// Dereference pointers
 	if val.Kind() == reflect.Ptr {
 		val = val.Elem()
 	}
 
 	// Check for custom Marshaler interface
-	if val.CanAddr() && val.Addr().Type().Implements(reflect.TypeOf((*Marshaler)(nil)).Elem()) {
-		marshaler := val.Addr().Interface().(Marshaler)
+	if marshaler, ok := implements[Marshaler](val); ok {
 		data, err := marshaler.MarshalVDF()
 		if err != nil {
 			return nil, err
@@ -375,10 +551,29 @@ func valueToNode(val reflect.Value) (*Node, error) {
 		return &tempNode, nil
 	}
 
+	// Check for encoding.TextMarshaler, and fmt.Stringer when the field opts in
+	if marshaler, ok := implements[encoding.TextMarshaler](val); ok {
+		text, err := marshaler.MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		return &Node{Type: NodeTypeScalar, Value: string(text)}, nil
+	}
+	if s, ok := implements[fmt.Stringer](val); ok && stringer {
+		return &Node{Type: NodeTypeScalar, Value: s.String()}, nil
+	}
+
+	if val.Type() == orderedMapType {
+		return orderedMapToNode(val.Interface().(OrderedMap))
+	}
+
 	switch val.Kind() {
 	case reflect.Struct:
 		return structToNode(val.Interface())
 
+	case reflect.Map:
+		return mapToNode(val, stringer)
+
 	case reflect.String:
 		return &Node{
 			Type:  NodeTypeScalar,
@@ -409,7 +604,138 @@ func valueToNode(val reflect.Value) (*Node, error) {
 			Value: strconv.FormatFloat(val.Float(), 'g', -1, 64),
 		}, nil
 
+	case reflect.Slice, reflect.Array:
+		return listToNode(val, 0, stringer)
+
 	default:
 		return nil, newValidationError(fmt.Sprintf("unsupported type for encoding: %v", val.Kind()))
 	}
 }
+
+// listToNode converts a slice or array to a map node whose keys number its elements from base.
+// A nil slice is skipped like a nil pointer.
+func listToNode(val reflect.Value, base int, stringer bool) (*Node, error) {
+	if val.Kind() == reflect.Slice && val.IsNil() {
+		return nil, nil
+	}
+
+	elems, err := listToNodes(val, stringer)
+	if err != nil {
+		return nil, err
+	}
+
+	var node = &Node{Type: NodeTypeMap, Children: make(map[string]*Node, len(elems))}
+	for i, elem := range elems {
+		node.set(strconv.Itoa(base+i), elem)
+	}
+	return node, nil
+}
+
+// listToNodes converts the elements of a slice or array to nodes.
+// Elements must not be nil, since skipping them would renumber the rest.
+func listToNodes(val reflect.Value, stringer bool) ([]*Node, error) {
+	var nodes = make([]*Node, val.Len())
+	for i := range nodes {
+		node, err := valueToNode(val.Index(i), stringer)
+		switch {
+		case err != nil:
+			return nil, err
+
+		case node == nil:
+			return nil, newValidationError(fmt.Sprintf("cannot encode nil element %d of %v", i, val.Type()))
+		}
+		nodes[i] = node
+	}
+	return nodes, nil
+}
+
+// mapToNode converts a map with string or integer keys to a map node with its keys sorted,
+// so that the output does not depend on the iteration order of the map. A nil map is skipped.
+func mapToNode(val reflect.Value, stringer bool) (*Node, error) {
+	if val.IsNil() {
+		return nil, nil
+	}
+
+	var keys = make([]string, 0, val.Len())
+	var values = make(map[string]reflect.Value, val.Len())
+	for iter := val.MapRange(); iter.Next(); {
+		var key string
+		var k = iter.Key()
+		if marshaler, ok := implements[encoding.TextMarshaler](k); ok {
+			text, err := marshaler.MarshalText()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, string(text))
+			values[string(text)] = iter.Value()
+			continue
+		}
+
+		switch k.Kind() {
+		case reflect.String:
+			key = k.String()
+
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			key = strconv.FormatInt(k.Int(), 10)
+
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			key = strconv.FormatUint(k.Uint(), 10)
+
+		default:
+			return nil, newValidationError(fmt.Sprintf("unsupported type for map key: %v", k.Type()))
+		}
+		keys = append(keys, key)
+		values[key] = iter.Value()
+	}
+	sort.Strings(keys)
+
+	var node = &Node{Type: NodeTypeMap, Children: make(map[string]*Node, len(keys))}
+	for _, key := range keys {
+		child, err := valueToNode(values[key], stringer)
+		switch {
+		case err != nil:
+			return nil, err
+
+		case child != nil:
+			node.set(key, child)
+		}
+	}
+	return node, nil
+}
+
+// orderedMapToNode converts an OrderedMap to a map node, keeping its entries in order
+// and writing repeated keys again. Entries with a nil value are skipped.
+func orderedMapToNode(m OrderedMap) (*Node, error) {
+	if m == nil {
+		return nil, nil
+	}
+
+	var node = &Node{Type: NodeTypeMap, Children: make(map[string]*Node, len(m))}
+	for _, entry := range m {
+		child, err := valueToNode(reflect.ValueOf(&entry.Value).Elem(), false)
+		switch {
+		case err != nil:
+			return nil, err
+
+		case child != nil:
+			_, _ = addChild(node, entry.Key, child, DuplicateKeepAll)
+		}
+	}
+	return node, nil
+}
+
+// implements returns val as an implementation of the interface T, taking its address
+// when only its pointer type implements T.
+func implements[T any](val reflect.Value) (T, bool) {
+	var iface = reflect.TypeOf((*T)(nil)).Elem()
+	switch {
+	case val.Type().Implements(iface):
+		return val.Interface().(T), true
+
+	case val.CanAddr() && val.Addr().Type().Implements(iface):
+		return val.Addr().Interface().(T), true
+	}
+
+	var zero T
+	return zero, false
+}
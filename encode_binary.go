@@ -2,10 +2,10 @@ package govdf
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
-	"sort"
 	"strconv"
 
 	"github.com/lewisgibson/go-vdf/internal"
@@ -29,7 +29,7 @@ func putBinaryBuffer(b *bytes.Buffer) {
 }
 
 // MarshalBinary returns the binary VDF encoding of v.
-// The input v can be a *Node or a struct with vdf struct tags.
+// The input v can be a *Node, a struct with vdf struct tags, a map or an OrderedMap.
 // Binary VDF is Valve's binary serialization of the KeyValues format,
 // using type-tagged fields with null-terminated strings.
 //
@@ -44,10 +44,10 @@ func putBinaryBuffer(b *bytes.Buffer) {
 //	}
 //	root := Root{AppInfo: AppInfo{AppID: "730", Name: "Counter-Strike 2"}}
 //	data, err := govdf.MarshalBinary(root)
-func MarshalBinary(in any) ([]byte, error) {
+func MarshalBinary(in any, opts ...Option) ([]byte, error) {
 	var buffer = getBinaryBuffer()
 	defer putBinaryBuffer(buffer)
-	if err := NewBinaryEncoder(buffer).Encode(in); err != nil {
+	if err := NewBinaryEncoder(buffer, opts...).Encode(in); err != nil {
 		return nil, err
 	}
 	// Copy the data to avoid race condition when buffer is reused
@@ -57,16 +57,22 @@ func MarshalBinary(in any) ([]byte, error) {
 // BinaryEncoder writes binary VDF values to an output stream.
 // It provides streaming encoding capabilities and is not safe for concurrent use.
 type BinaryEncoder struct {
-	w io.Writer
+	w    io.Writer
+	opts options
+
+	// Checks the context of EncodeContext for cancellation, and counts the bytes it has written
+	cancel  contextChecker
+	written *countingWriter
 }
 
 // NewBinaryEncoder returns a new binary VDF encoder that writes to w.
-func NewBinaryEncoder(w io.Writer) *BinaryEncoder {
-	return &BinaryEncoder{w: w}
+// Encoding can be customised with options such as WithSortedKeys.
+func NewBinaryEncoder(w io.Writer, opts ...Option) *BinaryEncoder {
+	return &BinaryEncoder{w: w, opts: newOptions(opts)}
 }
 
 // Encode writes the binary VDF encoding of v to the stream.
-// The input v can be a *Node or a struct with vdf struct tags.
+// The input v can be a *Node, a struct with vdf struct tags, a map or an OrderedMap.
 // The output uses Valve's binary type-tagged format with null-terminated strings.
 func (e *BinaryEncoder) Encode(v any) error {
 	if v == nil {
@@ -85,6 +91,30 @@ func (e *BinaryEncoder) Encode(v any) error {
 	return e.encodeRoot(node)
 }
 
+// EncodeContext is like Encode, but stops when ctx is cancelled or its deadline passes.
+// The context is checked periodically while writing fields, and its error is returned
+// wrapped with the number of bytes written so far.
+func (e *BinaryEncoder) EncodeContext(ctx context.Context, v any) error {
+	var w = e.w
+	e.written = &countingWriter{w: w}
+	e.w, e.cancel = e.written, contextChecker{ctx: ctx}
+	defer func() { e.w, e.cancel, e.written = w, contextChecker{}, nil }()
+
+	if err := e.checkContext(); err != nil {
+		return err
+	}
+	return e.Encode(v)
+}
+
+// checkContext returns the error of the context of EncodeContext, wrapped with the output offset,
+// when it is done.
+func (e *BinaryEncoder) checkContext() error {
+	if err := e.cancel.check(); err != nil {
+		return fmt.Errorf("offset %d: %w", e.written.n, err)
+	}
+	return nil
+}
+
 // encodeRoot writes the root-level Node as a binary VDF object.
 func (e *BinaryEncoder) encodeRoot(node *Node) error {
 	if node == nil {
@@ -96,42 +126,40 @@ func (e *BinaryEncoder) encodeRoot(node *Node) error {
 
 // encodeObject writes a map Node's children as binary VDF fields.
 func (e *BinaryEncoder) encodeObject(node *Node) error {
-	// Get sorted keys for deterministic output
-	var keys = make([]string, 0, len(node.Children))
-	for key := range node.Children {
-		keys = append(keys, key)
-	}
-	sort.Strings(keys)
-
-	// Write each key-value pair
-	for _, key := range keys {
-		var child = node.Children[key]
-		if child == nil {
+	// Write each key-value pair in source order, including every occurrence of duplicate keys
+	for _, child := range node.entries(e.opts.sortedKeys) {
+		if child.node == nil {
 			continue
 		}
-
-		switch child.Type {
-		case NodeTypeMap:
-			if err := e.writeObjectTag(key); err != nil {
-				return err
-			}
-			if err := e.encodeObject(child); err != nil {
-				return err
-			}
-
-		case NodeTypeScalar:
-			if err := e.writeScalar(key, child.Value); err != nil {
-				return err
-			}
-
-		default:
-			return fmt.Errorf("unknown node type: %d", child.Type)
+		if err := e.encodeField(child.key, child.node); err != nil {
+			return err
 		}
 	}
 
 	return e.writeByte(binaryTypeEnd)
 }
 
+// encodeField writes a single child of a map Node as a binary VDF field.
+func (e *BinaryEncoder) encodeField(key string, child *Node) error {
+	if err := e.checkContext(); err != nil {
+		return err
+	}
+
+	switch child.Type {
+	case NodeTypeMap:
+		if err := e.writeObjectTag(key); err != nil {
+			return err
+		}
+		return e.encodeObject(child)
+
+	case NodeTypeScalar:
+		return e.writeScalar(key, child.Value)
+
+	default:
+		return fmt.Errorf("unknown node type: %d", child.Type)
+	}
+}
+
 // writeScalar writes a scalar value with the appropriate binary VDF type tag.
 // Integer values are written as int32, all others as strings.
 func (e *BinaryEncoder) writeScalar(key, value string) error {
@@ -494,3 +494,35 @@ func TestEncodeBinary_UnknownNodeType(t *testing.T) {
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "unknown node type")
 }
+
+func TestEncodeBinary_KeyOrder(t *testing.T) {
+	t.Parallel()
+
+	var original bytes.Buffer
+	writeObject(&original, "config")
+	writeString(&original, "zeta", "z")
+	writeString(&original, "alpha", "a")
+	writeString(&original, "mid", "m")
+	writeEnd(&original) // end config
+	writeEnd(&original) // end root
+
+	var node govdf.Node
+	require.NoError(t, govdf.UnmarshalBinary(original.Bytes(), &node))
+	require.Equal(t, []string{"zeta", "alpha", "mid"}, node.Children["config"].Keys)
+
+	// Act: Re-encode the decoded node.
+	encoded, err := govdf.MarshalBinary(&node)
+	require.NoError(t, err)
+
+	// Assert: The output should be byte-for-byte identical.
+	require.Equal(t, original.Bytes(), encoded)
+
+	// Act: Re-encode with sorted keys.
+	sorted, err := govdf.MarshalBinary(&node, govdf.WithSortedKeys())
+	require.NoError(t, err)
+
+	// Assert: The keys should be written alphabetically.
+	var decoded govdf.Node
+	require.NoError(t, govdf.UnmarshalBinary(sorted, &decoded))
+	require.Equal(t, []string{"alpha", "mid", "zeta"}, decoded.Children["config"].Keys)
+}
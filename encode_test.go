@@ -3,9 +3,13 @@ package govdf_test
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"math/big"
+	"net/netip"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -130,8 +134,8 @@ func TestEncode_Struct(t *testing.T) {
 				}
 			},
 			expected: strings.Join([]string{
-				`"age" "30"`,
 				`"name" "John"`,
+				`"age" "30"`,
 			}, "\n"),
 		},
 		"nested struct": {
@@ -152,8 +156,8 @@ func TestEncode_Struct(t *testing.T) {
 			},
 			expected: strings.Join([]string{
 				`"user" {`,
-				`    "age" "30"`,
 				`    "name" "John"`,
+				`    "age" "30"`,
 				`}`,
 			}, "\n"),
 		},
@@ -173,10 +177,10 @@ func TestEncode_Struct(t *testing.T) {
 				}
 			},
 			expected: strings.Join([]string{
+				`"string_field" "hello world"`,
+				`"int_field" "42"`,
 				`"bool_field" "true"`,
 				`"float_field" "3.14159"`,
-				`"int_field" "42"`,
-				`"string_field" "hello world"`,
 			}, "\n"),
 		},
 		"optional pointer structs": {
@@ -197,16 +201,64 @@ func TestEncode_Struct(t *testing.T) {
 				}
 			},
 			expected: strings.Join([]string{
+				`"required" {`,
+				`    "name" "John"`,
+				`    "age" "30"`,
+				`}`,
 				`"optional" {`,
-				`    "age" "25"`,
 				`    "name" "Jane"`,
+				`    "age" "25"`,
 				`}`,
-				`"required" {`,
-				`    "age" "30"`,
-				`    "name" "John"`,
+			}, "\n"),
+		},
+		"numbered list": {
+			input: func() any {
+				type Bot struct {
+					Name string `vdf:"name"`
+				}
+				type Lists struct {
+					Maps  []string `vdf:"maps"`
+					Bots  [2]Bot   `vdf:"bots,list=1"`
+					Empty []string `vdf:"empty"`
+					Nil   []string `vdf:"nil"`
+				}
+				return Lists{
+					Maps:  []string{"de_dust2", "de_inferno"},
+					Bots:  [2]Bot{{Name: "Rock"}, {Name: "Vitaliy"}},
+					Empty: []string{},
+				}
+			},
+			expected: strings.Join([]string{
+				`"maps" {`,
+				`    "0" "de_dust2"`,
+				`    "1" "de_inferno"`,
+				`}`,
+				`"bots" {`,
+				`    "1" {`,
+				`        "name" "Rock"`,
+				`    }`,
+				`    "2" {`,
+				`        "name" "Vitaliy"`,
+				`    }`,
+				`}`,
+				`"empty" {`,
 				`}`,
 			}, "\n"),
 		},
+		"repeated list": {
+			input: func() any {
+				type RandomWave struct {
+					Waves []string `vdf:"wave,list=repeated"`
+					Pitch int      `vdf:"pitch"`
+				}
+				return RandomWave{Waves: []string{"a.wav", "b.wav"}, Pitch: 100}
+			},
+			expected: strings.Join([]string{
+				`"wave" "a.wav"`,
+				`"wave" "b.wav"`,
+				`"pitch" "100"`,
+			}, "\n"),
+		},
 		"custom marshaler": {
 			input: func() any {
 				return &mockMarshaler{value: "test_value"}
@@ -262,7 +314,7 @@ func TestEncode_Fixtures(t *testing.T) {
 				require.NoError(t, json.Unmarshal(jsonBytes, &jsonNode))
 
 				// Assert: the json node should match the vdf node.
-				var ignore = cmpopts.IgnoreFields(govdf.Node{}, "Line", "Column", "HeadComment", "LineComment")
+				var ignore = cmpopts.IgnoreFields(govdf.Node{}, "Line", "Column", "KeyRange", "ValueRange", "HeadComment", "LineComment", "FootComment", "EndComment", "Keys")
 				if diff := cmp.Diff(vdfNode, jsonNode, ignore); diff != "" {
 					t.Errorf("VDF and JSON nodes are not structurally identical (-want +got):\n%s", diff)
 				}
@@ -465,6 +517,12 @@ func TestEncode_WriterErrors(t *testing.T) {
 				},
 			},
 		},
+		"encodeMap foot comment write error": {
+			node: &govdf.Node{
+				Type:        govdf.NodeTypeMap,
+				FootComment: "comment",
+			},
+		},
 		"writeIndent write error": {
 			node: &govdf.Node{
 				Type: govdf.NodeTypeMap,
@@ -810,17 +868,17 @@ world"`,
 				}
 			},
 			expected: strings.Join([]string{
-				`"bool" "true"`,
-				`"float32" "3.140000104904175"`,
-				`"float64" "3.14159265359"`,
+				`"int8" "127"`,
 				`"int16" "32767"`,
 				`"int32" "2147483647"`,
 				`"int64" "9223372036854775807"`,
-				`"int8" "127"`,
+				`"uint8" "255"`,
 				`"uint16" "65535"`,
 				`"uint32" "4294967295"`,
 				`"uint64" "18446744073709551615"`,
-				`"uint8" "255"`,
+				`"float32" "3.140000104904175"`,
+				`"float64" "3.14159265359"`,
+				`"bool" "true"`,
 			}, "\n"),
 		},
 		"pointer to struct": {
@@ -866,8 +924,8 @@ world"`,
 				}
 			},
 			expected: strings.Join([]string{
-				`"hidden" "hidden"`,
 				`"visible" "visible"`,
+				`"hidden" "hidden"`,
 			}, "\n"),
 		},
 		"custom marshaler": {
@@ -895,10 +953,10 @@ world"`,
 			},
 			expected: strings.Join([]string{
 				`"uint" "42"`,
+				`"uint8" "255"`,
 				`"uint16" "65535"`,
 				`"uint32" "4294967295"`,
 				`"uint64" "18446744073709551615"`,
-				`"uint8" "255"`,
 			}, "\n"),
 		},
 		"int types": {
@@ -920,10 +978,10 @@ world"`,
 			},
 			expected: strings.Join([]string{
 				`"int" "-1"`,
+				`"int8" "-128"`,
 				`"int16" "-32768"`,
 				`"int32" "-2147483648"`,
 				`"int64" "-9223372036854775808"`,
-				`"int8" "-128"`,
 			}, "\n"),
 		},
 		"float types": {
@@ -954,8 +1012,8 @@ world"`,
 				}
 			},
 			expected: strings.Join([]string{
-				`"false_field" "false"`,
 				`"true_field" "true"`,
+				`"false_field" "false"`,
 			}, "\n"),
 		},
 	}
@@ -985,6 +1043,364 @@ func TestEncode_UnsupportedFieldType(t *testing.T) {
 	require.Contains(t, err.Error(), "unsupported type")
 }
 
+func TestEncode_Generic(t *testing.T) {
+	t.Parallel()
+
+	var testCases = map[string]struct {
+		input    any
+		expected string
+	}{
+		"map of any": {
+			input: map[string]any{
+				"b":     "2",
+				"a":     map[string]int{"y": 2, "x": 1},
+				"list":  []any{"first", "second"},
+				"skip":  nil,
+				"inner": map[int]any{2: "two", 1: "one"},
+			},
+			expected: strings.Join([]string{
+				`"a" {`,
+				`    "x" "1"`,
+				`    "y" "2"`,
+				`}`,
+				`"b" "2"`,
+				`"inner" {`,
+				`    "1" "one"`,
+				`    "2" "two"`,
+				`}`,
+				`"list" {`,
+				`    "0" "first"`,
+				`    "1" "second"`,
+				`}`,
+			}, "\n"),
+		},
+		"ordered map": {
+			input: govdf.OrderedMap{
+				{Key: "wave", Value: "b.wav"},
+				{Key: "pitch", Value: 100},
+				{Key: "wave", Value: "a.wav"},
+				{Key: "nested", Value: govdf.OrderedMap{{Key: "z", Value: "1"}, {Key: "a", Value: "2"}}},
+			},
+			expected: strings.Join([]string{
+				`"wave" "b.wav"`,
+				`"pitch" "100"`,
+				`"wave" "a.wav"`,
+				`"nested" {`,
+				`    "z" "1"`,
+				`    "a" "2"`,
+				`}`,
+			}, "\n"),
+		},
+		"struct with generic fields": {
+			input: struct {
+				Value any            `vdf:"value"`
+				Extra map[string]any `vdf:"extra"`
+				Nil   any            `vdf:"nil"`
+			}{Value: 1.5, Extra: map[string]any{"k": true}},
+			expected: strings.Join([]string{
+				`"value" "1.5"`,
+				`"extra" {`,
+				`    "k" "true"`,
+				`}`,
+			}, "\n"),
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act: Marshal the value into VDF.
+			result, err := govdf.Marshal(tc.input)
+
+			// Assert: The output should match the expected output.
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, strings.TrimSpace(string(result)))
+		})
+	}
+}
+
+func TestEncode_Embedded(t *testing.T) {
+	t.Parallel()
+
+	type BaseItem struct {
+		Name   string `vdf:"name"`
+		Rarity string `vdf:"rarity"`
+	}
+	type Stats struct {
+		Damage int `vdf:"damage"`
+	}
+	type Sounds struct {
+		Fire string `vdf:"fire_sound"`
+	}
+	type A struct {
+		Value string `vdf:"value"`
+	}
+	type B struct {
+		Value string `vdf:"value"`
+	}
+	type Weapon struct {
+		ID int `vdf:"id"`
+		BaseItem
+		*Stats
+		A
+		B
+		Sounds Sounds   `vdf:",inline"`
+		Rarity string   `vdf:"rarity"`
+		Tagged BaseItem `vdf:"tagged"`
+	}
+
+	var testCases = map[string]struct {
+		input    Weapon
+		expected string
+	}{
+		"promoted": {
+			input: Weapon{
+				ID:       7,
+				BaseItem: BaseItem{Name: "ak47", Rarity: "hidden"},
+				Stats:    &Stats{Damage: 36},
+				A:        A{Value: "a"},
+				B:        B{Value: "b"},
+				Sounds:   Sounds{Fire: "ak.wav"},
+				Rarity:   "rare",
+				Tagged:   BaseItem{Name: "inner"},
+			},
+			expected: strings.Join([]string{
+				`"id" "7"`,
+				`"name" "ak47"`,
+				`"damage" "36"`,
+				`"fire_sound" "ak.wav"`,
+				`"rarity" "rare"`,
+				`"tagged" {`,
+				`    "name" "inner"`,
+				`    "rarity" ""`,
+				`}`,
+			}, "\n"),
+		},
+		"nil embedded pointer": {
+			input: Weapon{ID: 7},
+			expected: strings.Join([]string{
+				`"id" "7"`,
+				`"name" ""`,
+				`"fire_sound" ""`,
+				`"rarity" ""`,
+				`"tagged" {`,
+				`    "name" ""`,
+				`    "rarity" ""`,
+				`}`,
+			}, "\n"),
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act: Marshal the value into VDF.
+			result, err := govdf.Marshal(tc.input)
+
+			// Assert: The fields of embedded structs should be written in the struct's own block.
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, strings.TrimSpace(string(result)))
+
+			// Assert: The output should decode back into the same value.
+			var roundtrip Weapon
+			require.NoError(t, govdf.Unmarshal(result, &roundtrip))
+			var expected = tc.input
+			expected.BaseItem.Rarity, expected.A, expected.B = "", A{}, B{}
+			require.Equal(t, expected, roundtrip)
+		})
+	}
+}
+
+func TestEncode_GenericRoundtrip(t *testing.T) {
+	t.Parallel()
+
+	// Arrange: Decode a document with repeated keys into an ordered map.
+	var input = "\"sounds\" {\n    \"wave\" \"a.wav\"\n    \"wave\" \"b.wav\"\n    \"volume\" \"0.5\"\n}\n"
+	var value govdf.OrderedMap
+	require.NoError(t, govdf.Unmarshal([]byte(input), &value, govdf.WithDuplicateKeys(govdf.DuplicateKeepAll)))
+
+	// Act: Encode the ordered map.
+	result, err := govdf.Marshal(value)
+
+	// Assert: The output should match the input.
+	require.NoError(t, err)
+	require.Equal(t, input, string(result))
+}
+
+func TestEncode_UnsupportedMapKey(t *testing.T) {
+	t.Parallel()
+
+	_, err := govdf.Marshal(map[float64]string{1.5: "x"})
+	require.EqualError(t, err, "validation error: unsupported type for map key: float64")
+}
+
+// level is a type that implements fmt.Stringer for testing.
+type level int
+
+// String implements the fmt.Stringer interface for the level type.
+func (l level) String() string {
+	return fmt.Sprintf("level-%d", int(l))
+}
+
+// textAndVDFMarshaler implements both MarshalVDF and MarshalText for testing precedence.
+type textAndVDFMarshaler string
+
+// MarshalVDF implements the Marshaler interface for the textAndVDFMarshaler type.
+func (m *textAndVDFMarshaler) MarshalVDF() ([]byte, error) {
+	return []byte(`"vdf" "` + string(*m) + `"`), nil
+}
+
+// MarshalText implements the encoding.TextMarshaler interface for the textAndVDFMarshaler type.
+func (m *textAndVDFMarshaler) MarshalText() ([]byte, error) {
+	return []byte("text:" + string(*m)), nil
+}
+
+// valueTextAndVDFMarshaler implements both MarshalVDF and MarshalText on the value for testing precedence.
+type valueTextAndVDFMarshaler string
+
+// MarshalVDF implements the Marshaler interface for the valueTextAndVDFMarshaler type.
+func (m valueTextAndVDFMarshaler) MarshalVDF() ([]byte, error) {
+	return []byte(`"vdf" "` + string(m) + `"`), nil
+}
+
+// MarshalText implements the encoding.TextMarshaler interface for the valueTextAndVDFMarshaler type.
+func (m valueTextAndVDFMarshaler) MarshalText() ([]byte, error) {
+	return []byte("text:" + string(m)), nil
+}
+
+func TestEncode_TextMarshaler(t *testing.T) {
+	t.Parallel()
+
+	type Item struct {
+		Server   netip.Addr              `vdf:"server"`
+		Price    *big.Int                `vdf:"price"`
+		Timeout  time.Duration           `vdf:"timeout,stringer"`
+		Delay    time.Duration           `vdf:"delay"`
+		Levels   []level                 `vdf:"levels,stringer"`
+		Level    level                   `vdf:"level"`
+		Both     textAndVDFMarshaler     `vdf:"both"`
+		ByServer map[netip.Addr]string   `vdf:"by_server"`
+		Nil      *netip.Addr             `vdf:"nil"`
+		Texts    map[string]netip.Prefix `vdf:"texts"`
+	}
+
+	// Arrange: Create a struct with text marshalers and stringers.
+	var item = &Item{
+		Server:   netip.MustParseAddr("10.0.0.1"),
+		Price:    big.NewInt(1234),
+		Timeout:  time.Minute,
+		Delay:    time.Second,
+		Levels:   []level{1, 2},
+		Level:    3,
+		Both:     "x",
+		ByServer: map[netip.Addr]string{netip.MustParseAddr("::1"): "local6", netip.MustParseAddr("127.0.0.1"): "local"},
+		Texts:    map[string]netip.Prefix{"lan": netip.MustParsePrefix("10.0.0.0/8")},
+	}
+
+	// Act: Marshal the struct.
+	result, err := govdf.Marshal(item)
+
+	// Assert: Text marshalers should be used, with Marshaler taking precedence and stringers only when opted in.
+	require.NoError(t, err)
+	require.Equal(t, strings.Join([]string{
+		`"server" "10.0.0.1"`,
+		`"price" "1234"`,
+		`"timeout" "1m0s"`,
+		`"delay" "1000000000"`,
+		`"levels" {`,
+		`    "0" "level-1"`,
+		`    "1" "level-2"`,
+		`}`,
+		`"level" "3"`,
+		`"both" {`,
+		`    "vdf" "x"`,
+		`}`,
+		`"by_server" {`,
+		`    "127.0.0.1" "local"`,
+		`    "::1" "local6"`,
+		`}`,
+		`"texts" {`,
+		`    "lan" "10.0.0.0/8"`,
+		`}`,
+	}, "\n"), strings.TrimSpace(string(result)))
+}
+
+func TestEncode_MarshalerPrecedenceByValue(t *testing.T) {
+	t.Parallel()
+
+	type Item struct {
+		Both valueTextAndVDFMarshaler `vdf:"both"`
+	}
+
+	// Act: Marshal the struct by value and by pointer.
+	byValue, err := govdf.Marshal(Item{Both: "x"})
+	require.NoError(t, err)
+	byPointer, err := govdf.Marshal(&Item{Both: "x"})
+	require.NoError(t, err)
+
+	// Assert: Marshaler should take precedence over encoding.TextMarshaler either way.
+	var expected = strings.Join([]string{
+		`"both" {`,
+		`    "vdf" "x"`,
+		`}`,
+	}, "\n")
+	require.Equal(t, expected, strings.TrimSpace(string(byValue)))
+	require.Equal(t, expected, strings.TrimSpace(string(byPointer)))
+}
+
+func TestEncode_StringerRoundtrip(t *testing.T) {
+	t.Parallel()
+
+	type Config struct {
+		Timeout time.Duration   `vdf:"timeout,stringer"`
+		Delay   time.Duration   `vdf:"delay"`
+		Retries []time.Duration `vdf:"retries,stringer"`
+		Backoff *time.Duration  `vdf:"backoff,stringer"`
+	}
+
+	// Arrange: Create a struct with durations written by their String method and as nanoseconds.
+	var backoff = 250 * time.Millisecond
+	var config = Config{
+		Timeout: 5 * time.Second,
+		Delay:   time.Minute,
+		Retries: []time.Duration{time.Second, 90 * time.Minute},
+		Backoff: &backoff,
+	}
+
+	// Act: Encode the struct and decode the result.
+	data, err := govdf.Marshal(config)
+	require.NoError(t, err)
+	var decoded Config
+	err = govdf.Unmarshal(data, &decoded)
+
+	// Assert: The durations should be read back from either form.
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"timeout" "5s"`)
+	require.Equal(t, config, decoded)
+}
+
+func TestEncode_TextMarshalerError(t *testing.T) {
+	t.Parallel()
+
+	type Item struct {
+		Rarity rarity `vdf:"rarity"`
+	}
+
+	_, err := govdf.Marshal(Item{Rarity: 7})
+	require.EqualError(t, err, "unknown rarity 7")
+}
+
+func TestEncode_NilListElement(t *testing.T) {
+	t.Parallel()
+
+	type TestStruct struct {
+		Items []*string `vdf:"items"`
+	}
+
+	_, err := govdf.Marshal(TestStruct{Items: []*string{nil}})
+	require.EqualError(t, err, "validation error: cannot encode nil element 0 of []*string")
+}
+
 func TestEncode_CustomMarshalerInStruct(t *testing.T) {
 	t.Parallel()
 
@@ -1014,3 +1430,318 @@ func TestEncode_PointerField(t *testing.T) {
 	require.NoError(t, err)
 	require.Contains(t, string(result), "test")
 }
+
+func TestEncode_UnquotedStrings(t *testing.T) {
+	t.Parallel()
+
+	var testCases = map[string]struct {
+		node     *govdf.Node
+		expected string
+	}{
+		"safe key and value": {
+			node: &govdf.Node{
+				Type: govdf.NodeTypeMap,
+				Children: map[string]*govdf.Node{
+					"$basetexture": {Type: govdf.NodeTypeScalar, Value: "concrete/floor01"},
+				},
+			},
+			expected: `$basetexture concrete/floor01`,
+		},
+		"nested map": {
+			node: &govdf.Node{
+				Type: govdf.NodeTypeMap,
+				Children: map[string]*govdf.Node{
+					"LightmappedGeneric": {
+						Type: govdf.NodeTypeMap,
+						Children: map[string]*govdf.Node{
+							"$surfaceprop": {Type: govdf.NodeTypeScalar, Value: "concrete"},
+						},
+					},
+				},
+			},
+			expected: strings.Join([]string{
+				`LightmappedGeneric {`,
+				`    $surfaceprop concrete`,
+				`}`,
+			}, "\n"),
+		},
+		"strings that must stay quoted": {
+			node: &govdf.Node{
+				Type: govdf.NodeTypeMap,
+				Children: map[string]*govdf.Node{
+					"a":     {Type: govdf.NodeTypeScalar, Value: ""},
+					"b":     {Type: govdf.NodeTypeScalar, Value: "with space"},
+					"c":     {Type: govdf.NodeTypeScalar, Value: "with{brace"},
+					"d":     {Type: govdf.NodeTypeScalar, Value: "with//comment"},
+					"e":     {Type: govdf.NodeTypeScalar, Value: `with"quote`},
+					"f":     {Type: govdf.NodeTypeScalar, Value: `with\backslash`},
+					"g key": {Type: govdf.NodeTypeScalar, Value: "tab\tvalue"},
+				},
+			},
+			expected: strings.Join([]string{
+				`a ""`,
+				`b "with space"`,
+				`c "with{brace"`,
+				`d "with//comment"`,
+				`e "with"quote"`,
+				`f "with\backslash"`,
+				`"g key" "tab	value"`,
+			}, "\n"),
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act: Marshal the node into VDF without quotes.
+			result, err := govdf.Marshal(tc.node, govdf.WithUnquotedStrings())
+			require.NoError(t, err)
+
+			// Assert: The output should only quote strings that require it.
+			require.Equal(t, strings.TrimSpace(tc.expected), strings.TrimSpace(string(result)))
+		})
+	}
+}
+
+func TestEncode_UnquotedStringsRoundtrip(t *testing.T) {
+	t.Parallel()
+
+	// Arrange: Create a node with a mixture of safe and unsafe strings.
+	node := &govdf.Node{
+		Type: govdf.NodeTypeMap,
+		Children: map[string]*govdf.Node{
+			"material": {
+				Type: govdf.NodeTypeMap,
+				Children: map[string]*govdf.Node{
+					"$basetexture": {Type: govdf.NodeTypeScalar, Value: "concrete/floor01"},
+					"$detail":      {Type: govdf.NodeTypeScalar, Value: "detail/noise_detail_01"},
+					"name":         {Type: govdf.NodeTypeScalar, Value: "Concrete Floor"},
+					"empty":        {Type: govdf.NodeTypeScalar, Value: ""},
+				},
+			},
+		},
+	}
+
+	// Act: Marshal without quotes and unmarshal the result.
+	data, err := govdf.Marshal(node, govdf.WithUnquotedStrings())
+	require.NoError(t, err)
+
+	var decoded govdf.Node
+	require.NoError(t, govdf.Unmarshal(data, &decoded))
+
+	// Assert: The decoded node should match the original.
+	var ignore = cmpopts.IgnoreFields(govdf.Node{}, "Line", "Column", "KeyRange", "ValueRange", "Keys")
+	if diff := cmp.Diff(*node, decoded, ignore); diff != "" {
+		t.Errorf("unexpected node (-want +got):\n%s", diff)
+	}
+}
+
+func TestEncode_EscapeSequences(t *testing.T) {
+	t.Parallel()
+
+	// Arrange: Create a node whose key and value need escaping.
+	node := &govdf.Node{
+		Type: govdf.NodeTypeMap,
+		Children: map[string]*govdf.Node{
+			`say "hi"`: {Type: govdf.NodeTypeScalar, Value: "line1\nline2\tC:\\path\\"},
+		},
+	}
+
+	// Act: Marshal the node with escape sequences enabled.
+	result, err := govdf.Marshal(node, govdf.WithEscapeSequences())
+	require.NoError(t, err)
+
+	// Assert: Quotes, backslashes, newlines and tabs should be escaped.
+	require.Equal(t, `"say \"hi\"" "line1\nline2\tC:\\path\\"`, strings.TrimSpace(string(result)))
+}
+
+func TestEncode_EscapeSequencesRoundtrip(t *testing.T) {
+	t.Parallel()
+
+	var testCases = map[string]string{
+		"empty":                    "",
+		"quote":                    `"`,
+		"quoted word":              `say "hello"`,
+		"trailing backslash":       `C:\path\`,
+		"backslash before quote":   `\"`,
+		"double backslash":         `\\server\share`,
+		"literal escape sequences": `\n\t`,
+		"newline and tab":          "a\nb\tc",
+		"braces and comment":       "{ // }",
+		"conditional":              "[$WIN32]",
+		"unicode":                  "héllo wörld ✓",
+	}
+	for name, value := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Arrange: Use the tricky string as both a key and a value.
+			node := &govdf.Node{
+				Type: govdf.NodeTypeMap,
+				Children: map[string]*govdf.Node{
+					value + "key": {Type: govdf.NodeTypeScalar, Value: value},
+					"nested": {
+						Type: govdf.NodeTypeMap,
+						Children: map[string]*govdf.Node{
+							value: {Type: govdf.NodeTypeScalar, Value: value + value},
+						},
+					},
+				},
+			}
+
+			// Act: Marshal and unmarshal with escape sequences enabled.
+			for _, opts := range [][]govdf.Option{
+				{govdf.WithEscapeSequences()},
+				{govdf.WithEscapeSequences(), govdf.WithUnquotedStrings()},
+			} {
+				data, err := govdf.Marshal(node, opts...)
+				require.NoError(t, err)
+
+				var decoded govdf.Node
+				require.NoError(t, govdf.Unmarshal(data, &decoded, opts...))
+
+				// Assert: The decoded node should match the original.
+				var ignore = cmpopts.IgnoreFields(govdf.Node{}, "Line", "Column", "KeyRange", "ValueRange", "Keys")
+				if diff := cmp.Diff(*node, decoded, ignore); diff != "" {
+					t.Errorf("unexpected node (-want +got):\n%s\ndata: %s", diff, data)
+				}
+			}
+		})
+	}
+}
+
+func TestEncode_DuplicateKeys(t *testing.T) {
+	t.Parallel()
+
+	var input = `"rndwave"
+{
+    "wave" "a.wav"
+    "wave" "b.wav"
+    "wave" "c.wav"
+}
+`
+
+	// Arrange: Decode the input keeping every duplicate.
+	var node govdf.Node
+	require.NoError(t, govdf.Unmarshal([]byte(input), &node, govdf.WithDuplicateKeys(govdf.DuplicateKeepAll)))
+
+	// Act: Marshal the node with both encoders.
+	text, err := govdf.Marshal(&node)
+	require.NoError(t, err)
+	binary, err := govdf.MarshalBinary(&node)
+	require.NoError(t, err)
+
+	// Assert: Every occurrence should be written in order.
+	expected := strings.Join([]string{
+		`"rndwave" {`,
+		`    "wave" "a.wav"`,
+		`    "wave" "b.wav"`,
+		`    "wave" "c.wav"`,
+		`}`,
+	}, "\n")
+	require.Equal(t, expected, strings.TrimSpace(string(text)))
+	require.Equal(t, 3, strings.Count(string(binary), "\x01wave\x00"))
+}
+
+func TestEncode_KeyOrder(t *testing.T) {
+	t.Parallel()
+
+	var input = strings.Join([]string{
+		`"UserLocalConfigStore" {`,
+		`    "streaming" {`,
+		`        "zeta" "1"`,
+		`        "alpha" "2"`,
+		`    }`,
+		`    "friends" {`,
+		`        "wave" "a"`,
+		`        "group" "x"`,
+		`        "wave" "b"`,
+		`    }`,
+		`}`,
+	}, "\n")
+
+	// Arrange: Decode the input keeping every duplicate.
+	var node govdf.Node
+	require.NoError(t, govdf.Unmarshal([]byte(input), &node, govdf.WithDuplicateKeys(govdf.DuplicateKeepAll)))
+
+	// Act: Marshal the node.
+	result, err := govdf.Marshal(&node)
+	require.NoError(t, err)
+
+	// Assert: The output should keep the source order.
+	require.Equal(t, input, strings.TrimSpace(string(result)))
+
+	// Act: Marshal the node with sorted keys.
+	result, err = govdf.Marshal(&node, govdf.WithSortedKeys())
+	require.NoError(t, err)
+
+	// Assert: Keys should be sorted, with duplicates kept in order.
+	expected := strings.Join([]string{
+		`"UserLocalConfigStore" {`,
+		`    "friends" {`,
+		`        "group" "x"`,
+		`        "wave" "a"`,
+		`        "wave" "b"`,
+		`    }`,
+		`    "streaming" {`,
+		`        "alpha" "2"`,
+		`        "zeta" "1"`,
+		`    }`,
+		`}`,
+	}, "\n")
+	require.Equal(t, expected, strings.TrimSpace(string(result)))
+}
+
+func TestEncode_KeyOrderEdits(t *testing.T) {
+	t.Parallel()
+
+	// Arrange: Decode a document and edit its children directly.
+	var node govdf.Node
+	require.NoError(t, govdf.Unmarshal([]byte(`"c" "1" "b" "2" "a" "3"`), &node))
+	delete(node.Children, "b")
+	node.Children["d"] = &govdf.Node{Type: govdf.NodeTypeScalar, Value: "4"}
+	node.Children["0"] = &govdf.Node{Type: govdf.NodeTypeScalar, Value: "5"}
+
+	// Act: Marshal the edited node.
+	result, err := govdf.Marshal(&node)
+	require.NoError(t, err)
+
+	// Assert: Recorded keys keep their order and new keys are appended sorted.
+	expected := strings.Join([]string{
+		`"c" "1"`,
+		`"a" "3"`,
+		`"0" "5"`,
+		`"d" "4"`,
+	}, "\n")
+	require.Equal(t, expected, strings.TrimSpace(string(result)))
+}
+
+func TestEncode_Comments(t *testing.T) {
+	t.Parallel()
+
+	var input = strings.Join([]string{
+		`// File header`,
+		`"root" {	// opening`,
+		`    // head`,
+		`    "a" "1"	// line`,
+		`    "empty" {`,
+		`        // nothing here`,
+		`    }	// end of empty`,
+		`    "b" "2"	/* multi`,
+		`    line */`,
+		`    // after the last child`,
+		`}`,
+		`// end of file`,
+	}, "\n")
+
+	// Arrange: Decode the input.
+	var node govdf.Node
+	require.NoError(t, govdf.Unmarshal([]byte(input), &node))
+
+	// Act: Marshal the node.
+	result, err := govdf.Marshal(&node)
+	require.NoError(t, err)
+
+	// Assert: Every comment should be written back in the same place.
+	require.Equal(t, input, strings.TrimSpace(string(result)))
+}
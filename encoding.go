@@ -0,0 +1,273 @@
+package govdf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encoding identifies the character encoding of VDF text.
+type Encoding uint8
+
+const (
+	// EncodingUTF8 is UTF-8, the default. When decoding, a UTF-16 byte order mark
+	// at the start of the input switches the Decoder to the matching UTF-16 encoding.
+	EncodingUTF8 Encoding = iota
+
+	// EncodingUTF16LE is little-endian UTF-16, used by localization and closecaption files.
+	// The Encoder writes a byte order mark before the text.
+	EncodingUTF16LE
+
+	// EncodingUTF16BE is big-endian UTF-16. The Encoder writes a byte order mark before the text.
+	EncodingUTF16BE
+
+	// EncodingWindows1252 is the Windows-1252 code page used by older community files.
+	EncodingWindows1252
+)
+
+// String returns the name of the encoding.
+func (e Encoding) String() string {
+	switch e {
+	case EncodingUTF8:
+		return "UTF-8"
+
+	case EncodingUTF16LE:
+		return "UTF-16LE"
+
+	case EncodingUTF16BE:
+		return "UTF-16BE"
+
+	case EncodingWindows1252:
+		return "Windows-1252"
+
+	default:
+		return fmt.Sprintf("Encoding(%d)", e)
+	}
+}
+
+// windows1252 maps the bytes 0x80 to 0x9F of Windows-1252 to the characters they represent.
+// The remaining bytes have the same value as their Unicode code point.
+// Unassigned bytes map to the C1 control character with the same value.
+var windows1252 = [32]rune{
+	'€', '\u0081', '‚', 'ƒ', '„', '…', '†', '‡',
+	'ˆ', '‰', 'Š', '‹', 'Œ', '\u008D', 'Ž', '\u008F',
+	'\u0090', '‘', '’', '“', '”', '•', '–', '—',
+	'˜', '™', 'š', '›', 'œ', '\u009D', 'ž', 'Ÿ',
+}
+
+// newTextReader returns a reader that converts text in the given encoding to UTF-8.
+// For UTF-8 input a UTF-16 byte order mark is detected, and a byte order mark
+// matching a UTF-16 encoding is skipped.
+func newTextReader(r io.Reader, enc Encoding) *bufio.Reader {
+	var src = bufio.NewReaderSize(r, 4096)
+
+	// Detect the encoding from the byte order mark
+	var bom, _ = src.Peek(2)
+	switch {
+	case len(bom) < 2:
+
+	case bom[0] == 0xFF && bom[1] == 0xFE && (enc == EncodingUTF8 || enc == EncodingUTF16LE):
+		enc = EncodingUTF16LE
+		_, _ = src.Discard(2)
+
+	case bom[0] == 0xFE && bom[1] == 0xFF && (enc == EncodingUTF8 || enc == EncodingUTF16BE):
+		enc = EncodingUTF16BE
+		_, _ = src.Discard(2)
+	}
+
+	switch enc {
+	case EncodingUTF16LE:
+		return bufio.NewReaderSize(&decodingReader{src: src, decode: utf16Decoder(binary.LittleEndian)}, 4096)
+
+	case EncodingUTF16BE:
+		return bufio.NewReaderSize(&decodingReader{src: src, decode: utf16Decoder(binary.BigEndian)}, 4096)
+
+	case EncodingWindows1252:
+		return bufio.NewReaderSize(&decodingReader{src: src, decode: decodeWindows1252}, 4096)
+
+	default:
+		return src
+	}
+}
+
+// decodingReader converts text read from src to UTF-8, one character at a time.
+type decodingReader struct {
+	src    *bufio.Reader
+	decode func(src *bufio.Reader) (rune, error)
+
+	// Converted text that did not fit in the last read
+	buf []byte
+}
+
+// Read reads converted UTF-8 text into p.
+func (d *decodingReader) Read(p []byte) (int, error) {
+	var n int
+	for n < len(p) {
+		if len(d.buf) == 0 {
+			// Only block for more input when nothing has been converted yet
+			if n > 0 && d.src.Buffered() == 0 {
+				break
+			}
+
+			r, err := d.decode(d.src)
+			if err != nil {
+				if n > 0 {
+					break
+				}
+				return 0, err
+			}
+			d.buf = utf8.AppendRune(d.buf[:0], r)
+		}
+
+		var copied = copy(p[n:], d.buf)
+		d.buf = d.buf[copied:]
+		n += copied
+	}
+	return n, nil
+}
+
+// utf16Decoder returns a function that reads one character of UTF-16 text in the given byte order.
+// Unpaired surrogates are replaced with utf8.RuneError.
+func utf16Decoder(order binary.ByteOrder) func(src *bufio.Reader) (rune, error) {
+	// A unit read after an unpaired high surrogate, decoded on the next call
+	var pending rune = -1
+
+	var readUnit = func(src *bufio.Reader) (rune, error) {
+		if pending >= 0 {
+			var unit = pending
+			pending = -1
+			return unit, nil
+		}
+
+		var b [2]byte
+		if _, err := io.ReadFull(src, b[:]); err != nil {
+			return 0, err
+		}
+		return rune(order.Uint16(b[:])), nil
+	}
+
+	return func(src *bufio.Reader) (rune, error) {
+		r1, err := readUnit(src)
+		if err != nil || !utf16.IsSurrogate(r1) {
+			return r1, err
+		}
+
+		r2, err := readUnit(src)
+		if err == io.EOF {
+			return utf8.RuneError, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		var r = utf16.DecodeRune(r1, r2)
+		if r == utf8.RuneError && !utf16.IsSurrogate(r2) {
+			pending = r2
+		}
+		return r, nil
+	}
+}
+
+// decodeWindows1252 reads one character of Windows-1252 text.
+func decodeWindows1252(src *bufio.Reader) (rune, error) {
+	b, err := src.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b >= 0x80 && b <= 0x9F {
+		return windows1252[b-0x80], nil
+	}
+	return rune(b), nil
+}
+
+// newTextWriter returns a writer that converts UTF-8 text to the given encoding before writing it to w.
+// UTF-16 output starts with a byte order mark.
+func newTextWriter(w io.Writer, enc Encoding) io.Writer {
+	switch enc {
+	case EncodingUTF16LE:
+		return &encodingWriter{w: w, encode: utf16Encoder(binary.LittleEndian), bom: []byte{0xFF, 0xFE}}
+
+	case EncodingUTF16BE:
+		return &encodingWriter{w: w, encode: utf16Encoder(binary.BigEndian), bom: []byte{0xFE, 0xFF}}
+
+	case EncodingWindows1252:
+		return &encodingWriter{w: w, encode: encodeWindows1252}
+
+	default:
+		return w
+	}
+}
+
+// encodingWriter converts UTF-8 text to another encoding.
+type encodingWriter struct {
+	w      io.Writer
+	encode func(dst []byte, r rune) ([]byte, error)
+
+	// The byte order mark, written before the first write
+	bom []byte
+
+	// An incomplete UTF-8 sequence at the end of the last write
+	partial []byte
+
+	// Reusable buffer for the converted text
+	buf []byte
+}
+
+// Write converts p and writes it to the underlying writer.
+func (e *encodingWriter) Write(p []byte) (int, error) {
+	var data = p
+	if len(e.partial) > 0 {
+		data = append(e.partial, p...)
+		e.partial = nil
+	}
+
+	var out = append(e.buf[:0], e.bom...)
+	e.bom = nil
+	for len(data) > 0 {
+		if !utf8.FullRune(data) {
+			e.partial = append([]byte(nil), data...)
+			break
+		}
+
+		var r, size = utf8.DecodeRune(data)
+		var err error
+		if out, err = e.encode(out, r); err != nil {
+			return 0, err
+		}
+		data = data[size:]
+	}
+	e.buf = out
+
+	if _, err := e.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// utf16Encoder returns a function that appends a character as UTF-16 in the given byte order.
+func utf16Encoder(order binary.AppendByteOrder) func(dst []byte, r rune) ([]byte, error) {
+	return func(dst []byte, r rune) ([]byte, error) {
+		var units [2]uint16
+		for _, unit := range utf16.AppendRune(units[:0], r) {
+			dst = order.AppendUint16(dst, unit)
+		}
+		return dst, nil
+	}
+}
+
+// encodeWindows1252 appends a character as Windows-1252.
+// Characters that do not exist in the code page cannot be encoded.
+func encodeWindows1252(dst []byte, r rune) ([]byte, error) {
+	if r < 0x80 || (r >= 0xA0 && r <= 0xFF) {
+		return append(dst, byte(r)), nil
+	}
+	for i, c := range windows1252 {
+		if c == r {
+			return append(dst, byte(0x80+i)), nil
+		}
+	}
+	return nil, fmt.Errorf("cannot encode %q in %s", r, EncodingWindows1252)
+}
@@ -0,0 +1,146 @@
+package govdf_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+
+	govdf "github.com/lewisgibson/go-vdf"
+	"github.com/stretchr/testify/require"
+)
+
+// encodeUTF16 returns s as UTF-16 in the given byte order, optionally preceded by a byte order mark.
+func encodeUTF16(s string, order binary.AppendByteOrder, bom bool) []byte {
+	var units = utf16.Encode([]rune(s))
+	if bom {
+		units = append([]uint16{0xFEFF}, units...)
+	}
+
+	var out []byte
+	for _, unit := range units {
+		out = order.AppendUint16(out, unit)
+	}
+	return out
+}
+
+func TestDecode_Encodings(t *testing.T) {
+	t.Parallel()
+
+	var text = "\"lang\"\n{\n\t\"Tokens\"\n\t{\n\t\t\"greeting\"\t\"Grüße 🎮\"\n\t}\n}\n"
+
+	var testCases = map[string]struct {
+		input    []byte
+		options  []govdf.Option
+		expected string
+	}{
+		"utf-8 with byte order mark": {
+			input:    append([]byte{0xEF, 0xBB, 0xBF}, text...),
+			expected: "Grüße 🎮",
+		},
+		"utf-16le detected from byte order mark": {
+			input:    encodeUTF16(text, binary.LittleEndian, true),
+			expected: "Grüße 🎮",
+		},
+		"utf-16be detected from byte order mark": {
+			input:    encodeUTF16(text, binary.BigEndian, true),
+			expected: "Grüße 🎮",
+		},
+		"utf-16le without byte order mark": {
+			input:    encodeUTF16(text, binary.LittleEndian, false),
+			options:  []govdf.Option{govdf.WithEncoding(govdf.EncodingUTF16LE)},
+			expected: "Grüße 🎮",
+		},
+		"utf-16be with byte order mark": {
+			input:    encodeUTF16(text, binary.BigEndian, true),
+			options:  []govdf.Option{govdf.WithEncoding(govdf.EncodingUTF16BE)},
+			expected: "Grüße 🎮",
+		},
+		"windows-1252": {
+			input:    []byte("\"lang\" { \"Tokens\" { \"greeting\" \"Gr\xfc\xdfe \x80\x96\" } }"),
+			options:  []govdf.Option{govdf.WithEncoding(govdf.EncodingWindows1252)},
+			expected: "Grüße €–",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act: Unmarshal the input.
+			var node govdf.Node
+			require.NoError(t, govdf.Unmarshal(tc.input, &node, tc.options...))
+
+			// Assert: The value should be decoded to UTF-8.
+			require.Equal(t, tc.expected, node.Children["lang"].Children["Tokens"].Children["greeting"].Value)
+		})
+	}
+}
+
+func TestEncode_Encodings(t *testing.T) {
+	t.Parallel()
+
+	var node = &govdf.Node{
+		Type: govdf.NodeTypeMap,
+		Children: map[string]*govdf.Node{
+			"greeting": {Type: govdf.NodeTypeScalar, Value: "Grüße €"},
+		},
+	}
+	var text = "\"greeting\" \"Grüße €\"\n"
+
+	var testCases = map[string]struct {
+		encoding govdf.Encoding
+		expected []byte
+	}{
+		"utf-8": {
+			encoding: govdf.EncodingUTF8,
+			expected: []byte(text),
+		},
+		"utf-16le": {
+			encoding: govdf.EncodingUTF16LE,
+			expected: encodeUTF16(text, binary.LittleEndian, true),
+		},
+		"utf-16be": {
+			encoding: govdf.EncodingUTF16BE,
+			expected: encodeUTF16(text, binary.BigEndian, true),
+		},
+		"windows-1252": {
+			encoding: govdf.EncodingWindows1252,
+			expected: []byte("\"greeting\" \"Gr\xfc\xdfe \x80\"\n"),
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act: Encode the node in the encoding.
+			var buffer bytes.Buffer
+			require.NoError(t, govdf.NewEncoder(&buffer, govdf.WithEncoding(tc.encoding)).Encode(node))
+
+			// Assert: The output should be in the encoding.
+			require.Equal(t, tc.expected, buffer.Bytes())
+
+			// Assert: The output should decode back to the same value.
+			var decoded govdf.Node
+			require.NoError(t, govdf.Unmarshal(buffer.Bytes(), &decoded, govdf.WithEncoding(tc.encoding)))
+			require.Equal(t, "Grüße €", decoded.Children["greeting"].Value)
+		})
+	}
+}
+
+func TestEncode_EncodingUnsupportedCharacter(t *testing.T) {
+	t.Parallel()
+
+	// Arrange: Create a node with a character that is missing from Windows-1252.
+	var node = &govdf.Node{
+		Type: govdf.NodeTypeMap,
+		Children: map[string]*govdf.Node{
+			"greeting": {Type: govdf.NodeTypeScalar, Value: "🎮"},
+		},
+	}
+
+	// Act: Encode the node as Windows-1252.
+	_, err := govdf.Marshal(node, govdf.WithEncoding(govdf.EncodingWindows1252))
+
+	// Assert: The character cannot be encoded.
+	require.ErrorContains(t, err, "cannot encode '🎮' in Windows-1252")
+}
@@ -14,6 +14,9 @@ var (
 	// ErrNilNode is returned when attempting to encode a nil Node.
 	// This occurs when a Node pointer is nil during encoding operations.
 	ErrNilNode = errors.New("cannot encode nil node")
+
+	// ErrNotFound is returned when a LazyDocument has no value at the requested path.
+	ErrNotFound = errors.New("no value at path")
 )
 
 // PositionError represents an error that occurred at a specific line and column
@@ -27,13 +30,22 @@ var (
 //	    fmt.Printf("Error at line %d, column %d: %v\n", posErr.Line, posErr.Column, posErr.Err)
 //	}
 type PositionError struct {
-	Line   int   // Line number where the error occurred (1-indexed)
-	Column int   // Column number where the error occurred (1-indexed)
-	Err    error // The underlying error that caused this position error
+	File   string // Name of the file where the error occurred (may be empty)
+	Line   int    // Line number where the error occurred (1-indexed)
+	Column int    // Column number where the error occurred (1-indexed)
+	Err    error  // The underlying error that caused this position error
 }
 
 // Error returns a formatted error message including line and column information.
+// The file name is included when it is known, and is all there is when the underlying
+// error holds its own position.
 func (e *PositionError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %v", e.File, e.Err)
+	}
+	if e.File != "" {
+		return fmt.Sprintf("%s: line %d, column %d: %v", e.File, e.Line, e.Column, e.Err)
+	}
 	return fmt.Sprintf("line %d, column %d: %v", e.Line, e.Column, e.Err)
 }
 
@@ -53,6 +65,89 @@ func newPositionError(line, column int, err error) *PositionError {
 	}
 }
 
+// positionError returns err positioned at line and column of file. An error that already
+// holds its own position, such as a ParseError, only gets the file name, and is returned
+// unchanged when there is none.
+func positionError(file string, line, column int, err error) error {
+	var posErr *PositionError
+	var parseErr *ParseError
+	var limitErr *LimitError
+	var unknownErr *UnknownFieldError
+	if errors.As(err, &posErr) || errors.As(err, &parseErr) || errors.As(err, &limitErr) || errors.As(err, &unknownErr) {
+		if file == "" {
+			return err
+		}
+		return &PositionError{File: file, Err: err}
+	}
+	return &PositionError{File: file, Line: line, Column: column, Err: err}
+}
+
+// LimitError is returned when decoding exceeds one of the limits set with WithLimits.
+//
+// Example:
+//
+//	var limitErr *govdf.LimitError
+//	if errors.As(err, &limitErr) {
+//	    fmt.Printf("input rejected: %s exceeded at offset %d\n", limitErr.Limit, limitErr.Offset)
+//	}
+type LimitError struct {
+	Limit  string // Name of the exceeded field of Limits, such as "MaxDepth"
+	Max    int64  // The configured maximum
+	Line   int    // Line number where the limit was exceeded (1-indexed, zero for binary input)
+	Column int    // Column number where the limit was exceeded (1-indexed, zero for binary input)
+	Offset int64  // Number of bytes of input read when the limit was exceeded
+}
+
+// Error returns a formatted error message including the position where the limit was exceeded.
+func (e *LimitError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d, column %d: %s limit of %d exceeded", e.Line, e.Column, e.Limit, e.Max)
+	}
+	return fmt.Sprintf("offset %d: %s limit of %d exceeded", e.Offset, e.Limit, e.Max)
+}
+
+// UnknownFieldError is returned when a key has no matching struct field and unknown fields
+// are disallowed with WithDisallowUnknownFields.
+//
+// Example:
+//
+//	var unknownErr *govdf.UnknownFieldError
+//	if errors.As(err, &unknownErr) {
+//	    fmt.Printf("unknown key %s at line %d\n", unknownErr.Key, unknownErr.Line)
+//	}
+type UnknownFieldError struct {
+	Key    Key   // Path of the unknown key
+	Line   int   // Line number of the key (1-indexed, zero for binary input)
+	Column int   // Column number of the key (1-indexed, zero for binary input)
+	Offset int64 // Byte offset of the key
+}
+
+// Error returns a formatted error message including the path and position of the key.
+func (e *UnknownFieldError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d, column %d: unknown field %q", e.Line, e.Column, e.Key.String())
+	}
+	return fmt.Sprintf("offset %d: unknown field %q", e.Offset, e.Key.String())
+}
+
+// MissingFieldError is returned when a struct field tagged with the "required" option has no key
+// in the map it is decoded from.
+//
+// Example:
+//
+//	var missingErr *govdf.MissingFieldError
+//	if errors.As(err, &missingErr) {
+//	    fmt.Printf("missing setting %s\n", missingErr.Key)
+//	}
+type MissingFieldError struct {
+	Key Key // Path of the missing key
+}
+
+// Error returns a formatted error message including the path of the missing key.
+func (e *MissingFieldError) Error() string {
+	return fmt.Sprintf("missing required field %q", e.Key.String())
+}
+
 // ParseError represents a VDF parsing error with detailed context about what was
 // expected versus what was found. This is the most common error type during
 // VDF parsing operations.
@@ -72,15 +167,86 @@ type ParseError struct {
 	Message  string // Human-readable description of the parse error
 	Expected string // What was expected at this location (may be empty)
 	Found    string // What was actually found at this location (may be empty)
+
+	// Severity and the end of the range are set on the diagnostics collected with WithRecovery.
+	// EndLine and EndColumn give the position just after the problem, or zero when unknown.
+	Severity  Severity
+	EndLine   int
+	EndColumn int
 }
 
 // Error returns a formatted error message. If both Expected and Found are provided,
 // it includes them in the message for better debugging context.
 func (e *ParseError) Error() string {
+	var prefix string
+	if e.Severity == SeverityWarning {
+		prefix = "warning: "
+	}
 	if e.Expected != "" && e.Found != "" {
-		return fmt.Sprintf("line %d, column %d: %s (expected %q, found %q)", e.Line, e.Column, e.Message, e.Expected, e.Found)
+		return fmt.Sprintf("line %d, column %d: %s%s (expected %q, found %q)", e.Line, e.Column, prefix, e.Message, e.Expected, e.Found)
+	}
+	return fmt.Sprintf("line %d, column %d: %s%s", e.Line, e.Column, prefix, e.Message)
+}
+
+// Severity is the severity of a ParseError.
+type Severity uint8
+
+const (
+	// SeverityError marks input that is invalid VDF.
+	SeverityError Severity = iota
+
+	// SeverityWarning marks input that is accepted but probably a mistake, such as a missing closing brace.
+	SeverityWarning
+)
+
+// String returns the name of the severity.
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+
+	case SeverityWarning:
+		return "warning"
+
+	default:
+		return fmt.Sprintf("Severity(%d)", s)
+	}
+}
+
+// ErrorList is the list of diagnostics returned by a Decoder configured with WithRecovery,
+// sorted by position.
+//
+// Example:
+//
+//	var list govdf.ErrorList
+//	if errors.As(err, &list) {
+//	    for _, diagnostic := range list {
+//	        fmt.Printf("%s:%d:%d: %s: %s\n", name, diagnostic.Line, diagnostic.Column, diagnostic.Severity, diagnostic.Message)
+//	    }
+//	}
+type ErrorList []*ParseError
+
+// Error returns the first diagnostic and the number of diagnostics that follow it.
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+
+	case 1:
+		return l[0].Error()
+
+	default:
+		return fmt.Sprintf("%s (and %d more)", l[0].Error(), len(l)-1)
+	}
+}
+
+// Unwrap returns the diagnostics, allowing errors.As to find a ParseError in the list.
+func (l ErrorList) Unwrap() []error {
+	var errs = make([]error, len(l))
+	for i, err := range l {
+		errs[i] = err
 	}
-	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+	return errs
 }
 
 // newParseError creates a new ParseError with the specified location and message.
@@ -0,0 +1,199 @@
+package govdf
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// DirectiveKind identifies the kind of a file directive.
+type DirectiveKind uint8
+
+const (
+	// DirectiveInclude is an #include directive. The keys of the included file
+	// are appended to the including document.
+	DirectiveInclude DirectiveKind = iota
+
+	// DirectiveBase is a #base directive. The keys of the base file only fill in
+	// keys that are missing from the including document.
+	DirectiveBase
+)
+
+// String returns the directive as it appears in VDF text.
+func (k DirectiveKind) String() string {
+	switch k {
+	case DirectiveInclude:
+		return "#include"
+
+	case DirectiveBase:
+		return "#base"
+
+	default:
+		return fmt.Sprintf("DirectiveKind(%d)", k)
+	}
+}
+
+// Directive is an #include or #base directive found at the top level of a document,
+// such as the `#base "HudLayout_base.res"` lines at the top of HUD resource files.
+// Directives are exposed on the root Node and written back by the Encoder.
+type Directive struct {
+	Kind DirectiveKind // Whether this is an #include or #base directive
+	Path string        // The referenced path, relative to the including file
+
+	// Line and Column provide the position of the directive in the original VDF file.
+	Line   int
+	Column int
+}
+
+// parseDirectiveKind returns the kind of directive named by key.
+// Directive names are matched case-insensitively.
+func parseDirectiveKind(key string) (DirectiveKind, bool) {
+	switch {
+	case strings.EqualFold(key, "#include"):
+		return DirectiveInclude, true
+
+	case strings.EqualFold(key, "#base"):
+		return DirectiveBase, true
+
+	default:
+		return 0, false
+	}
+}
+
+// Resolver opens the files referenced by #include and #base directives.
+// The name passed to Open is the directive path joined to the directory of the including file.
+type Resolver interface {
+	Open(name string) (io.ReadCloser, error)
+}
+
+// fsResolver is a Resolver backed by an fs.FS.
+type fsResolver struct {
+	fsys fs.FS
+}
+
+// NewFSResolver returns a Resolver that opens referenced files from fsys.
+// Names are cleaned and Windows path separators are converted before the file is opened.
+//
+// Example:
+//
+//	var node govdf.Node
+//	err := govdf.Unmarshal(data, &node,
+//	    govdf.WithFilename("resource/ui/hudlayout.res"),
+//	    govdf.WithResolver(govdf.NewFSResolver(os.DirFS("tf"))),
+//	)
+func NewFSResolver(fsys fs.FS) Resolver {
+	return &fsResolver{fsys: fsys}
+}
+
+// Open opens the named file from the underlying file system.
+func (r *fsResolver) Open(name string) (io.ReadCloser, error) {
+	return r.fsys.Open(name)
+}
+
+// resolveDirectives loads the files referenced by the directives of root and merges them into it.
+// Included files are appended first, then base files fill in any missing keys.
+func (d *Decoder) resolveDirectives(root *Node) error {
+	for _, kind := range []DirectiveKind{DirectiveInclude, DirectiveBase} {
+		for _, directive := range root.Directives {
+			if directive.Kind != kind {
+				continue
+			}
+
+			child, err := d.loadDirective(directive)
+			if err != nil {
+				return err
+			}
+
+			switch kind {
+			case DirectiveInclude:
+				if err := appendChildren(root, child, d.opts.duplicates); err != nil {
+					return d.directiveError(directive, fmt.Errorf("cannot include %q: %w", directive.Path, err))
+				}
+
+			case DirectiveBase:
+				mergeBaseChildren(root, child)
+			}
+		}
+	}
+
+	return nil
+}
+
+// loadDirective opens and decodes the file referenced by a directive.
+// The referenced file is decoded with the same options, so its own directives are resolved too.
+func (d *Decoder) loadDirective(directive Directive) (*Node, error) {
+	var name = path.Clean(path.Join(path.Dir(d.opts.filename), strings.ReplaceAll(directive.Path, `\`, "/")))
+
+	// Detect include cycles
+	for i, loading := range d.chain {
+		if loading == name {
+			var cycle = append(append([]string{}, d.chain[i:]...), name)
+			return nil, d.directiveError(directive, fmt.Errorf("%s cycle: %s", directive.Kind, strings.Join(cycle, " -> ")))
+		}
+	}
+
+	file, err := d.opts.resolver.Open(name)
+	if err != nil {
+		return nil, d.directiveError(directive, fmt.Errorf("cannot open %q: %w", name, err))
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, d.directiveError(directive, fmt.Errorf("cannot read %q: %w", name, err))
+	}
+
+	var opts = d.opts
+	opts.filename = name
+	var decoder = &Decoder{
+		opts:  opts,
+		chain: append(append([]string{}, d.chain...), name),
+		whole: true,
+	}
+	decoder.scanner = newBytesScanner(data, &decoder.opts)
+	decoder.scanner.cancel = contextChecker{ctx: d.scanner.cancel.ctx}
+
+	var node Node
+	if err := decoder.Decode(&node); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// directiveError returns an error positioned at the directive in the including file.
+func (d *Decoder) directiveError(directive Directive, err error) error {
+	var posErr = newPositionError(directive.Line, directive.Column, err)
+	posErr.File = d.opts.filename
+	return posErr
+}
+
+// appendChildren adds the children of src to dst as if they appeared at the end of dst.
+// Duplicate keys are handled the same way as duplicate keys within a single document.
+func appendChildren(dst, src *Node, policy DuplicatePolicy) error {
+	for _, e := range src.entries(false) {
+		if _, err := addChild(dst, e.key, e.node, policy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeBaseChildren fills in the keys of dst that are missing, using the children of src.
+// Maps that exist in both are merged recursively, while existing values are never replaced.
+func mergeBaseChildren(dst, src *Node) {
+	// Keys missing from dst are added with every occurrence kept by the base file
+	var missing = make(map[string]bool)
+	for _, e := range src.entries(false) {
+		var existing, ok = dst.Children[e.key]
+		switch {
+		case !ok || missing[e.key]:
+			missing[e.key] = true
+			_, _ = addChild(dst, e.key, e.node, DuplicateKeepAll)
+
+		case existing.Type == NodeTypeMap && e.node.Type == NodeTypeMap:
+			mergeBaseChildren(existing, e.node)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package govdf_test
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	govdf "github.com/lewisgibson/go-vdf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecode_Directives(t *testing.T) {
+	t.Parallel()
+
+	// Act: Unmarshal a document with directives but no resolver.
+	var node govdf.Node
+	require.NoError(t, govdf.Unmarshal([]byte("#base \"base.res\"\n#include \"extra.res\"\n\"a\" \"b\""), &node))
+
+	// Assert: The directives should be recorded on the root node without being loaded.
+	var expected = govdf.Node{
+		Type: govdf.NodeTypeMap,
+		Directives: []govdf.Directive{
+			{Kind: govdf.DirectiveBase, Path: "base.res", Line: 1, Column: 1},
+			{Kind: govdf.DirectiveInclude, Path: "extra.res", Line: 2, Column: 1},
+		},
+		Children: map[string]*govdf.Node{
+			"a": {Type: govdf.NodeTypeScalar, Value: "b"},
+		},
+	}
+	var ignore = cmpopts.IgnoreFields(govdf.Node{}, "Line", "Column", "KeyRange", "ValueRange", "Keys")
+	if diff := cmp.Diff(expected, node, ignore); diff != "" {
+		t.Errorf("unexpected node (-want +got):\n%s", diff)
+	}
+}
+
+func TestDecode_DirectivesResolved(t *testing.T) {
+	t.Parallel()
+
+	var fsys = fstest.MapFS{
+		"ui/base.res":  {Data: []byte(`"hud" { "color" "white" "wide" "640" "panel" { "x" "1" "y" "2" } }`)},
+		"ui/extra.res": {Data: []byte(`"hud" { "font" "Tahoma" "wide" "800" }`)},
+		"ui/nested/deep.res": {Data: []byte(`#base "../base.res"
+"deep" "1"`)},
+	}
+
+	var testCases = map[string]struct {
+		input    string
+		expected map[string]string
+	}{
+		"base fills in missing keys recursively": {
+			input: `#base "base.res"
+"hud" { "color" "red" "panel" { "x" "5" } }`,
+			expected: map[string]string{"color": "red", "wide": "640", "x": "5", "y": "2"},
+		},
+		"include appends keys": {
+			input: `#include "extra.res"
+"hud" { "wide" "320" }`,
+			expected: map[string]string{"font": "Tahoma", "wide": "800"},
+		},
+		"includes are applied before bases": {
+			input: `#base "base.res"
+#include "extra.res"
+"hud" { }`,
+			expected: map[string]string{"color": "white", "font": "Tahoma", "wide": "800", "x": "1", "y": "2"},
+		},
+		"nested directives are resolved relative to their file": {
+			input:    `#include "nested\deep.res"`,
+			expected: map[string]string{"color": "white", "wide": "640", "x": "1", "y": "2"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act: Unmarshal the input with a resolver.
+			var node govdf.Node
+			require.NoError(t, govdf.Unmarshal([]byte(tc.input), &node,
+				govdf.WithFilename("ui/hud.res"),
+				govdf.WithResolver(govdf.NewFSResolver(fsys)),
+			))
+
+			// Assert: The merged scalar values should match.
+			var actual = make(map[string]string)
+			var collect func(n *govdf.Node)
+			collect = func(n *govdf.Node) {
+				for key, child := range n.Children {
+					if child.Type == govdf.NodeTypeScalar && key != "deep" {
+						actual[key] = child.Value
+					}
+					collect(child)
+				}
+			}
+			collect(&node)
+			require.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestDecode_DirectiveErrors(t *testing.T) {
+	t.Parallel()
+
+	var fsys = fstest.MapFS{
+		"a.res":      {Data: []byte(`#include "b.res"`)},
+		"b.res":      {Data: []byte(`#base "a.res"`)},
+		"broken.res": {Data: []byte("\"a\" \"b\"\n}")},
+	}
+
+	var testCases = map[string]struct {
+		input       string
+		errorSubstr string
+		file        string
+	}{
+		"missing path": {
+			input:       `#base {`,
+			errorSubstr: "expected path after #base",
+		},
+		"missing file": {
+			input:       `#include "missing.res"`,
+			errorSubstr: `main.res: line 1, column 1: cannot open "missing.res"`,
+			file:        "main.res",
+		},
+		"cycle": {
+			input:       `#include "a.res"`,
+			errorSubstr: "#base cycle: a.res -> b.res -> a.res",
+			file:        "b.res",
+		},
+		"error in referenced file": {
+			input:       `#base "broken.res"`,
+			errorSubstr: "broken.res: line 2",
+			file:        "broken.res",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act: Unmarshal the input with a resolver.
+			var node govdf.Node
+			err := govdf.Unmarshal([]byte(tc.input), &node,
+				govdf.WithFilename("main.res"),
+				govdf.WithResolver(govdf.NewFSResolver(fsys)),
+			)
+
+			// Assert: The error should describe the failure and name the file.
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.errorSubstr)
+			if tc.file != "" {
+				var posErr *govdf.PositionError
+				require.True(t, errors.As(err, &posErr))
+				require.Equal(t, tc.file, posErr.File)
+			}
+		})
+	}
+}
+
+func TestDecode_DirectiveMissingFileUnwraps(t *testing.T) {
+	t.Parallel()
+
+	// Act: Unmarshal a document referencing a file that does not exist.
+	var node govdf.Node
+	err := govdf.Unmarshal([]byte(`#include "missing.res"`), &node, govdf.WithResolver(govdf.NewFSResolver(fstest.MapFS{})))
+
+	// Assert: The resolver error should be preserved.
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestEncode_Directives(t *testing.T) {
+	t.Parallel()
+
+	// Arrange: Create a root node with directives.
+	node := &govdf.Node{
+		Type: govdf.NodeTypeMap,
+		Directives: []govdf.Directive{
+			{Kind: govdf.DirectiveBase, Path: "base.res"},
+			{Kind: govdf.DirectiveInclude, Path: `sub\extra.res`},
+		},
+		Children: map[string]*govdf.Node{
+			"a": {Type: govdf.NodeTypeScalar, Value: "b"},
+		},
+	}
+
+	// Act: Marshal the node.
+	result, err := govdf.Marshal(node, govdf.WithUnquotedStrings())
+	require.NoError(t, err)
+
+	// Assert: Directives should be written at the top of the document.
+	expected := strings.Join([]string{
+		`#base "base.res"`,
+		`#include "sub\extra.res"`,
+		`a b`,
+	}, "\n")
+	require.Equal(t, expected, strings.TrimSpace(string(result)))
+
+	// Assert: The output should decode back into the same node.
+	var decoded govdf.Node
+	require.NoError(t, govdf.Unmarshal(result, &decoded))
+	var ignore = cmpopts.IgnoreFields(govdf.Node{}, "Line", "Column", "KeyRange", "ValueRange", "Keys")
+	var ignoreDirective = cmpopts.IgnoreFields(govdf.Directive{}, "Line", "Column")
+	if diff := cmp.Diff(*node, decoded, ignore, ignoreDirective); diff != "" {
+		t.Errorf("unexpected node (-want +got):\n%s", diff)
+	}
+}
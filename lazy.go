@@ -0,0 +1,373 @@
+package govdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// LazyDocument is a read-only view of VDF text for random access into large files such as
+// items_game.txt. Parsing it scans the text once to build a compact index of where every entry
+// starts and ends, without building a tree or copying keys and values. Nodes are only built
+// for the paths that are looked up, by decoding just the text of those entries.
+//
+// A UTF-8 LazyDocument shares the byte slice it was parsed from, which must not be modified
+// while the document is in use. Text in another encoding is converted once up front.
+// Lookups apply the conditionals and duplicate key policy of its options, so they return the
+// same nodes as the matching part of Unmarshal, but without the comments before and after
+// each looked up entry. Directives are skipped.
+//
+// Example:
+//
+//	doc, err := govdf.ParseLazyDocument(data)
+//	if err != nil {
+//	    return err
+//	}
+//	var knife Item
+//	err = doc.Decode(&knife, "items_game", "items", "42")
+type LazyDocument struct {
+	data    []byte
+	opts    options
+	entries []lazyEntry
+}
+
+// lazyEntry is the index of a single entry of a LazyDocument.
+// The first entry is the root of the document, which has no key.
+type lazyEntry struct {
+	// The key item including its quotes, and the end of the value or closing brace,
+	// or of the conditional that follows a scalar value
+	keyStart int
+	keyEnd   int
+	end      int
+
+	// The position of the key
+	line   int32
+	column int32
+
+	// The first child of a map and the next entry in the same map, or -1 when there is none
+	child int32
+	next  int32
+
+	quoted    bool
+	isMap     bool
+	condition string
+}
+
+// ParseLazyDocument indexes the VDF text in data and returns it as a LazyDocument.
+//
+// Unlike Unmarshal, the document is parsed in strict mode unless WithStrict(false) is given,
+// so malformed text is rejected before any lookups are made. Resource limits apply to the
+// index as well as to the nodes built by lookups. WithRecovery and WithResolver are ignored.
+func ParseLazyDocument(data []byte, opts ...Option) (*LazyDocument, error) {
+	var d = &LazyDocument{
+		data:    data,
+		opts:    newOptions(append([]Option{WithStrict(true)}, opts...)),
+		entries: []lazyEntry{{line: 1, column: 1, child: -1, next: -1, isMap: true, end: len(data)}},
+	}
+	d.opts.recover = false
+
+	// Text in another encoding is converted to UTF-8 once, so that lookups can scan it in place
+	var utf16BOM = len(data) >= 2 && (data[0] == 0xFF && data[1] == 0xFE || data[0] == 0xFE && data[1] == 0xFF)
+	if d.opts.encoding != EncodingUTF8 || utf16BOM {
+		converted, err := io.ReadAll(newTextReader(bytes.NewReader(data), d.opts.encoding))
+		if err != nil {
+			return nil, err
+		}
+		d.data, d.entries[0].end, d.opts.encoding = converted, len(converted), EncodingUTF8
+	}
+
+	// The text is read by the same parser as Unmarshal, which passes each entry to the index
+	// instead of building a tree. Conditionals are evaluated and duplicate keys are resolved
+	// later, by each lookup, so the parser keeps every entry.
+	var indexOpts = d.opts
+	indexOpts.symbols = nil
+	var s = newBytesScanner(d.data, &indexOpts)
+	s.discard = true
+	var p = newParser(s, &indexOpts)
+	p.sink = &lazyIndexer{doc: d, stack: []int32{0}, tails: []int32{-1}}
+	if _, err := p.parse(); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, positionError(d.opts.filename, s.line, s.column, err)
+	}
+	return d, nil
+}
+
+// lazyIndexer records the entries read by a parser in the index of a LazyDocument.
+type lazyIndexer struct {
+	doc *LazyDocument
+
+	// The open maps, and the last child added to each of them
+	stack []int32
+	tails []int32
+}
+
+// addEntry appends an entry to the innermost open map.
+func (x *lazyIndexer) addEntry(node *Node, end int64) {
+	// A map without a key is stored under the empty key at its opening brace
+	var e = lazyEntry{
+		keyStart:  int(node.KeyRange.Start.Offset),
+		keyEnd:    int(node.KeyRange.End.Offset),
+		end:       int(end),
+		line:      int32(node.KeyRange.Start.Line),
+		column:    int32(node.KeyRange.Start.Column),
+		child:     -1,
+		next:      -1,
+		isMap:     node.Type == NodeTypeMap,
+		condition: node.Condition,
+	}
+	if node.KeyRange == (Range{}) {
+		e.keyStart, e.keyEnd = int(node.ValueRange.Start.Offset), int(node.ValueRange.Start.Offset)
+		e.line, e.column = int32(node.Line), int32(node.Column)
+	}
+	e.quoted = e.keyEnd > e.keyStart && x.doc.data[e.keyStart] == '"'
+
+	var d = x.doc
+	var index = int32(len(d.entries))
+	d.entries = append(d.entries, e)
+
+	var parent, tail = x.stack[len(x.stack)-1], x.tails[len(x.tails)-1]
+	if tail < 0 {
+		d.entries[parent].child = index
+	} else {
+		d.entries[tail].next = index
+	}
+	x.tails[len(x.tails)-1] = index
+
+	if e.isMap {
+		x.stack, x.tails = append(x.stack, index), append(x.tails, -1)
+	}
+}
+
+// closeMap records the end of the innermost open map.
+func (x *lazyIndexer) closeMap(end int64) {
+	x.doc.entries[x.stack[len(x.stack)-1]].end = int(end)
+	x.stack, x.tails = x.stack[:len(x.stack)-1], x.tails[:len(x.tails)-1]
+}
+
+// key returns the key of an entry.
+func (d *LazyDocument) key(e *lazyEntry) string {
+	var text = d.keyText(e)
+	if d.opts.escapeSequences && bytes.IndexByte(text, '\\') >= 0 {
+		// Decode the escape sequences by scanning the key again
+		var s = newBytesScanner(d.data[e.keyStart:e.keyEnd], &d.opts)
+		if it, err := s.next(false); err == nil {
+			return it.value
+		}
+	}
+	return string(text)
+}
+
+// keyText returns the text of the key of an entry without its quotes.
+func (d *LazyDocument) keyText(e *lazyEntry) []byte {
+	if e.quoted {
+		return d.data[e.keyStart+1 : e.keyEnd-1]
+	}
+	return d.data[e.keyStart:e.keyEnd]
+}
+
+// hasKey reports whether the key of an entry is key.
+func (d *LazyDocument) hasKey(e *lazyEntry, key string) bool {
+	if d.opts.escapeSequences && bytes.IndexByte(d.keyText(e), '\\') >= 0 {
+		return d.key(e) == key
+	}
+	return string(d.keyText(e)) == key
+}
+
+// included reports whether the conditional of an entry, if any, keeps it in the document.
+func (d *LazyDocument) included(e *lazyEntry) bool {
+	if e.condition == "" || d.opts.symbols == nil {
+		return true
+	}
+	var expr, err = parseCondition(e.condition)
+	return err == nil && expr.eval(d.opts.symbols)
+}
+
+// find returns the entries that make up the value at path, following the duplicate key policy.
+// Several entries are returned when repeated maps are merged, or when every occurrence of a
+// repeated key is kept. It returns nil when there is no such path.
+func (d *LazyDocument) find(path []string) ([]int32, error) {
+	var found = []int32{0}
+	for _, key := range path {
+		// Collect every occurrence of the key in the maps found so far
+		var matches []int32
+		for _, parent := range d.parents(found) {
+			if !d.entries[parent].isMap {
+				continue
+			}
+			for i := d.entries[parent].child; i >= 0; i = d.entries[i].next {
+				if d.included(&d.entries[i]) && d.hasKey(&d.entries[i], key) {
+					matches = append(matches, i)
+				}
+			}
+		}
+		if len(matches) == 0 {
+			return nil, nil
+		}
+
+		var err error
+		if found, err = d.keep(key, matches); err != nil {
+			return nil, err
+		}
+	}
+	return found, nil
+}
+
+// keep returns the occurrences of a repeated key that make up its value under the duplicate key policy.
+func (d *LazyDocument) keep(key string, matches []int32) ([]int32, error) {
+	switch d.opts.duplicates {
+	case DuplicateKeepAll:
+		return matches, nil
+
+	case DuplicateFirstWins:
+		return matches[:1], nil
+
+	case DuplicateLastWins:
+		return matches[len(matches)-1:], nil
+
+	case DuplicateError:
+		if len(matches) > 1 {
+			var e = &d.entries[matches[1]]
+			return nil, newParseError(int(e.line), int(e.column), fmt.Sprintf("duplicate key %q", key))
+		}
+		return matches, nil
+
+	default:
+		// Maps are merged and anything else replaces the earlier occurrences
+		for i := len(matches) - 1; i >= 0; i-- {
+			if !d.entries[matches[i]].isMap {
+				if i == len(matches)-1 {
+					return matches[i:], nil
+				}
+				return matches[i+1:], nil
+			}
+		}
+		return matches, nil
+	}
+}
+
+// parents returns the entries found for a key whose children hold the next key of a path.
+// When every occurrence of a key is kept, only the first one is looked into, as in Node.Children.
+func (d *LazyDocument) parents(found []int32) []int32 {
+	if d.opts.duplicates == DuplicateKeepAll {
+		return found[:1]
+	}
+	return found
+}
+
+// Has reports whether there is a value at path.
+func (d *LazyDocument) Has(path ...string) bool {
+	var found, err = d.find(path)
+	return err == nil && found != nil
+}
+
+// Keys returns the keys of the map at path in source order, listing each key once.
+// It returns nil when there is no map at path.
+func (d *LazyDocument) Keys(path ...string) ([]string, error) {
+	var found, err = d.find(path)
+	if err != nil || found == nil || !d.entries[found[0]].isMap {
+		return nil, err
+	}
+
+	var keys []string
+	var seen = make(map[string]bool)
+	for _, parent := range d.parents(found) {
+		for i := d.entries[parent].child; i >= 0; i = d.entries[i].next {
+			if !d.included(&d.entries[i]) {
+				continue
+			}
+			var key = d.key(&d.entries[i])
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// Node decodes the value at path into a Node. With no path it decodes the whole document.
+// It returns nil when there is no value at path.
+//
+// Example:
+//
+//	node, err := doc.Node("items_game", "items", "42", "name")
+func (d *LazyDocument) Node(path ...string) (*Node, error) {
+	var found, err = d.find(path)
+	if err != nil || found == nil {
+		return nil, err
+	}
+
+	root, err := d.decode(found)
+	if err != nil || len(path) == 0 {
+		return root, err
+	}
+	return root.Children[path[len(path)-1]], nil
+}
+
+// All decodes every occurrence of the value at path, as Node.All returns them for the last key
+// of path in the tree built by Unmarshal. Without WithDuplicateKeys(DuplicateKeepAll) there is
+// at most one. With no path it returns the whole document, and it returns nil when there is
+// no value at path.
+//
+// Example:
+//
+//	waves, err := doc.All("rndwave", "wave")
+func (d *LazyDocument) All(path ...string) ([]*Node, error) {
+	var found, err = d.find(path)
+	if err != nil || found == nil {
+		return nil, err
+	}
+
+	root, err := d.decode(found)
+	if err != nil {
+		return nil, err
+	}
+	if len(path) == 0 {
+		return []*Node{root}, nil
+	}
+	return root.All(path[len(path)-1]), nil
+}
+
+// Decode decodes the value at path into v, which must be a pointer to a struct, a map,
+// an interface or a *Node, as for Unmarshal.
+// With no path it decodes the whole document. It returns an error wrapping ErrNotFound when
+// there is no value at path.
+//
+// Example:
+//
+//	var item struct {
+//	    Name string `vdf:"name"`
+//	}
+//	err := doc.Decode(&item, "items_game", "items", "42")
+func (d *LazyDocument) Decode(v any, path ...string) error {
+	node, err := d.Node(path...)
+	if err != nil {
+		return err
+	}
+	if node == nil {
+		return fmt.Errorf("%w: %q", ErrNotFound, strings.Join(path, "/"))
+	}
+	return unmarshalNode(node, v, &d.opts)
+}
+
+// decode parses the text of the given entries one after the other into a single tree,
+// so that repeated keys are combined exactly as the full decoder would combine them.
+// Positions are kept relative to the whole document.
+func (d *LazyDocument) decode(found []int32) (*Node, error) {
+	var p = newParser(nil, &d.opts)
+	for _, index := range found {
+		var e = &d.entries[index]
+		var s = newBytesScanner(d.data[e.keyStart:e.end], &d.opts)
+		s.line, s.column, s.offset = int(e.line), int(e.column), int64(e.keyStart)
+
+		p.scanner = s
+		if _, err := p.parse(); err != nil {
+			return nil, positionError(d.opts.filename, s.line, s.column, err)
+		}
+	}
+	return p.root, nil
+}
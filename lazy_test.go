@@ -0,0 +1,390 @@
+package govdf_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	govdf "github.com/lewisgibson/go-vdf"
+	"github.com/stretchr/testify/require"
+)
+
+// lookup returns the node at path in a decoded tree, or nil when there is none.
+func lookup(node *govdf.Node, path ...string) *govdf.Node {
+	for _, key := range path {
+		if node = node.Children[key]; node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+func TestLazyDocument_Node(t *testing.T) {
+	t.Parallel()
+
+	var input = "// Items\n" +
+		"\"items_game\"\n" +
+		"{\n" +
+		"\t\"items\"\n" +
+		"\t{\n" +
+		"\t\t\"1\" { \"name\" \"knife\" \"price\" \"100\" }\n" +
+		"\t\t\"2\" { \"name\" \"pistol\" [$WIN32] \"name\" \"pistole\" [$OSX] }\n" +
+		"\t\t\"3\" [$X360] { \"name\" \"console\" }\n" +
+		"\t}\n" +
+		"\t\"items\" { \"1\" { \"rarity\" \"common\" } \"4\" \"scalar\" }\n" +
+		"\t\"wave\" \"a.wav\"\n" +
+		"\t\"wave\" \"b.wav\"\n" +
+		"\t\"sound\" \"old\"\n" +
+		"\t\"sound\" { \"wave\" \"c.wav\" }\n" +
+		"\t\"escaped\\tkey\" \"value\"\n" +
+		"\t\"ünïcode\" { \"key\" \"välue\" }\n" +
+		"}\n" +
+		"\"items_game\" { \"extra\" \"1\" }\n" +
+		"{ \"keyless\" \"map\" }\n"
+
+	var paths = [][]string{
+		{},
+		{"items_game"},
+		{"items_game", "items"},
+		{"items_game", "items", "1"},
+		{"items_game", "items", "1", "name"},
+		{"items_game", "items", "2", "name"},
+		{"items_game", "items", "3"},
+		{"items_game", "items", "4"},
+		{"items_game", "wave"},
+		{"items_game", "sound"},
+		{"items_game", "sound", "wave"},
+		{"items_game", "escaped\tkey"},
+		{"items_game", "escaped\\tkey"},
+		{"items_game", "ünïcode", "key"},
+		{"items_game", "extra"},
+		{"", "keyless"},
+		{"missing"},
+		{"items_game", "wave", "missing"},
+	}
+
+	var testCases = map[string][]govdf.Option{
+		"default":              nil,
+		"conditions":           {govdf.WithConditions("$WIN32")},
+		"escape sequences":     {govdf.WithEscapeSequences()},
+		"duplicate keep all":   {govdf.WithDuplicateKeys(govdf.DuplicateKeepAll)},
+		"duplicate first wins": {govdf.WithDuplicateKeys(govdf.DuplicateFirstWins)},
+		"duplicate last wins":  {govdf.WithDuplicateKeys(govdf.DuplicateLastWins)},
+	}
+	for name, opts := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Arrange: Decode the whole input, and index it leniently like Unmarshal, which
+			// stores the keyless map under "".
+			var expected govdf.Node
+			require.NoError(t, govdf.Unmarshal([]byte(input), &expected, opts...))
+			doc, err := govdf.ParseLazyDocument([]byte(input), append([]govdf.Option{govdf.WithStrict(false)}, opts...)...)
+			require.NoError(t, err)
+
+			for _, path := range paths {
+				// Act: Look up the path.
+				node, err := doc.Node(path...)
+				require.NoError(t, err)
+
+				// Assert: The node should match the decoded tree apart from the comments around it.
+				var want = lookup(&expected, path...)
+				if want == nil {
+					require.Nil(t, node, "path %q", path)
+					require.False(t, doc.Has(path...), "path %q", path)
+					continue
+				}
+				require.True(t, doc.Has(path...), "path %q", path)
+				if len(path) > 0 {
+					if diff := cmp.Diff(want, node, cmpopts.IgnoreFields(govdf.Node{}, "HeadComment", "LineComment", "EndComment")); diff != "" {
+						t.Errorf("path %q: mismatch (-want +got):\n%s", path, diff)
+					}
+				} else if diff := cmp.Diff(want, node); diff != "" {
+					t.Errorf("mismatch (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestLazyDocument_Keys(t *testing.T) {
+	t.Parallel()
+
+	// Arrange: Index a document with repeated keys and maps.
+	var input = `"root" { "b" "1" "a" { "x" "1" } "b" "2" "c" "3" [$X360] } "root" { "d" "4" "a" "5" }`
+	doc, err := govdf.ParseLazyDocument([]byte(input), govdf.WithConditions("$WIN32"))
+	require.NoError(t, err)
+
+	// Act: List the keys of the root and the repeated map.
+	rootKeys, err := doc.Keys()
+	require.NoError(t, err)
+	keys, err := doc.Keys("root")
+	require.NoError(t, err)
+	scalarKeys, err := doc.Keys("root", "b")
+	require.NoError(t, err)
+
+	// Assert: Each key should be listed once in source order, skipping excluded entries.
+	require.Equal(t, []string{"root"}, rootKeys)
+	require.Equal(t, []string{"b", "a", "d"}, keys)
+	require.Nil(t, scalarKeys)
+}
+
+func TestLazyDocument_All(t *testing.T) {
+	t.Parallel()
+
+	var input = `"root" { "wave" "a.wav" "wave" "b.wav" "sound" { "wave" "c.wav" } "sound" { "wave" "d.wav" "wave" "e.wav" } }` +
+		` "root" { "wave" "f.wav" }`
+
+	var paths = [][]string{
+		{"root"},
+		{"root", "wave"},
+		{"root", "sound"},
+		{"root", "sound", "wave"},
+		{"root", "missing"},
+	}
+
+	var testCases = map[string][]govdf.Option{
+		"default":              nil,
+		"duplicate keep all":   {govdf.WithDuplicateKeys(govdf.DuplicateKeepAll)},
+		"duplicate first wins": {govdf.WithDuplicateKeys(govdf.DuplicateFirstWins)},
+		"duplicate last wins":  {govdf.WithDuplicateKeys(govdf.DuplicateLastWins)},
+	}
+	for name, opts := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Arrange: Decode the whole input, and index it.
+			var expected govdf.Node
+			require.NoError(t, govdf.Unmarshal([]byte(input), &expected, opts...))
+			doc, err := govdf.ParseLazyDocument([]byte(input), opts...)
+			require.NoError(t, err)
+
+			for _, path := range paths {
+				// Act: Look up every occurrence of the path.
+				nodes, err := doc.All(path...)
+				require.NoError(t, err)
+
+				// Assert: The nodes should match the occurrences in the decoded tree.
+				var want []*govdf.Node
+				if parent := lookup(&expected, path[:len(path)-1]...); parent != nil {
+					want = parent.All(path[len(path)-1])
+				}
+				if diff := cmp.Diff(want, nodes, cmpopts.EquateEmpty(), cmpopts.IgnoreFields(govdf.Node{}, "HeadComment", "LineComment", "EndComment")); diff != "" {
+					t.Errorf("path %q: mismatch (-want +got):\n%s", path, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestLazyDocument_DecodeKeepAll(t *testing.T) {
+	t.Parallel()
+
+	type Sound struct {
+		Waves []string `vdf:"wave,list=repeated"`
+	}
+	type Root struct {
+		Waves []string `vdf:"wave,list=repeated"`
+		Sound Sound    `vdf:"sound"`
+	}
+
+	// Arrange: Decode the whole input, and index it.
+	var input = `"root" { "wave" "a.wav" "wave" "b.wav" "sound" { "wave" "c.wav" "wave" "d.wav" } "sound" { "wave" "e.wav" } }`
+	var opts = []govdf.Option{govdf.WithDuplicateKeys(govdf.DuplicateKeepAll)}
+	var expected struct {
+		Root Root `vdf:"root"`
+	}
+	require.NoError(t, govdf.Unmarshal([]byte(input), &expected, opts...))
+	doc, err := govdf.ParseLazyDocument([]byte(input), opts...)
+	require.NoError(t, err)
+
+	// Act: Decode the repeated map.
+	var root Root
+	err = doc.Decode(&root, "root")
+
+	// Assert: Every occurrence should be decoded as Unmarshal decodes it.
+	require.NoError(t, err)
+	require.Equal(t, expected.Root, root)
+	require.Equal(t, []string{"a.wav", "b.wav"}, root.Waves)
+}
+
+func TestLazyDocument_Decode(t *testing.T) {
+	t.Parallel()
+
+	type Item struct {
+		Name  string `vdf:"name"`
+		Price int    `vdf:"price"`
+	}
+
+	// Arrange: Index a document.
+	var input = `"items" { "1" { "name" "knife" "price" "100" } "2" { "name" "pistol" "price" "oops" } }`
+	doc, err := govdf.ParseLazyDocument([]byte(input))
+	require.NoError(t, err)
+
+	t.Run("struct", func(t *testing.T) {
+		t.Parallel()
+
+		// Act: Decode a single item.
+		var item Item
+		err := doc.Decode(&item, "items", "1")
+
+		// Assert: Only the requested item should be decoded.
+		require.NoError(t, err)
+		require.Equal(t, Item{Name: "knife", Price: 100}, item)
+	})
+
+	t.Run("node", func(t *testing.T) {
+		t.Parallel()
+
+		// Act: Decode a scalar into a node.
+		var node govdf.Node
+		err := doc.Decode(&node, "items", "2", "name")
+
+		// Assert: The node should hold the value and its position in the whole document.
+		require.NoError(t, err)
+		require.Equal(t, "pistol", node.Value)
+		require.Equal(t, int64(53), node.KeyRange.Start.Offset)
+	})
+
+	t.Run("type error", func(t *testing.T) {
+		t.Parallel()
+
+		// Act: Decode an item with an invalid field.
+		var item Item
+		err := doc.Decode(&item, "items", "2")
+
+		// Assert: The error should describe the field.
+		var typeErr *govdf.TypeError
+		require.ErrorAs(t, err, &typeErr)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		t.Parallel()
+
+		// Act: Decode a missing path.
+		var item Item
+		err := doc.Decode(&item, "items", "3")
+
+		// Assert: The error should report the missing path.
+		require.ErrorIs(t, err, govdf.ErrNotFound)
+		require.EqualError(t, err, `no value at path: "items/3"`)
+	})
+}
+
+func TestLazyDocument_Errors(t *testing.T) {
+	t.Parallel()
+
+	var testCases = map[string]struct {
+		input   string
+		options []govdf.Option
+	}{
+		"unexpected close brace": {
+			input: `"a" "b" }`,
+		},
+		"key without value": {
+			input: `"a" { "b" }`,
+		},
+		"unclosed map": {
+			input: "\"a\" {\n\t\"b\" {\n",
+		},
+		"unterminated string": {
+			input: `"a" "b`,
+		},
+		"invalid conditional": {
+			input: `"a" "b" [$X &&]`,
+		},
+		"unexpected conditional": {
+			input: `"a" "b" [$X] [$Y]`,
+		},
+		"max depth": {
+			input:   `"a" { "b" { "c" "d" } }`,
+			options: []govdf.Option{govdf.WithLimits(govdf.Limits{MaxDepth: 1})},
+		},
+		"max nodes": {
+			input:   `"a" { "b" "c" "d" "e" }`,
+			options: []govdf.Option{govdf.WithLimits(govdf.Limits{MaxNodes: 2})},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act: Index the input and look up its first key.
+			doc, err := govdf.ParseLazyDocument([]byte(tc.input), tc.options...)
+			if err == nil {
+				_, err = doc.Node("a")
+			}
+
+			// Assert: The error should match the one reported by the decoder in strict mode.
+			var node govdf.Node
+			var expected = govdf.Unmarshal([]byte(tc.input), &node, append(tc.options, govdf.WithStrict(true))...)
+			require.Error(t, expected)
+			require.EqualError(t, err, expected.Error())
+		})
+	}
+}
+
+func TestLazyDocument_DuplicateError(t *testing.T) {
+	t.Parallel()
+
+	// Arrange: Index a document with a repeated key.
+	var input = `"a" "b"` + "\n" + `"a" "c"` + "\n" + `"d" "e"`
+	doc, err := govdf.ParseLazyDocument([]byte(input), govdf.WithDuplicateKeys(govdf.DuplicateError))
+	require.NoError(t, err)
+
+	// Act: Look up the repeated key and another key.
+	_, err = doc.Node("a")
+	node, otherErr := doc.Node("d")
+
+	// Assert: Only the lookup of the repeated key should fail, at its second occurrence.
+	var parseErr *govdf.ParseError
+	require.ErrorAs(t, err, &parseErr)
+	require.Equal(t, 2, parseErr.Line)
+	require.Equal(t, 1, parseErr.Column)
+	require.EqualError(t, err, `line 2, column 1: duplicate key "a"`)
+	require.NoError(t, otherErr)
+	require.Equal(t, "e", node.Value)
+}
+
+func TestLazyDocument_Lenient(t *testing.T) {
+	t.Parallel()
+
+	// Arrange: Index malformed input in lenient mode.
+	var input = "\"a\" {\n\t\"b\" \"c\"\n\t\"d\"\n\t\"e\" {\n"
+	doc, err := govdf.ParseLazyDocument([]byte(input), govdf.WithStrict(false))
+	require.NoError(t, err)
+
+	// Act: Look up the unclosed map.
+	node, err := doc.Node("a")
+	require.NoError(t, err)
+
+	// Assert: The node should match the one decoded by Unmarshal.
+	var expected govdf.Node
+	require.NoError(t, govdf.Unmarshal([]byte(input), &expected))
+	if diff := cmp.Diff(expected.Children["a"], node); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLazyDocument_Encoding(t *testing.T) {
+	t.Parallel()
+
+	// Arrange: Encode a document as UTF-16.
+	var input, err = govdf.Marshal(&govdf.Node{Type: govdf.NodeTypeMap, Children: map[string]*govdf.Node{
+		"lang": {Type: govdf.NodeTypeMap, Children: map[string]*govdf.Node{
+			"Tokens": {Type: govdf.NodeTypeMap, Children: map[string]*govdf.Node{
+				"greeting": {Type: govdf.NodeTypeScalar, Value: "héllo"},
+			}},
+		}},
+	}}, govdf.WithEncoding(govdf.EncodingUTF16LE))
+	require.NoError(t, err)
+
+	// Act: Index the document and look up a token.
+	doc, err := govdf.ParseLazyDocument(input)
+	require.NoError(t, err)
+	node, err := doc.Node("lang", "Tokens", "greeting")
+
+	// Assert: The text should be converted to UTF-8.
+	require.NoError(t, err)
+	require.Equal(t, "héllo", node.Value)
+}
@@ -0,0 +1,31 @@
+package govdf
+
+import "strings"
+
+// Key is the path of a value in a VDF document, made of the keys leading to it.
+type Key []string
+
+// String returns the keys of the path joined with '/'.
+func (k Key) String() string {
+	return strings.Join(k, "/")
+}
+
+// Metadata describes how a document was decoded into a struct, for finding typos and
+// missing settings in hand-edited files. It is filled in by decoders given WithMetadata.
+//
+// Example:
+//
+//	var md govdf.Metadata
+//	err := govdf.Unmarshal(data, &config, govdf.WithMetadata(&md))
+//	for _, key := range md.Undecoded {
+//	    fmt.Printf("unknown key %s\n", key)
+//	}
+type Metadata struct {
+	// Undecoded lists the keys of the document that have no matching struct field, in source order.
+	// The children of an undecoded key are not listed.
+	Undecoded []Key
+
+	// Unset lists the struct fields that no key was decoded into, as the path of keys they
+	// would have been decoded from. The fields of an unset struct field are not listed.
+	Unset []Key
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 )
 
 // NodeType represents the type of a VDF node.
@@ -47,18 +48,157 @@ type Node struct {
 	// This field is nil for NodeTypeScalar nodes.
 	Children map[string]*Node
 
+	// Duplicates contains the later occurrences of keys that appear more than once in this map,
+	// in source order. Children holds the first occurrence of each key.
+	// This field is only set when decoding with the DuplicateKeepAll policy.
+	Duplicates map[string][]*Node
+
+	// Keys records the order in which the keys of Children appeared in the source, with a key
+	// repeated once for every duplicate kept in Duplicates. Encoders write children in this order
+	// and then any keys missing from it sorted alphabetically.
+	Keys []string
+
+	// Directives contains the #include and #base directives of the document.
+	// This field is only set on the root node.
+	Directives []Directive
+
+	// Condition contains the conditional attached to this node, without the surrounding
+	// brackets, such as "$WIN32" or "!$X360 && !$PS3". For scalar nodes the conditional
+	// follows the value, for map nodes it precedes the opening brace.
+	Condition string
+
 	// HeadComment contains any comment that appears before this node.
 	// Comments are preserved during parsing and included in output.
 	HeadComment string
 
 	// LineComment contains any comment that appears on the same line as this node.
 	// Line comments are typically used for inline documentation.
+	// For map nodes this is the comment on the line of the opening brace.
 	LineComment string
 
+	// FootComment contains the comments of a map node that follow its last child,
+	// including the comments inside an empty map. On the root node it holds the
+	// comments at the end of the document.
+	FootComment string
+
+	// EndComment contains the comment on the same line as the closing brace of a map node.
+	EndComment string
+
 	// Line and Column provide the position of this node in the original VDF file.
-	// These are 1-indexed and useful for error reporting and debugging.
+	// These are 1-indexed and useful for error reporting and debugging. For map nodes
+	// they point at the opening brace, for quoted scalars at the column before the opening quote.
+	// KeyRange and ValueRange give the exact extent of the key and value.
 	Line   int
 	Column int
+
+	// KeyRange is the span of the key of this node, including its quotes.
+	// It is zero for the root node and for a map without a key.
+	KeyRange Range
+
+	// ValueRange is the span of the value of a scalar node, including its quotes,
+	// or of a map node from its opening brace to its closing brace.
+	// It is zero for the root node. A map that is still open at the end of the input ends there.
+	ValueRange Range
+}
+
+// Position is a location in VDF input.
+// The binary decoder only records the offset and leaves the line and column zero.
+type Position struct {
+	Line   int   // Line number (1-indexed)
+	Column int   // Column number counted in characters (1-indexed)
+	Offset int64 // Number of bytes of input before the position
+}
+
+// Range is a span of VDF input from Start up to but not including End.
+// Offsets count the bytes of input after conversion to UTF-8.
+//
+// Example:
+//
+//	var name = node.Children["name"]
+//	fmt.Printf("value at %d:%d-%d:%d\n", name.ValueRange.Start.Line, name.ValueRange.Start.Column,
+//	    name.ValueRange.End.Line, name.ValueRange.End.Column)
+type Range struct {
+	Start Position
+	End   Position
+}
+
+// All returns every child stored under key in source order,
+// including any duplicates kept by the DuplicateKeepAll policy.
+// It returns nil when the key does not exist.
+//
+// Example:
+//
+//	for _, wave := range node.Children["rndwave"].All("wave") {
+//	    fmt.Println(wave.Value)
+//	}
+func (n *Node) All(key string) []*Node {
+	var first, ok = n.Children[key]
+	if !ok {
+		return nil
+	}
+	return append([]*Node{first}, n.Duplicates[key]...)
+}
+
+// set stores child under key, replacing any previous value while keeping the position of the key.
+func (n *Node) set(key string, child *Node) {
+	if n.Children == nil {
+		n.Children = make(map[string]*Node)
+	}
+	if _, ok := n.Children[key]; !ok {
+		n.Keys = append(n.Keys, key)
+	}
+	n.Children[key] = child
+	delete(n.Duplicates, key)
+}
+
+// keyedNode is a single child of a map node along with its key.
+type keyedNode struct {
+	key  string
+	node *Node
+}
+
+// entries returns every child of a map node in the order it should be written.
+// Children listed in Keys come first in that order, followed by the remaining children
+// sorted by key. When sorted is true Keys is ignored and all children are sorted by key.
+func (n *Node) entries(sorted bool) []keyedNode {
+	var result = make([]keyedNode, 0, len(n.Children))
+	var seen = make(map[string]int, len(n.Children))
+
+	if !sorted {
+		for _, key := range n.Keys {
+			var child, ok = n.Children[key]
+			if !ok {
+				continue
+			}
+
+			// Later occurrences of a key refer to its duplicates
+			var occurrence = seen[key]
+			if occurrence > 0 {
+				if occurrence > len(n.Duplicates[key]) {
+					continue
+				}
+				child = n.Duplicates[key][occurrence-1]
+			}
+			seen[key] = occurrence + 1
+			result = append(result, keyedNode{key: key, node: child})
+		}
+	}
+
+	// Add the children that are not listed in Keys
+	var rest = make([]string, 0, len(n.Children)-len(seen))
+	for key := range n.Children {
+		if seen[key] <= len(n.Duplicates[key]) {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	for _, key := range rest {
+		for _, child := range n.All(key)[seen[key]:] {
+			result = append(result, keyedNode{key: key, node: child})
+		}
+	}
+
+	return result
 }
 
 // MarshalJSON returns the JSON encoding of the node.
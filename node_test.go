@@ -439,3 +439,26 @@ func TestNode_UnmarshalJSON_UnsupportedType(t *testing.T) {
 		})
 	}
 }
+
+func TestNode_All(t *testing.T) {
+	t.Parallel()
+
+	var first = &govdf.Node{Type: govdf.NodeTypeScalar, Value: "a.wav"}
+	var second = &govdf.Node{Type: govdf.NodeTypeScalar, Value: "b.wav"}
+	var third = &govdf.Node{Type: govdf.NodeTypeScalar, Value: "c.wav"}
+	var node = govdf.Node{
+		Type: govdf.NodeTypeMap,
+		Children: map[string]*govdf.Node{
+			"wave":   first,
+			"volume": {Type: govdf.NodeTypeScalar, Value: "1"},
+		},
+		Duplicates: map[string][]*govdf.Node{
+			"wave": {second, third},
+		},
+	}
+
+	// Assert: All occurrences should be returned in order.
+	require.Equal(t, []*govdf.Node{first, second, third}, node.All("wave"))
+	require.Len(t, node.All("volume"), 1)
+	require.Nil(t, node.All("missing"))
+}
@@ -0,0 +1,280 @@
+package govdf
+
+// Option configures the behaviour of a Decoder or Encoder.
+// Options are passed to the constructors and to the package level helpers such as Marshal.
+// An option that does not apply to a particular component is ignored by it.
+//
+// Example:
+//
+//	data, err := govdf.Marshal(node, govdf.WithUnquotedStrings())
+type Option func(*options)
+
+// options holds the configuration shared by the decoders and encoders.
+type options struct {
+	// unquotedStrings writes keys and values without quotes when it is safe to do so.
+	unquotedStrings bool
+
+	// escapeSequences decodes and encodes \n, \t, \\ and \" inside quoted strings.
+	escapeSequences bool
+
+	// sortedKeys makes the encoders write keys alphabetically instead of in source order.
+	sortedKeys bool
+
+	// duplicates decides how repeated keys within the same map are stored.
+	duplicates DuplicatePolicy
+
+	// encoding is the character encoding of the text read by the Decoder or written by the Encoder.
+	encoding Encoding
+
+	// symbols holds the defined conditional symbols. Conditionals are only evaluated when it is non-nil.
+	symbols map[string]bool
+
+	// filename is the name of the document being decoded, used in errors and to resolve directives.
+	filename string
+
+	// resolver opens the files referenced by #include and #base directives.
+	resolver Resolver
+
+	// recover makes the Decoder skip over errors and collect them instead of stopping at the first.
+	recover bool
+
+	// limits bounds the resources used by the decoders.
+	limits Limits
+
+	// strict rejects keys without a value, maps without a key, unterminated strings and unclosed maps.
+	// strictSet records that it was chosen with WithStrict, for the entry points that are strict by default.
+	strict    bool
+	strictSet bool
+
+	// disallowUnknownFields rejects keys without a matching struct field.
+	disallowUnknownFields bool
+
+	// metadata receives the keys and struct fields left undecoded.
+	metadata *Metadata
+}
+
+// newOptions returns the configuration produced by applying opts in order.
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
+
+// WithConditions makes the Decoder evaluate conditionals such as [$WIN32] or [!$X360 && $POSIX]
+// against the given symbols. Entries whose conditional evaluates to false are dropped from
+// the decoded tree. Symbols are matched case-insensitively and the leading '$' is optional.
+//
+// Without this option conditionals are only validated and recorded in Node.Condition.
+//
+// Example:
+//
+//	err := govdf.Unmarshal(data, &node, govdf.WithConditions("$WIN32", "$DECK"))
+func WithConditions(symbols ...string) Option {
+	return func(o *options) {
+		o.symbols = make(map[string]bool, len(symbols))
+		for _, symbol := range symbols {
+			o.symbols[normalizeSymbol(symbol)] = true
+		}
+	}
+}
+
+// WithDisallowUnknownFields makes decoding into a struct fail with an UnknownFieldError when
+// a key has no matching struct field, instead of skipping it. This catches typos in hand-edited
+// configuration files. Keys decoded into maps, generic values or an Unmarshaler are always known.
+//
+// Example:
+//
+//	err := govdf.Unmarshal(data, &config, govdf.WithDisallowUnknownFields())
+func WithDisallowUnknownFields() Option {
+	return func(o *options) {
+		o.disallowUnknownFields = true
+	}
+}
+
+// DuplicatePolicy decides what the Decoder does when a key appears more than once in the same map,
+// such as repeated "wave" keys in a soundscript or repeated "solid" blocks in a VMF.
+type DuplicatePolicy uint8
+
+const (
+	// DuplicateMerge merges the children of repeated maps and keeps the last value of repeated scalars.
+	// This is the default policy.
+	DuplicateMerge DuplicatePolicy = iota
+
+	// DuplicateKeepAll keeps every occurrence. The first is stored in Node.Children and the
+	// rest in Node.Duplicates, and all of them are returned by Node.All. When decoding into
+	// Go values, every occurrence fills a list=repeated field or an OrderedMap, and otherwise
+	// the last occurrence is decoded into struct fields, maps and generic values alike.
+	DuplicateKeepAll
+
+	// DuplicateFirstWins keeps the first occurrence and discards the rest.
+	DuplicateFirstWins
+
+	// DuplicateLastWins keeps the last occurrence and discards the rest.
+	DuplicateLastWins
+
+	// DuplicateError makes decoding fail with a ParseError when a key is repeated.
+	DuplicateError
+)
+
+// WithDuplicateKeys sets the policy the Decoder applies to keys that appear more than once in the same map.
+//
+// Example:
+//
+//	err := govdf.Unmarshal(data, &node, govdf.WithDuplicateKeys(govdf.DuplicateKeepAll))
+func WithDuplicateKeys(policy DuplicatePolicy) Option {
+	return func(o *options) {
+		o.duplicates = policy
+	}
+}
+
+// WithEncoding sets the character encoding of VDF text.
+// The Decoder converts input in the encoding to UTF-8, and the Encoder converts its output
+// from UTF-8 to the encoding. UTF-16 output starts with a byte order mark, which the game
+// requires for localization files.
+//
+// Without this option text is UTF-8, but the Decoder still detects UTF-16 input from its byte order mark.
+//
+// Example:
+//
+//	err := govdf.NewEncoder(file, govdf.WithEncoding(govdf.EncodingUTF16LE)).Encode(node)
+func WithEncoding(enc Encoding) Option {
+	return func(o *options) {
+		o.encoding = enc
+	}
+}
+
+// WithEscapeSequences enables the escape sequences \n, \t, \\ and \" inside quoted keys and values.
+// The Decoder replaces them with the characters they represent and the Encoder escapes those
+// characters, so any string survives a round trip. Other escape sequences are kept as written.
+//
+// Without this option backslashes are read and written verbatim, matching Valve tools that
+// load files with escapes disabled, and only a quote preceded by a backslash inside a value is unescaped.
+func WithEscapeSequences() Option {
+	return func(o *options) {
+		o.escapeSequences = true
+	}
+}
+
+// WithFilename sets the name of the document being decoded.
+// The name is reported in errors and #include and #base paths are resolved relative to its directory.
+func WithFilename(name string) Option {
+	return func(o *options) {
+		o.filename = name
+	}
+}
+
+// Limits bounds the resources a Decoder or BinaryDecoder may use, so that untrusted input
+// such as workshop uploads cannot exhaust memory or the stack. A zero field means no limit.
+// Exceeding a limit stops decoding with a LimitError.
+type Limits struct {
+	MaxDepth       int   // Maximum nesting depth of maps, where a top-level map has depth 1
+	MaxKeyLength   int   // Maximum length of a key in bytes
+	MaxValueLength int   // Maximum length of a scalar value in bytes
+	MaxNodes       int   // Maximum number of nodes in a decoded document
+	MaxInputBytes  int64 // Maximum number of bytes read from the input
+}
+
+// WithLimits sets the resource limits enforced by the Decoder and BinaryDecoder.
+// Text input in an encoding other than UTF-8 is counted after conversion to UTF-8.
+//
+// Example:
+//
+//	err := govdf.Unmarshal(data, &node, govdf.WithLimits(govdf.Limits{
+//	    MaxDepth:      32,
+//	    MaxNodes:      100000,
+//	    MaxInputBytes: 16 << 20,
+//	}))
+func WithLimits(limits Limits) Option {
+	return func(o *options) {
+		o.limits = limits
+	}
+}
+
+// WithMetadata makes decoding into a struct record in md the keys that had no matching
+// struct field and the struct fields that no key was decoded into. The metadata is
+// replaced on every call to Decode.
+//
+// Example:
+//
+//	var md govdf.Metadata
+//	err := govdf.Unmarshal(data, &config, govdf.WithMetadata(&md))
+func WithMetadata(md *Metadata) Option {
+	return func(o *options) {
+		o.metadata = md
+	}
+}
+
+// WithRecovery makes the Decoder recover from errors instead of stopping at the first one.
+// The Decoder skips stray braces and unexpected characters, drops keys without a value and
+// maps without a key, ends an unterminated string at the end of its line and carries on, so
+// that every problem in a file is found in one pass. Decode still stores the best-effort result and then returns an ErrorList
+// holding every diagnostic, including warnings such as a missing closing brace.
+//
+// Example:
+//
+//	err := govdf.Unmarshal(data, &node, govdf.WithRecovery())
+//	var list govdf.ErrorList
+//	if errors.As(err, &list) {
+//	    for _, diagnostic := range list {
+//	        fmt.Println(diagnostic)
+//	    }
+//	}
+func WithRecovery() Option {
+	return func(o *options) {
+		o.recover = true
+	}
+}
+
+// WithResolver makes the Decoder load the files referenced by #include and #base directives
+// using r and merge them into the decoded document. #include appends the keys of the referenced
+// file, while #base only fills in keys that are missing. Without this option directives are
+// only recorded in Node.Directives.
+func WithResolver(r Resolver) Option {
+	return func(o *options) {
+		o.resolver = r
+	}
+}
+
+// WithSortedKeys makes the Encoder and BinaryEncoder write the children of every map sorted by key,
+// ignoring the order recorded in Node.Keys. This produces deterministic output regardless of
+// the order in which the input was decoded or built.
+func WithSortedKeys() Option {
+	return func(o *options) {
+		o.sortedKeys = true
+	}
+}
+
+// WithStrict enables or disables strict syntax checking in the Decoder.
+// In strict mode a key without a value, a map without a key, an unterminated quoted string and
+// a map that is still open at the end of the input are reported as a ParseError. In lenient
+// mode the key is dropped, the map is stored under "", the string ends with an
+// io.ErrUnexpectedEOF error and the open maps are closed silently, so that sloppy game files
+// still load.
+//
+// Unmarshal, Decoder.Decode and Decoder.Token are lenient by default to stay compatible with
+// existing callers. The newer entry points ParseDocument, ParseLazyDocument,
+// Decoder.DecodeDocument and Decoder.DecodeContext are strict by default and accept
+// WithStrict(false).
+// When combined with WithRecovery, unclosed maps are reported as errors instead of warnings.
+//
+// Example:
+//
+//	err := govdf.Unmarshal(data, &node, govdf.WithStrict(true))
+func WithStrict(strict bool) Option {
+	return func(o *options) {
+		o.strict, o.strictSet = strict, true
+	}
+}
+
+// WithUnquotedStrings makes the Encoder write keys and values without surrounding quotes
+// whenever they can be read back unchanged. Strings that are empty or contain whitespace,
+// quotes, braces, backslashes, control characters or a comment marker are still quoted.
+func WithUnquotedStrings() Option {
+	return func(o *options) {
+		o.unquotedStrings = true
+	}
+}
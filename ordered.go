@@ -0,0 +1,33 @@
+package govdf
+
+// OrderedMap is a VDF map decoded as a generic value that keeps its keys in source order,
+// including every occurrence of a repeated key. A field or target of this type receives
+// nested maps as OrderedMap values and scalars as strings, while a field or target of
+// type any receives map[string]any values instead.
+//
+// An OrderedMap is encoded with its entries in order, so repeated keys are written again.
+//
+// Example:
+//
+//	var sounds govdf.OrderedMap
+//	err := govdf.Unmarshal(data, &sounds, govdf.WithDuplicateKeys(govdf.DuplicateKeepAll))
+//	for _, entry := range sounds {
+//	    fmt.Println(entry.Key, entry.Value)
+//	}
+type OrderedMap []MapEntry
+
+// MapEntry is a single key and value of an OrderedMap.
+type MapEntry struct {
+	Key   string
+	Value any
+}
+
+// Get returns the value of the last entry with the given key, and whether there is one.
+func (m OrderedMap) Get(key string) (any, bool) {
+	for i := len(m) - 1; i >= 0; i-- {
+		if m[i].Key == key {
+			return m[i].Value, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,523 @@
+package govdf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// parser builds a Node tree from the items produced by a scanner.
+// It is the state machine behind Decoder and is used for a single parse.
+type parser struct {
+	scanner *scanner
+	opts    *options
+
+	root  *Node
+	stack []*Node
+
+	// The key waiting for its value, along with the comment and conditional read before the value
+	key         string
+	keyToken    item
+	hasKey      bool
+	headComment string
+	condition   string
+	conditionOK bool
+
+	// A scalar waiting for a possible trailing conditional before it is added to its parent
+	pending    *Node
+	pendingKey item
+	pendingOK  bool
+
+	// Where a comment on the line of the last scalar or brace is stored, and the line it ended on
+	trailing *string
+	lastLine int
+
+	// A directive waiting for its path
+	directive *Directive
+
+	// When single is set, parsing stops as soon as the first top-level entry is complete
+	single bool
+
+	// When sink is set, entries are passed to it instead of being added to the tree, and
+	// pendingEnd is the offset just after the pending scalar or its trailing conditional
+	sink       entrySink
+	pendingEnd int64
+	scratch    Node
+
+	// The number of nodes created, checked against the MaxNodes limit
+	nodes int
+}
+
+// entrySink receives the entries read by a parser in place of the tree it would build, for
+// callers such as LazyDocument that only record where each entry is.
+type entrySink interface {
+	// addEntry is called for every scalar and map, with the node read for it. The end of a
+	// scalar is the offset just after its value or trailing conditional, while the end of
+	// a map is passed to closeMap.
+	addEntry(node *Node, end int64)
+
+	// closeMap is called when the innermost open map ends, either at its closing brace or
+	// at the end of the input.
+	closeMap(end int64)
+}
+
+// newParser returns a parser that reads items from s.
+func newParser(s *scanner, opts *options) *parser {
+	// Create root node
+	root := &Node{
+		Type:     NodeTypeMap,
+		Line:     1,
+		Column:   1,
+		Children: make(map[string]*Node),
+	}
+
+	return &parser{
+		scanner: s,
+		opts:    opts,
+		root:    root,
+		stack:   []*Node{root},
+	}
+}
+
+// parse parses the VDF data into a Node struct.
+// This is the main parsing method that processes the entire VDF document.
+func (p *parser) parse() (*Node, error) {
+	for {
+		tok, err := p.scanner.next(p.hasKey)
+		if err != nil {
+			// When recovering, an error the scanner cannot skip past ends the input
+			var pos = item{kind: itemEOF, line: p.scanner.line, column: p.scanner.column, endLine: p.scanner.line, endColumn: p.scanner.column}
+			if !p.opts.recover || !errors.Is(err, io.ErrUnexpectedEOF) {
+				return p.root, err
+			}
+			_ = p.fail(newParseError(pos.line, pos.column, err.Error()), pos)
+			tok = pos
+		}
+
+		// A directive is always followed by the path it references
+		if p.directive != nil {
+			var directive = p.directive
+			p.directive = nil
+			if tok.kind == itemString {
+				directive.Path = tok.value
+				p.root.Directives = append(p.root.Directives, *directive)
+				continue
+			}
+			if err := p.fail(newParseErrorWithExpected(tok.line, tok.column, "expected path after "+directive.Kind.String(), "path", tok.value), tok); err != nil {
+				return p.root, err
+			}
+		}
+
+		// A scalar is added to its parent once we know whether a conditional follows it
+		if p.pending != nil {
+			if tok.kind == itemCondition {
+				if err := p.trailingCondition(tok); err != nil {
+					return p.root, err
+				}
+				continue
+			}
+			if err := p.commitScalar(); err != nil {
+				return p.root, err
+			}
+		}
+
+		// In strict mode a key without a value is an error. When recovering it is reported and dropped.
+		if p.hasKey && (p.opts.recover || p.opts.strict) && (tok.kind == itemEOF || tok.kind == itemCloseBrace) {
+			if err := p.fail(newParseErrorWithExpected(p.keyToken.line, p.keyToken.column, "expected value after key", "value", foundText(tok)), p.keyToken); err != nil {
+				return p.root, err
+			}
+			p.reset()
+		}
+
+		switch tok.kind {
+		case itemEOF:
+			// Comments after the last entry belong to the end of the document
+			p.root.FootComment = strings.TrimSpace(p.headComment)
+			for i := len(p.stack) - 1; i > 0; i-- {
+				p.stack[i].ValueRange.End = tok.span().Start
+				if p.sink != nil {
+					p.sink.closeMap(tok.offset)
+				}
+			}
+			return p.root, p.unclosedMaps()
+
+		case itemComment:
+			p.comment(tok)
+
+		case itemCondition:
+			if err := p.leadingCondition(tok); err != nil {
+				return p.root, err
+			}
+
+		case itemString:
+			p.trailing = nil
+			if !p.hasKey {
+				// #include and #base are only recognised at the top level
+				if kind, ok := parseDirectiveKind(tok.value); ok && len(p.stack) == 1 {
+					p.directive = &Directive{Kind: kind, Line: tok.line, Column: tok.column}
+					p.headComment = ""
+					continue
+				}
+				p.key, p.keyToken, p.hasKey = tok.value, tok, true
+				continue
+			}
+			if err := p.scalar(tok); err != nil {
+				return p.root, err
+			}
+			if p.single && len(p.stack) == 1 {
+				if err := p.topLevelScalar(); err != nil || p.complete() {
+					return p.root, err
+				}
+			}
+
+		case itemOpenBrace:
+			if err := p.openMap(tok); err != nil {
+				return p.root, err
+			}
+
+		case itemCloseBrace:
+			// End of current map
+			if len(p.stack) <= 1 {
+				if err := p.fail(newParseError(tok.line, tok.column, "unexpected '}' at root level"), tok); err != nil {
+					return p.root, err
+				}
+				continue
+			}
+			p.closeMap(tok)
+			if p.complete() {
+				return p.root, nil
+			}
+		}
+	}
+}
+
+// comment attaches a comment to the scalar or brace on the same line,
+// or keeps it as the head comment of the next VDF element.
+func (p *parser) comment(tok item) {
+	if p.trailing != nil && tok.line == p.lastLine {
+		*p.trailing = tok.value
+		p.trailing = nil
+		return
+	}
+
+	if tok.value != "" {
+		if p.headComment != "" {
+			p.headComment += "\n"
+		}
+		p.headComment += tok.value
+	}
+}
+
+// scalar creates a scalar node for the current key.
+// The node is held back until the next item shows whether a conditional follows it.
+func (p *parser) scalar(tok item) error {
+	if err := p.countNode(tok); err != nil {
+		return err
+	}
+
+	// Quoted values report the column just before their opening quote
+	var column = tok.column
+	if tok.quoted {
+		column--
+	}
+
+	// A sink only looks at the node while it is being added, so a single node is reused
+	p.pending = &p.scratch
+	if p.sink == nil {
+		p.pending = new(Node)
+	}
+	*p.pending = Node{
+		Type:        NodeTypeScalar,
+		Value:       tok.value,
+		Condition:   p.condition,
+		Line:        tok.line,
+		Column:      column,
+		KeyRange:    p.keyToken.span(),
+		ValueRange:  tok.span(),
+		HeadComment: strings.TrimSpace(p.headComment),
+	}
+	p.pendingKey = p.keyToken
+	p.pendingOK = p.conditionOK || p.condition == ""
+	p.pendingEnd = tok.endOffset
+	p.trailing = &p.pending.LineComment
+	p.lastLine = p.scanner.line
+	p.reset()
+	return nil
+}
+
+// countNode counts a new node against the MaxNodes limit.
+func (p *parser) countNode(tok item) error {
+	p.nodes++
+	if limit := p.opts.limits.MaxNodes; limit > 0 && p.nodes > limit {
+		return &LimitError{Limit: "MaxNodes", Max: int64(limit), Line: tok.line, Column: tok.column, Offset: tok.offset}
+	}
+	return nil
+}
+
+// commitScalar adds the pending scalar to its parent unless its conditional excluded it.
+func (p *parser) commitScalar() error {
+	var node, key, ok = p.pending, p.pendingKey, p.pendingOK
+	p.pending = nil
+	if !ok {
+		return nil
+	}
+	if p.sink != nil {
+		p.sink.addEntry(node, p.pendingEnd)
+		return nil
+	}
+
+	if _, err := addChild(p.stack[len(p.stack)-1], key.value, node, p.opts.duplicates); err != nil {
+		return p.fail(newParseError(key.line, key.column, err.Error()), key)
+	}
+	return nil
+}
+
+// topLevelScalar ends a top-level scalar when parsing a single entry. Reading the next item
+// could wait for the next document of a stream, so a trailing conditional is only read when
+// it is already buffered. A comment on the same line is left for the next parse to attach.
+func (p *parser) topLevelScalar() error {
+	if !p.scanner.conditionBuffered() {
+		return p.commitScalar()
+	}
+	tok, err := p.scanner.next(false)
+	if err != nil {
+		return err
+	}
+	return p.trailingCondition(tok)
+}
+
+// complete reports whether parsing a single entry is finished, which is when the first
+// top-level entry that was not excluded by a conditional has been added to the root.
+func (p *parser) complete() bool {
+	return p.single && len(p.stack) == 1 && len(p.root.Children) > 0
+}
+
+// addChild adds child to parent under key, applying policy when the key already exists.
+// It returns the node that holds the contents of child, which is the existing node
+// when two maps are merged.
+func addChild(parent *Node, key string, child *Node, policy DuplicatePolicy) (*Node, error) {
+	if parent.Children == nil {
+		parent.Children = make(map[string]*Node)
+	}
+
+	var existing, ok = parent.Children[key]
+	if !ok {
+		parent.Children[key] = child
+		parent.Keys = append(parent.Keys, key)
+		return child, nil
+	}
+
+	switch policy {
+	case DuplicateKeepAll:
+		if parent.Duplicates == nil {
+			parent.Duplicates = make(map[string][]*Node)
+		}
+		parent.Duplicates[key] = append(parent.Duplicates[key], child)
+		parent.Keys = append(parent.Keys, key)
+
+	case DuplicateFirstWins:
+		// Keep the existing node, the child is left detached
+
+	case DuplicateLastWins:
+		parent.set(key, child)
+
+	case DuplicateError:
+		return nil, fmt.Errorf("duplicate key %q", key)
+
+	default:
+		// Merge children of duplicate maps, replace anything else
+		if existing.Type != NodeTypeMap || child.Type != NodeTypeMap {
+			parent.Children[key] = child
+			return child, nil
+		}
+		for _, e := range child.entries(false) {
+			if _, err := addChild(existing, e.key, e.node, policy); err != nil {
+				return nil, err
+			}
+		}
+		return existing, nil
+	}
+
+	return child, nil
+}
+
+// openMap starts a new map node for the current key.
+// Maps excluded by their conditional are still parsed but never added to their parent.
+// In strict mode a map without a key is an error. When recovering it is reported, then read
+// without being added so that the braces stay balanced, and otherwise it is stored under "".
+func (p *parser) openMap(tok item) error {
+	// The stack holds the root, so its length is the depth of the new map
+	if limit := p.opts.limits.MaxDepth; limit > 0 && len(p.stack) > limit {
+		return &LimitError{Limit: "MaxDepth", Max: int64(limit), Line: tok.line, Column: tok.column, Offset: tok.offset}
+	}
+	if err := p.countNode(tok); err != nil {
+		return err
+	}
+
+	var keyless = !p.hasKey && (p.opts.recover || p.opts.strict)
+	if keyless {
+		if err := p.fail(newParseErrorWithExpected(tok.line, tok.column, "unexpected '{'", "key", "{"), tok); err != nil {
+			return err
+		}
+	}
+
+	var newNode = &Node{
+		Type:        NodeTypeMap,
+		Condition:   p.condition,
+		Line:        tok.line,
+		Column:      tok.column,
+		ValueRange:  Range{Start: tok.span().Start},
+		HeadComment: strings.TrimSpace(p.headComment),
+	}
+	if p.hasKey {
+		newNode.KeyRange = p.keyToken.span()
+	}
+
+	// Duplicate maps may be merged into the existing node. A map that cannot be added
+	// is still read, so that a recovering parse keeps its braces balanced.
+	var err error
+	switch {
+	case p.sink != nil:
+		p.sink.addEntry(newNode, 0)
+
+	case !keyless && (p.conditionOK || p.condition == ""):
+		var node *Node
+		if node, err = addChild(p.stack[len(p.stack)-1], p.key, newNode, p.opts.duplicates); err == nil {
+			newNode = node
+		} else {
+			err = p.fail(newParseError(p.keyToken.line, p.keyToken.column, err.Error()), p.keyToken)
+		}
+	}
+
+	p.stack = append(p.stack, newNode)
+	p.trailing, p.lastLine = &newNode.LineComment, tok.line
+	p.reset()
+	return err
+}
+
+// closeMap ends the current map. Comments read since its last entry become its foot comment.
+func (p *parser) closeMap(tok item) {
+	var node = p.stack[len(p.stack)-1]
+	if comment := strings.TrimSpace(p.headComment); comment != "" {
+		if node.FootComment != "" {
+			comment = node.FootComment + "\n" + comment
+		}
+		node.FootComment = comment
+	}
+	p.headComment = ""
+
+	node.ValueRange.End = tok.span().End
+	if p.sink != nil {
+		p.sink.closeMap(tok.endOffset)
+	}
+
+	p.stack = p.stack[:len(p.stack)-1]
+	p.trailing, p.lastLine = &node.EndComment, tok.line
+}
+
+// leadingCondition records a conditional that appears between a key and its value.
+func (p *parser) leadingCondition(tok item) error {
+	if !p.hasKey || p.condition != "" {
+		return p.fail(newParseErrorWithExpected(tok.line, tok.column, "unexpected conditional", "key or value", "["+tok.value+"]"), tok)
+	}
+
+	var ok, err = p.evaluateCondition(tok)
+	if err != nil {
+		return p.fail(err, tok)
+	}
+	p.condition, p.conditionOK = tok.value, ok
+	return nil
+}
+
+// trailingCondition records a conditional that follows a scalar value.
+func (p *parser) trailingCondition(tok item) error {
+	if p.pending.Condition != "" {
+		return p.fail(newParseErrorWithExpected(tok.line, tok.column, "unexpected conditional", "key", "["+tok.value+"]"), tok)
+	}
+
+	var ok, err = p.evaluateCondition(tok)
+	if err != nil {
+		return p.fail(err, tok)
+	}
+	p.pending.Condition, p.pendingOK = tok.value, ok
+	p.pendingEnd = tok.endOffset
+	p.lastLine = p.scanner.line
+	return p.commitScalar()
+}
+
+// evaluateCondition validates a conditional and evaluates it against the defined symbols.
+// Conditionals are always true when the decoder has not been configured with WithConditions.
+func (p *parser) evaluateCondition(tok item) (bool, error) {
+	var expr, err = parseCondition(tok.value)
+	if err != nil {
+		return false, newParseErrorWithExpected(tok.line, tok.column, "invalid conditional: "+err.Error(), "conditional expression", "["+tok.value+"]")
+	}
+	if p.opts.symbols == nil {
+		return true, nil
+	}
+	return expr.eval(p.opts.symbols), nil
+}
+
+// fail returns err, or when recovering from errors records it as a diagnostic and returns nil
+// so that parsing continues. Diagnostics cover the text of tok unless they have their own range.
+func (p *parser) fail(err error, tok item) error {
+	if !p.opts.recover {
+		return err
+	}
+
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		parseErr = newParseError(tok.line, tok.column, err.Error())
+	}
+	if parseErr.EndLine == 0 {
+		parseErr.EndLine, parseErr.EndColumn = tok.endLine, tok.endColumn
+	}
+	p.scanner.report(parseErr)
+	return nil
+}
+
+// unclosedMaps reports the maps still open at the end of the input, starting with the innermost.
+// When recovering each one is recorded, as a warning unless in strict mode. Otherwise strict
+// mode fails on the innermost one and lenient mode accepts the missing braces silently.
+func (p *parser) unclosedMaps() error {
+	if !p.opts.recover && !p.opts.strict {
+		return nil
+	}
+	for i := len(p.stack) - 1; i > 0; i-- {
+		var node = p.stack[i]
+		var parseErr = newParseErrorWithExpected(node.Line, node.Column, "unclosed '{'", "}", "end of input")
+		if !p.opts.strict {
+			parseErr.Severity = SeverityWarning
+		}
+		parseErr.EndLine, parseErr.EndColumn = node.Line, node.Column+1
+		if err := p.fail(parseErr, item{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// foundText describes an item for the Found field of a ParseError.
+func foundText(tok item) string {
+	switch tok.kind {
+	case itemEOF:
+		return "end of input"
+
+	case itemOpenBrace:
+		return "{"
+
+	case itemCloseBrace:
+		return "}"
+
+	default:
+		return tok.value
+	}
+}
+
+// reset clears the state collected for the current key-value pair.
+func (p *parser) reset() {
+	p.key, p.hasKey = "", false
+	p.headComment = ""
+	p.condition, p.conditionOK = "", false
+}
@@ -0,0 +1,811 @@
+package govdf
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// byteOrderMark is the Unicode byte order mark, which is skipped wherever it appears.
+	byteOrderMark = '\uFEFF'
+
+	// eof is returned by scanner.peek when the end of the input has been reached.
+	eof = -1
+
+	// minRead is the smallest amount of free space offered to the reader when buffering input.
+	minRead = 4096
+
+	// maxInternedKeys bounds the number of distinct keys a scanner keeps for reuse.
+	maxInternedKeys = 1 << 14
+)
+
+// spaceBytes marks the ASCII bytes that separate tokens.
+var spaceBytes = [256]bool{' ': true, '\t': true, '\n': true, '\v': true, '\f': true, '\r': true}
+
+// unquotedBytes marks the ASCII bytes that can be read as part of an unquoted string without
+// further checks. Any other byte is handled one character at a time.
+var unquotedBytes = func() (table [256]bool) {
+	for b := 0x21; b < 0x7F; b++ {
+		table[b] = true
+	}
+	for _, b := range []byte{'{', '}', '"', '/'} {
+		table[b] = false
+	}
+	return table
+}()
+
+// itemType identifies the kind of a lexical item in VDF text.
+type itemType uint8
+
+const (
+	// itemEOF marks the end of the input.
+	itemEOF itemType = iota
+
+	// itemString is a quoted or unquoted key or value.
+	itemString
+
+	// itemOpenBrace is the '{' that starts a nested map.
+	itemOpenBrace
+
+	// itemCloseBrace is the '}' that ends a nested map.
+	itemCloseBrace
+
+	// itemComment is a "//" comment running to the end of the line, or a "/* */" block comment.
+	itemComment
+
+	// itemCondition is a conditional such as [$WIN32], with the brackets removed.
+	itemCondition
+)
+
+// item is a single lexical element of VDF text.
+// The line and column are the 1-indexed position of the first character of the item,
+// the end line and column are the position just after it, and offset and end offset
+// are the number of bytes of input before and after it.
+type item struct {
+	kind      itemType
+	value     string
+	quoted    bool
+	line      int
+	column    int
+	endLine   int
+	endColumn int
+	offset    int64
+	endOffset int64
+}
+
+// span returns the range of input covered by the item.
+func (it item) span() Range {
+	return Range{
+		Start: Position{Line: it.line, Column: it.column, Offset: it.offset},
+		End:   Position{Line: it.endLine, Column: it.endColumn, Offset: it.endOffset},
+	}
+}
+
+// scanner splits VDF text into items.
+// It works on a buffer of UTF-8 input and tracks the line and column of the next character
+// to be read. Runs of ordinary characters inside strings, comments and whitespace are
+// consumed a slice at a time, everything else one character at a time.
+type scanner struct {
+	source io.Reader
+	reader io.Reader
+	opts   *options
+	line   int
+	column int
+
+	// Whether the source is seekable, such as a file, and so never waits for more input to arrive
+	seekable bool
+
+	// The buffered input, of which buf[pos:] has not been read yet. When eof is set
+	// no more input is read into the buffer, and err holds the error that ended the input.
+	buf []byte
+	pos int
+	eof bool
+	err error
+
+	// The number of bytes read, and the offset of the first byte of the last item
+	offset int64
+	begin  int64
+
+	// An item pushed back by backup, returned by the next call to next
+	unread *item
+
+	// Problems skipped over while recovering from errors
+	diagnostics []*ParseError
+
+	// Checks the context of DecodeContext for cancellation
+	cancel contextChecker
+
+	// Reusable buffer to avoid allocations while reading strings and comments
+	scratch []byte
+
+	// Keys seen so far, so that repeated keys share a single string
+	keys map[string]string
+
+	// When discard is set the text of keys and values is not kept, for callers that
+	// only need the positions of items
+	discard bool
+
+	// When record is set every rune read is appended to raw, so the exact source text
+	// can be recovered. start is the offset in raw where the last item began.
+	record bool
+	raw    []byte
+	start  int
+}
+
+// newScanner returns a scanner that reads from r.
+func newScanner(r io.Reader, opts *options) *scanner {
+	var s = &scanner{
+		source: r,
+		opts:   opts,
+		line:   1,
+		column: 1,
+	}
+
+	// Pipes implement io.Seeker too, but fail to seek
+	if seeker, ok := r.(io.Seeker); ok {
+		_, err := seeker.Seek(0, io.SeekCurrent)
+		s.seekable = err == nil
+	}
+	return s
+}
+
+// newBytesScanner returns a scanner that reads from in.
+// UTF-8 input is scanned in place without being copied.
+func newBytesScanner(in []byte, opts *options) *scanner {
+	var utf16BOM = len(in) >= 2 && (in[0] == 0xFF && in[1] == 0xFE || in[0] == 0xFE && in[1] == 0xFF)
+	if opts.encoding != EncodingUTF8 || utf16BOM {
+		return newScanner(bytes.NewReader(in), opts)
+	}
+
+	var s = newScanner(nil, opts)
+	s.buf, s.eof, s.err = in, true, io.EOF
+	return s
+}
+
+// next reads the next item from the input, or returns the item pushed back by backup.
+// The value flag tells the scanner that a quoted string is read as a value,
+// which enables handling of escaped quotes.
+func (s *scanner) next(value bool) (item, error) {
+	if s.unread != nil {
+		var it = *s.unread
+		s.unread = nil
+		return it, nil
+	}
+
+	var it, err = s.scan(value)
+	it.endLine, it.endColumn = s.line, s.column
+	it.offset, it.endOffset = s.begin, s.offset
+	return it, err
+}
+
+// report records a problem that the scanner or parser recovered from.
+func (s *scanner) report(err *ParseError) {
+	s.diagnostics = append(s.diagnostics, err)
+}
+
+// backup pushes an item back so that it is returned by the next call to next.
+// Only a single item can be pushed back at a time.
+func (s *scanner) backup(it item) {
+	s.unread = &it
+}
+
+// consumed returns the number of bytes of input used by the items returned so far.
+// Whitespace before a pushed back item is counted as consumed.
+func (s *scanner) consumed() int64 {
+	if s.unread != nil {
+		return s.unread.offset
+	}
+	return s.offset
+}
+
+// scan reads the next item from the input.
+func (s *scanner) scan(value bool) (item, error) {
+	for {
+		s.skipSpace()
+
+		var line, column = s.line, s.column
+		s.start = len(s.raw)
+		s.begin = s.offset
+		r, err := s.readRune()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return item{kind: itemEOF, line: line, column: column}, nil
+			}
+			return item{}, err
+		}
+
+		switch {
+		case isSpace(r):
+			continue
+
+		case r == '{':
+			return item{kind: itemOpenBrace, line: line, column: column}, nil
+
+		case r == '}':
+			return item{kind: itemCloseBrace, line: line, column: column}, nil
+
+		case r == '"':
+			if s.opts.recover {
+				return s.readQuotedRecovering(value, line, column)
+			}
+			str, err := s.readQuoted(value)
+			if errors.Is(err, io.EOF) && s.opts.strict {
+				return item{}, newParseErrorWithExpected(line, column, "unterminated string", `closing '"'`, "end of input")
+			}
+			if err != nil {
+				return item{}, err
+			}
+			return item{kind: itemString, value: str, quoted: true, line: line, column: column}, nil
+
+		case r == '[':
+			condition, err := s.readCondition()
+			if err != nil {
+				return item{}, err
+			}
+			return item{kind: itemCondition, value: condition, line: line, column: column}, nil
+
+		case r == '/' && s.peek() == '/':
+			comment, err := s.readComment()
+			if err != nil {
+				return item{}, err
+			}
+			return item{kind: itemComment, value: comment, line: line, column: column}, nil
+
+		case r == '/' && s.peek() == '*':
+			comment, err := s.readBlockComment()
+			if err != nil {
+				return item{}, err
+			}
+			return item{kind: itemComment, value: comment, line: line, column: column}, nil
+
+		case r == '/' && s.peek() == eof:
+			// A lone '/' at the end of the input is an incomplete comment.
+			return item{}, io.ErrUnexpectedEOF
+
+		case unicode.IsControl(r):
+			var err = newParseErrorWithExpected(line, column, "unexpected character", "valid VDF character", string(r))
+			if !s.opts.recover {
+				return item{}, err
+			}
+			err.EndLine, err.EndColumn = s.line, s.column
+			s.report(err)
+			continue
+		}
+
+		str, err := s.readUnquoted(r, value)
+		if err != nil {
+			return item{}, err
+		}
+		return item{kind: itemString, value: str, line: line, column: column}, nil
+	}
+}
+
+// fill reads more input into the buffer, moving the unread input to the front first.
+// It reports whether any input was added.
+func (s *scanner) fill() bool {
+	if s.eof {
+		return false
+	}
+
+	// The encoding of the input is detected on first use, so creating a scanner never blocks
+	if s.reader == nil {
+		s.reader = newTextReader(s.source, s.opts.encoding)
+	}
+
+	if s.pos > 0 {
+		s.buf = s.buf[:copy(s.buf, s.buf[s.pos:])]
+		s.pos = 0
+	}
+	if cap(s.buf)-len(s.buf) < minRead {
+		var grown = make([]byte, len(s.buf), 2*cap(s.buf)+minRead)
+		copy(grown, s.buf)
+		s.buf = grown
+	}
+
+	for {
+		n, err := s.reader.Read(s.buf[len(s.buf):cap(s.buf)])
+		s.buf = s.buf[:len(s.buf)+n]
+		if err != nil {
+			s.eof, s.err = true, err
+			return n > 0
+		}
+		if n > 0 {
+			return true
+		}
+	}
+}
+
+// ensure reports whether at least n bytes of unread input are buffered, reading more if needed.
+func (s *scanner) ensure(n int) bool {
+	for len(s.buf)-s.pos < n {
+		if !s.fill() {
+			return false
+		}
+	}
+	return true
+}
+
+// window returns the buffered unread input that may be consumed without reading past
+// the MaxInputBytes limit, reading more input when none is buffered. When size is not
+// negative, at most size bytes are returned.
+func (s *scanner) window(size int) []byte {
+	if s.cancel.check() != nil {
+		// Leave the error to readRune, which reports it
+		return nil
+	}
+	if s.pos == len(s.buf) {
+		s.fill()
+	}
+
+	var chunk = s.buf[s.pos:]
+	if limit := s.opts.limits.MaxInputBytes; limit > 0 && int64(len(chunk)) > limit-s.offset {
+		chunk = chunk[:max(limit-s.offset, 0)]
+	}
+	if size >= 0 && len(chunk) > size {
+		chunk = chunk[:size]
+	}
+	return chunk
+}
+
+// consume advances past the next n bytes of buffered input, which must be valid UTF-8.
+func (s *scanner) consume(n int) {
+	var chunk = s.buf[s.pos : s.pos+n]
+	s.pos += n
+	s.offset += int64(n)
+	if s.record {
+		s.raw = append(s.raw, chunk...)
+	}
+
+	// Update position
+	if lines := bytes.Count(chunk, []byte{'\n'}); lines > 0 {
+		s.line += lines
+		s.column = 1
+		chunk = chunk[bytes.LastIndexByte(chunk, '\n')+1:]
+	}
+	s.column += utf8.RuneCount(chunk)
+}
+
+// readRune reads a single rune and advances the position.
+func (s *scanner) readRune() (rune, error) {
+	if err := s.cancel.check(); err != nil {
+		return 0, err
+	}
+
+	if !s.ensure(1) {
+		return 0, s.err
+	}
+	var r, size = rune(s.buf[s.pos]), 1
+	if r >= utf8.RuneSelf {
+		s.ensure(utf8.UTFMax)
+		r, size = utf8.DecodeRune(s.buf[s.pos:])
+	}
+	s.pos += size
+
+	s.offset += int64(size)
+	if limit := s.opts.limits.MaxInputBytes; limit > 0 && s.offset > limit {
+		return 0, s.limitError("MaxInputBytes", limit)
+	}
+	if s.record {
+		s.raw = utf8.AppendRune(s.raw, r)
+	}
+
+	// Update position
+	if r == '\n' {
+		s.line++
+		s.column = 1
+	} else {
+		s.column++
+	}
+
+	// Handle invalid runes
+	if r == unicode.ReplacementChar && size == 1 {
+		if !s.opts.recover {
+			return 0, newPositionError(s.line, s.column, errors.New("invalid rune"))
+		}
+		var err = newParseError(s.line, s.column-1, "invalid rune")
+		err.EndLine, err.EndColumn = s.line, s.column
+		s.report(err)
+	}
+
+	return r, nil
+}
+
+// limitError returns a LimitError for the current position.
+func (s *scanner) limitError(limit string, max int64) *LimitError {
+	return &LimitError{Limit: limit, Max: max, Line: s.line, Column: s.column, Offset: s.offset}
+}
+
+// lengthLimit returns the name and value of the limit on the length of a key,
+// or of a value when the value flag is set.
+func (s *scanner) lengthLimit(value bool) (string, int) {
+	if value {
+		return "MaxValueLength", s.opts.limits.MaxValueLength
+	}
+	return "MaxKeyLength", s.opts.limits.MaxKeyLength
+}
+
+// checkLength returns a LimitError when the string being read is longer than allowed
+// for a key, or for a value when the value flag is set.
+func (s *scanner) checkLength(value bool) error {
+	var name, limit = s.lengthLimit(value)
+	if limit > 0 && len(s.scratch) > limit {
+		return s.limitError(name, int64(limit))
+	}
+	return nil
+}
+
+// stringWindow returns the buffered input that can be added to the string being read
+// without going past the length limit by more than one character.
+func (s *scanner) stringWindow(value bool) []byte {
+	var _, limit = s.lengthLimit(value)
+	if limit > 0 {
+		return s.window(limit - len(s.scratch))
+	}
+	return s.window(-1)
+}
+
+// text returns the string read into the scratch buffer.
+// Keys are interned, so that a key repeated throughout a document is only allocated once.
+func (s *scanner) text(value bool) string {
+	if s.discard {
+		return ""
+	}
+	if value {
+		return string(s.scratch)
+	}
+	if key, ok := s.keys[string(s.scratch)]; ok {
+		return key
+	}
+
+	var key = string(s.scratch)
+	if s.keys == nil {
+		s.keys = make(map[string]string)
+	}
+	if len(s.keys) < maxInternedKeys {
+		s.keys[key] = key
+	}
+	return key
+}
+
+// peek returns the next rune without consuming it.
+// It returns eof when the end of the input has been reached.
+func (s *scanner) peek() rune {
+	s.ensure(utf8.UTFMax)
+	if s.pos == len(s.buf) {
+		return eof
+	}
+	r, _ := utf8.DecodeRune(s.buf[s.pos:])
+	return r
+}
+
+// conditionBuffered reports whether the input buffered so far holds a conditional on the
+// current line, after nothing but spaces and tabs. More input is only read from a seekable
+// source, so that a live stream is never waited on.
+func (s *scanner) conditionBuffered() bool {
+	if s.unread != nil {
+		return s.unread.kind == itemCondition
+	}
+	for {
+		for _, b := range s.buf[s.pos:] {
+			switch b {
+			case ' ', '\t':
+				continue
+
+			case '[':
+				return true
+			}
+			return false
+		}
+		if !s.seekable || !s.fill() {
+			return false
+		}
+	}
+}
+
+// skipSpace consumes a run of ASCII whitespace.
+func (s *scanner) skipSpace() {
+	for {
+		var chunk = s.window(-1)
+		var n int
+		for n < len(chunk) && spaceBytes[chunk[n]] {
+			n++
+		}
+		s.consume(n)
+		if n == 0 || n < len(chunk) {
+			return
+		}
+	}
+}
+
+// takeUntil consumes the buffered input up to the first occurrence of stop, limited to chunk,
+// and adds it to the scratch buffer. It reports whether any input was consumed.
+// Input that is not valid UTF-8 is left for readRune to report.
+func (s *scanner) takeUntil(chunk []byte, stop byte) bool {
+	if i := bytes.IndexByte(chunk, stop); i >= 0 {
+		chunk = chunk[:i]
+	}
+	chunk = chunk[:validPrefix(chunk)]
+	if len(chunk) == 0 {
+		return false
+	}
+	s.scratch = append(s.scratch, chunk...)
+	s.consume(len(chunk))
+	return true
+}
+
+// readComment reads the remainder of a "//" comment up to the end of the line.
+// The leading '/' has already been consumed.
+func (s *scanner) readComment() (string, error) {
+	s.scratch = s.scratch[:0]
+
+	// Skip the second '/' of the comment marker
+	if _, err := s.readRune(); err != nil {
+		return "", err
+	}
+
+	for {
+		if s.takeUntil(s.window(-1), '\n') {
+			continue
+		}
+
+		r, err := s.readRune()
+		switch {
+		case errors.Is(err, io.EOF):
+			return strings.TrimSpace(string(s.scratch)), nil
+
+		case err != nil:
+			return "", err
+
+		case r == '\n':
+			return strings.TrimSpace(string(s.scratch)), nil
+		}
+		s.scratch = utf8.AppendRune(s.scratch, r)
+	}
+}
+
+// readBlockComment reads a block comment up to and including its closing "*/".
+// The leading '/' has already been consumed. The end of the input inside the comment is an error.
+func (s *scanner) readBlockComment() (string, error) {
+	s.scratch = s.scratch[:0]
+
+	// Skip the '*' of the comment marker
+	if _, err := s.readRune(); err != nil {
+		return "", err
+	}
+
+	for {
+		if s.takeUntil(s.window(-1), '*') {
+			continue
+		}
+
+		r, err := s.readRune()
+		switch {
+		case errors.Is(err, io.EOF):
+			return "", io.ErrUnexpectedEOF
+
+		case err != nil:
+			return "", err
+
+		case r == '*' && s.peek() == '/':
+			if _, err := s.readRune(); err != nil {
+				return "", err
+			}
+			return strings.TrimSpace(string(s.scratch)), nil
+		}
+		s.scratch = utf8.AppendRune(s.scratch, r)
+	}
+}
+
+// readCondition reads a conditional up to its closing bracket.
+// The opening bracket has already been consumed.
+func (s *scanner) readCondition() (string, error) {
+	s.scratch = s.scratch[:0]
+
+	for {
+		r, err := s.readRune()
+		if err != nil {
+			return "", err
+		}
+
+		if r == ']' {
+			return strings.TrimSpace(string(s.scratch)), nil
+		}
+
+		s.scratch = utf8.AppendRune(s.scratch, r)
+	}
+}
+
+// readQuoted reads a quoted string up to its closing quote.
+// The opening quote has already been consumed. Values may contain escaped quotes:
+// a quote preceded by an odd number of backslashes does not end the value.
+// When escape sequences are enabled they are decoded in both keys and values instead.
+func (s *scanner) readQuoted(value bool) (string, error) {
+	s.scratch = s.scratch[:0]
+
+	for {
+		if err := s.checkLength(value); err != nil {
+			return "", err
+		}
+
+		// Take everything up to the next quote, or backslash when it starts an escape sequence
+		var chunk = s.stringWindow(value)
+		if s.opts.escapeSequences {
+			if i := bytes.IndexByte(chunk, '\\'); i >= 0 {
+				chunk = chunk[:i]
+			}
+		}
+		if s.takeUntil(chunk, '"') {
+			continue
+		}
+
+		r, err := s.readRune()
+		if err != nil {
+			return "", err
+		}
+
+		if r == '\\' && s.opts.escapeSequences {
+			if err := s.readEscape(); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		if r == '"' {
+			if !value || s.opts.escapeSequences || !endsWithOddBackslashes(s.scratch) {
+				return s.text(value), nil
+			}
+
+			// This is an escaped quote - remove the backslash and add the quote
+			s.scratch = s.scratch[:len(s.scratch)-1]
+		}
+
+		s.scratch = utf8.AppendRune(s.scratch, r)
+	}
+}
+
+// readQuotedRecovering reads a quoted string while recovering from errors.
+// A string that is still open at the end of the input is reported and ended at the end
+// of the line it started on, and the rest of the input is scanned again.
+func (s *scanner) readQuotedRecovering(value bool, line, column int) (item, error) {
+	// Record the raw text of the string so it can be scanned again
+	var record, mark = s.record, len(s.raw)
+	s.record = true
+	str, err := s.readQuoted(value)
+	var rest = append([]byte(nil), s.raw[mark:]...)
+	s.record = record
+	if !record {
+		s.raw = s.raw[:mark]
+	}
+
+	if !errors.Is(err, io.EOF) {
+		return item{kind: itemString, value: str, quoted: true, line: line, column: column}, err
+	}
+
+	var first, tail, found = bytes.Cut(rest, []byte("\n"))
+	var diagnostic = newParseErrorWithExpected(line, column, "unterminated string", `closing '"'`, "end of input")
+	diagnostic.EndLine, diagnostic.EndColumn = line, column+1+utf8.RuneCount(first)
+	s.report(diagnostic)
+
+	if found {
+		s.buf, s.pos = tail, 0
+		s.line, s.column = line+1, 1
+		s.offset = s.begin + 1 + int64(len(first)) + 1
+	}
+	return item{kind: itemString, value: strings.TrimSuffix(string(first), "\r"), quoted: true, line: line, column: column}, nil
+}
+
+// readEscape decodes the escape sequence following a backslash inside a quoted string.
+// Unknown escape sequences are kept as written.
+func (s *scanner) readEscape() error {
+	r, err := s.readRune()
+	if err != nil {
+		return err
+	}
+
+	switch r {
+	case 'n':
+		s.scratch = append(s.scratch, '\n')
+
+	case 't':
+		s.scratch = append(s.scratch, '\t')
+
+	case '\\', '"':
+		s.scratch = utf8.AppendRune(s.scratch, r)
+
+	default:
+		s.scratch = append(s.scratch, '\\')
+		s.scratch = utf8.AppendRune(s.scratch, r)
+	}
+
+	return nil
+}
+
+// readUnquoted reads an unquoted string starting with first.
+// Unquoted strings end at whitespace, braces, quotes, comments or the end of the input.
+// The value flag selects the length limit that applies to the string.
+func (s *scanner) readUnquoted(first rune, value bool) (string, error) {
+	s.scratch = utf8.AppendRune(s.scratch[:0], first)
+
+	for {
+		if err := s.checkLength(value); err != nil {
+			return "", err
+		}
+
+		// Take the run of plain ASCII characters
+		var chunk = s.stringWindow(value)
+		var n int
+		for n < len(chunk) && unquotedBytes[chunk[n]] {
+			n++
+		}
+		if n > 0 {
+			s.scratch = append(s.scratch, chunk[:n]...)
+			s.consume(n)
+			continue
+		}
+
+		var r = s.peek()
+		switch {
+		case r == eof, isSpace(r), r == '{', r == '}', r == '"':
+			return s.text(value), nil
+
+		case r == '/':
+			if s.ensure(2) && (s.buf[s.pos+1] == '/' || s.buf[s.pos+1] == '*') {
+				return s.text(value), nil
+			}
+
+		case unicode.IsControl(r):
+			var err = newParseErrorWithExpected(s.line, s.column, "unexpected character", "valid VDF character", string(r))
+			if !s.opts.recover {
+				return "", err
+			}
+
+			// Skip the character and carry on with the string
+			if _, err := s.readRune(); err != nil {
+				return "", err
+			}
+			err.EndLine, err.EndColumn = s.line, s.column
+			s.report(err)
+			continue
+		}
+
+		if _, err := s.readRune(); err != nil {
+			return "", err
+		}
+		s.scratch = utf8.AppendRune(s.scratch, r)
+	}
+}
+
+// isSpace reports whether r separates tokens.
+func isSpace(r rune) bool {
+	return unicode.IsSpace(r) || r == byteOrderMark
+}
+
+// validPrefix returns the length of the longest prefix of b that is valid UTF-8.
+func validPrefix(b []byte) int {
+	if utf8.Valid(b) {
+		return len(b)
+	}
+
+	var n int
+	for n < len(b) {
+		var r, size = utf8.DecodeRune(b[n:])
+		if r == utf8.RuneError && size == 1 {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+// endsWithOddBackslashes reports whether b ends with an odd number of consecutive backslashes.
+func endsWithOddBackslashes(b []byte) bool {
+	var count int
+	for i := len(b) - 1; i >= 0 && b[i] == '\\'; i-- {
+		count++
+	}
+	return count%2 == 1
+}
@@ -0,0 +1,264 @@
+package govdf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// TokenKind identifies the kind of a Token.
+type TokenKind uint8
+
+const (
+	// TokenKey is the key of a key-value pair.
+	TokenKey TokenKind = iota
+
+	// TokenValue is the scalar value of the preceding key.
+	TokenValue
+
+	// TokenObjectStart is the '{' that opens the nested map of the preceding key.
+	TokenObjectStart
+
+	// TokenObjectEnd is the '}' that closes a nested map.
+	TokenObjectEnd
+
+	// TokenComment is a "//" line comment or a "/* */" block comment, with the markers and
+	// surrounding whitespace removed. Line breaks inside a block comment are kept.
+	TokenComment
+)
+
+// String returns a readable name for the token kind.
+func (k TokenKind) String() string {
+	switch k {
+	case TokenKey:
+		return "key"
+
+	case TokenValue:
+		return "value"
+
+	case TokenObjectStart:
+		return "object start"
+
+	case TokenObjectEnd:
+		return "object end"
+
+	case TokenComment:
+		return "comment"
+
+	default:
+		return fmt.Sprintf("TokenKind(%d)", k)
+	}
+}
+
+// Token is a single element of a VDF stream, as returned by Decoder.Token.
+type Token struct {
+	Kind  TokenKind // The kind of token
+	Value string    // The key, scalar value or comment text
+
+	// Condition holds the conditional of a value or object start, such as "$WIN32".
+	// Conditionals are reported as written and are not evaluated.
+	Condition string
+
+	// Line and Column provide the position of the token in the original VDF file.
+	Line   int
+	Column int
+}
+
+// tokenState is the state of the token API on a Decoder.
+type tokenState struct {
+	// An error found while reading ahead, returned by the next call to Token
+	peekErr error
+
+	// The number of open maps, and whether a key is waiting for its value
+	depth    int
+	afterKey bool
+
+	// The number of keys returned, checked against the MaxNodes limit
+	nodes int
+
+	// The conditional read between a key and its value
+	condition string
+}
+
+// Token returns the next token in the input stream.
+// At the end of the input stream, Token returns io.EOF.
+// If the input ends inside a map or after a key, Token returns io.ErrUnexpectedEOF.
+//
+// Token allows entries to be processed one at a time without building a Node tree,
+// which keeps memory use flat for very large files such as items_game.txt.
+// Token and Decode should not be mixed on the same Decoder. The limits set with WithLimits
+// apply, with every key returned counting as a node against MaxNodes.
+//
+// Token never waits for more of a live stream to find out whether a conditional follows a
+// value: the conditional is only included in the TokenValue when it has already been received.
+//
+// Example:
+//
+//	for {
+//	    tok, err := decoder.Token()
+//	    if err == io.EOF {
+//	        break
+//	    }
+//	    if err != nil {
+//	        return err
+//	    }
+//	    fmt.Println(tok.Kind, tok.Value)
+//	}
+func (d *Decoder) Token() (Token, error) {
+	var state = &d.tokens
+	for {
+		tok, err := d.nextItem()
+		if err != nil {
+			return Token{}, err
+		}
+
+		switch tok.kind {
+		case itemEOF:
+			if state.depth > 0 || state.afterKey {
+				return Token{}, io.ErrUnexpectedEOF
+			}
+			return Token{}, io.EOF
+
+		case itemComment:
+			return d.emit(Token{Kind: TokenComment, Value: tok.value, Line: tok.line, Column: tok.column}), nil
+
+		case itemCondition:
+			if !state.afterKey || state.condition != "" {
+				return Token{}, newParseErrorWithExpected(tok.line, tok.column, "unexpected conditional", "key or value", "["+tok.value+"]")
+			}
+			state.condition = tok.value
+
+		case itemString:
+			if !state.afterKey {
+				state.nodes++
+				if limit := d.opts.limits.MaxNodes; limit > 0 && state.nodes > limit {
+					return Token{}, &LimitError{Limit: "MaxNodes", Max: int64(limit), Line: tok.line, Column: tok.column, Offset: tok.offset}
+				}
+				state.afterKey = true
+				return d.emit(Token{Kind: TokenKey, Value: tok.value, Line: tok.line, Column: tok.column}), nil
+			}
+
+			// The next item is a key, unless it is a conditional that follows the value. Reading
+			// it could wait for more of a live stream, so it is only read when already buffered.
+			state.afterKey = false
+			var condition = state.takeCondition()
+			if condition == "" && d.tokens.peekErr == nil && d.scanner.conditionBuffered() {
+				next, err := d.nextItem()
+				if err != nil {
+					return Token{}, err
+				}
+				condition = next.value
+			}
+			return d.emit(Token{Kind: TokenValue, Value: tok.value, Condition: condition, Line: tok.line, Column: tok.column}), nil
+
+		case itemOpenBrace:
+			if limit := d.opts.limits.MaxDepth; limit > 0 && state.depth >= limit {
+				return Token{}, &LimitError{Limit: "MaxDepth", Max: int64(limit), Line: tok.line, Column: tok.column, Offset: tok.offset}
+			}
+			state.depth++
+			return d.emit(Token{Kind: TokenObjectStart, Condition: state.takeCondition(), Line: tok.line, Column: tok.column}), nil
+
+		case itemCloseBrace:
+			if state.afterKey {
+				return Token{}, newParseErrorWithExpected(tok.line, tok.column, "expected value after key", "value", "}")
+			}
+			if state.depth == 0 {
+				return Token{}, newParseError(tok.line, tok.column, "unexpected '}' at root level")
+			}
+			state.depth--
+			return d.emit(Token{Kind: TokenObjectEnd, Line: tok.line, Column: tok.column}), nil
+		}
+	}
+}
+
+// More reports whether there is another key or comment in the current map,
+// or at the top level of the input when no map is open.
+func (d *Decoder) More() bool {
+	tok, err := d.peekItem()
+	return err == nil && tok.kind != itemEOF && tok.kind != itemCloseBrace
+}
+
+// Skip discards the value of the key that was just returned by Token,
+// including the whole nested map when the value is a map.
+// Otherwise Skip discards the rest of the current map, up to and including its object end.
+// At the top level of the input, outside any map, Skip does nothing.
+func (d *Decoder) Skip() error {
+	if !d.tokens.afterKey {
+		return d.skipMap()
+	}
+
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch tok.Kind {
+		case TokenValue:
+			return nil
+
+		case TokenObjectStart:
+			return d.skipMap()
+		}
+	}
+}
+
+// skipMap discards tokens until the currently open map is closed.
+func (d *Decoder) skipMap() error {
+	var depth = d.tokens.depth
+	for depth > 0 && d.tokens.depth >= depth {
+		if _, err := d.Token(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emit clears the pending key once its value has been returned.
+func (d *Decoder) emit(tok Token) Token {
+	if tok.Kind == TokenValue || tok.Kind == TokenObjectStart {
+		d.tokens.afterKey = false
+	}
+	return tok
+}
+
+// takeCondition returns the pending conditional and clears it.
+func (s *tokenState) takeCondition() string {
+	var condition = s.condition
+	s.condition = ""
+	return condition
+}
+
+// nextItem returns the next item, or the error found by the last call to peekItem.
+func (d *Decoder) nextItem() (item, error) {
+	if err := d.tokens.peekErr; err != nil {
+		d.tokens.peekErr = nil
+		return item{}, err
+	}
+	return d.readItem()
+}
+
+// peekItem returns the next item and pushes it back onto the scanner.
+func (d *Decoder) peekItem() (item, error) {
+	if d.tokens.peekErr != nil {
+		return item{}, d.tokens.peekErr
+	}
+
+	tok, err := d.readItem()
+	if err != nil {
+		d.tokens.peekErr = err
+		return item{}, err
+	}
+	d.scanner.backup(tok)
+	return tok, nil
+}
+
+// readItem reads the next item from the scanner.
+// The end of the input inside a string is reported as io.ErrUnexpectedEOF,
+// so that io.EOF from Token always means the input ended cleanly.
+func (d *Decoder) readItem() (item, error) {
+	tok, err := d.scanner.next(d.tokens.afterKey)
+	if errors.Is(err, io.EOF) {
+		return item{}, io.ErrUnexpectedEOF
+	}
+	return tok, err
+}
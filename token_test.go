@@ -0,0 +1,332 @@
+package govdf_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	govdf "github.com/lewisgibson/go-vdf"
+	"github.com/stretchr/testify/require"
+)
+
+// readTokens reads every token from the decoder until the end of the input.
+func readTokens(t *testing.T, decoder *govdf.Decoder) []govdf.Token {
+	t.Helper()
+
+	var tokens []govdf.Token
+	for {
+		tok, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return tokens
+		}
+		require.NoError(t, err)
+		tokens = append(tokens, tok)
+	}
+}
+
+func TestDecoder_Token(t *testing.T) {
+	t.Parallel()
+
+	var testCases = map[string]struct {
+		input    string
+		expected []govdf.Token
+	}{
+		"empty": {
+			input: "",
+		},
+		"key value": {
+			input: `"a" "b"`,
+			expected: []govdf.Token{
+				{Kind: govdf.TokenKey, Value: "a", Line: 1, Column: 1},
+				{Kind: govdf.TokenValue, Value: "b", Line: 1, Column: 5},
+			},
+		},
+		"nested maps": {
+			input: "\"root\"\n{\n\t\"child\"\n\t{\n\t\t\"a\" \"1\"\n\t}\n}",
+			expected: []govdf.Token{
+				{Kind: govdf.TokenKey, Value: "root", Line: 1, Column: 1},
+				{Kind: govdf.TokenObjectStart, Line: 2, Column: 1},
+				{Kind: govdf.TokenKey, Value: "child", Line: 3, Column: 2},
+				{Kind: govdf.TokenObjectStart, Line: 4, Column: 2},
+				{Kind: govdf.TokenKey, Value: "a", Line: 5, Column: 3},
+				{Kind: govdf.TokenValue, Value: "1", Line: 5, Column: 7},
+				{Kind: govdf.TokenObjectEnd, Line: 6, Column: 2},
+				{Kind: govdf.TokenObjectEnd, Line: 7, Column: 1},
+			},
+		},
+		"comments": {
+			input: "// head\n\"a\" \"b\" // line",
+			expected: []govdf.Token{
+				{Kind: govdf.TokenComment, Value: "head", Line: 1, Column: 1},
+				{Kind: govdf.TokenKey, Value: "a", Line: 2, Column: 1},
+				{Kind: govdf.TokenValue, Value: "b", Line: 2, Column: 5},
+				{Kind: govdf.TokenComment, Value: "line", Line: 2, Column: 9},
+			},
+		},
+		"block comments": {
+			input: "/* head\n   more */ \"a\" /* between */ \"b\"",
+			expected: []govdf.Token{
+				{Kind: govdf.TokenComment, Value: "head\n   more", Line: 1, Column: 1},
+				{Kind: govdf.TokenKey, Value: "a", Line: 2, Column: 12},
+				{Kind: govdf.TokenComment, Value: "between", Line: 2, Column: 16},
+				{Kind: govdf.TokenValue, Value: "b", Line: 2, Column: 30},
+			},
+		},
+		"conditionals": {
+			input: `"a" "1" [$WIN32] "b" [!$OSX] "2" "c" [$X360] { }`,
+			expected: []govdf.Token{
+				{Kind: govdf.TokenKey, Value: "a", Line: 1, Column: 1},
+				{Kind: govdf.TokenValue, Value: "1", Condition: "$WIN32", Line: 1, Column: 5},
+				{Kind: govdf.TokenKey, Value: "b", Line: 1, Column: 18},
+				{Kind: govdf.TokenValue, Value: "2", Condition: "!$OSX", Line: 1, Column: 30},
+				{Kind: govdf.TokenKey, Value: "c", Line: 1, Column: 34},
+				{Kind: govdf.TokenObjectStart, Condition: "$X360", Line: 1, Column: 46},
+				{Kind: govdf.TokenObjectEnd, Line: 1, Column: 48},
+			},
+		},
+		"unquoted strings": {
+			input: "Material { $basetexture concrete/floor01 }",
+			expected: []govdf.Token{
+				{Kind: govdf.TokenKey, Value: "Material", Line: 1, Column: 1},
+				{Kind: govdf.TokenObjectStart, Line: 1, Column: 10},
+				{Kind: govdf.TokenKey, Value: "$basetexture", Line: 1, Column: 12},
+				{Kind: govdf.TokenValue, Value: "concrete/floor01", Line: 1, Column: 25},
+				{Kind: govdf.TokenObjectEnd, Line: 1, Column: 42},
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Arrange: Create a decoder for the input.
+			var decoder = govdf.NewDecoder(strings.NewReader(tc.input))
+
+			// Act: Read every token.
+			var tokens = readTokens(t, decoder)
+
+			// Assert: The tokens should match the expected tokens.
+			if diff := cmp.Diff(tc.expected, tokens); diff != "" {
+				t.Errorf("Token() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDecoder_TokenErrors(t *testing.T) {
+	t.Parallel()
+
+	var testCases = map[string]struct {
+		input       string
+		expectedErr error
+		errorSubstr string
+	}{
+		"unclosed map": {
+			input:       `"a" { "b" "c"`,
+			expectedErr: io.ErrUnexpectedEOF,
+		},
+		"missing value at end": {
+			input:       `"a"`,
+			expectedErr: io.ErrUnexpectedEOF,
+		},
+		"unterminated string": {
+			input:       `"a" "b`,
+			expectedErr: io.ErrUnexpectedEOF,
+		},
+		"unexpected closing brace": {
+			input:       `"a" "b" }`,
+			errorSubstr: "unexpected '}' at root level",
+		},
+		"missing value": {
+			input:       `"a" { "b" }`,
+			errorSubstr: "expected value after key",
+		},
+		"conditional without key": {
+			input:       `[$WIN32] "a" "b"`,
+			errorSubstr: "unexpected conditional",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Arrange: Create a decoder for the input.
+			var decoder = govdf.NewDecoder(strings.NewReader(tc.input))
+
+			// Act: Read tokens until an error occurs.
+			var err error
+			for err == nil {
+				_, err = decoder.Token()
+			}
+
+			// Assert: The error should not be a clean end of input.
+			require.NotErrorIs(t, err, io.EOF)
+			if tc.expectedErr != nil {
+				require.ErrorIs(t, err, tc.expectedErr)
+			}
+			require.Contains(t, err.Error(), tc.errorSubstr)
+		})
+	}
+}
+
+func TestDecoder_MoreAndSkip(t *testing.T) {
+	t.Parallel()
+
+	// Arrange: Create a decoder for a file with a large section we are not interested in.
+	var input = strings.Join([]string{
+		`"items_game"`,
+		`{`,
+		`	"rarities" { "common" { "value" "1" } }`,
+		`	"game_info" "skip me" [$WIN32]`,
+		`	"items"`,
+		`	{`,
+		`		"1" { "name" "knife" }`,
+		`		"2" { "name" "pistol" }`,
+		`	}`,
+		`}`,
+	}, "\n")
+	var decoder = govdf.NewDecoder(strings.NewReader(input))
+
+	// Act: Walk the top level map, skipping everything except the item names.
+	var names []string
+	var next = func() govdf.Token {
+		tok, err := decoder.Token()
+		require.NoError(t, err)
+		return tok
+	}
+
+	require.Equal(t, "items_game", next().Value)
+	require.Equal(t, govdf.TokenObjectStart, next().Kind)
+	for decoder.More() {
+		var key = next()
+		if key.Value != "items" {
+			require.NoError(t, decoder.Skip())
+			continue
+		}
+
+		require.Equal(t, govdf.TokenObjectStart, next().Kind)
+		for decoder.More() {
+			next()
+			require.Equal(t, govdf.TokenObjectStart, next().Kind)
+			require.Equal(t, "name", next().Value)
+			names = append(names, next().Value)
+			require.NoError(t, decoder.Skip())
+		}
+		require.Equal(t, govdf.TokenObjectEnd, next().Kind)
+	}
+	require.Equal(t, govdf.TokenObjectEnd, next().Kind)
+	require.False(t, decoder.More())
+
+	// Assert: Only the item names should have been read.
+	require.Equal(t, []string{"knife", "pistol"}, names)
+	_, err := decoder.Token()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestDecoder_TokenLimits(t *testing.T) {
+	t.Parallel()
+
+	// Arrange: Create a decoder that allows a single level of nesting.
+	var decoder = govdf.NewDecoder(strings.NewReader(`"a" { "b" { } }`), govdf.WithLimits(govdf.Limits{MaxDepth: 1}))
+
+	// Act: Read tokens until an error occurs.
+	var err error
+	for err == nil {
+		_, err = decoder.Token()
+	}
+
+	// Assert: The nested map should exceed the depth limit.
+	var limitErr *govdf.LimitError
+	require.ErrorAs(t, err, &limitErr)
+	require.Equal(t, "MaxDepth", limitErr.Limit)
+	require.Equal(t, 11, limitErr.Column)
+}
+
+func TestDecoder_TokenNodeLimit(t *testing.T) {
+	t.Parallel()
+
+	// Arrange: Create a decoder that allows two nodes.
+	var decoder = govdf.NewDecoder(strings.NewReader(`"a" { "b" "1" "c" "2" }`), govdf.WithLimits(govdf.Limits{MaxNodes: 2}))
+
+	// Act: Read tokens until an error occurs.
+	var err error
+	for err == nil {
+		_, err = decoder.Token()
+	}
+
+	// Assert: The third key should exceed the node limit.
+	var limitErr *govdf.LimitError
+	require.ErrorAs(t, err, &limitErr)
+	require.Equal(t, "MaxNodes", limitErr.Limit)
+	require.Equal(t, 15, limitErr.Column)
+}
+
+// splitReader is a seekable reader that returns its data in two reads, split at an offset.
+type splitReader struct {
+	*bytes.Reader
+	split int64
+}
+
+// Read reads up to the split offset, and then the rest of the data.
+func (r *splitReader) Read(p []byte) (int, error) {
+	if offset := r.Size() - int64(r.Len()); offset < r.split && int64(len(p)) > r.split-offset {
+		p = p[:r.split-offset]
+	}
+	return r.Reader.Read(p)
+}
+
+func TestDecoder_TokenTrailingCondition(t *testing.T) {
+	t.Parallel()
+
+	t.Run("live stream", func(t *testing.T) {
+		t.Parallel()
+
+		// Arrange: Create a decoder for a stream that only holds the first entry so far.
+		var reader, writer = io.Pipe()
+		var decoder = govdf.NewDecoder(reader)
+		go func() {
+			_, _ = writer.Write([]byte(`"a" "b"`))
+		}()
+		_, err := decoder.Token()
+		require.NoError(t, err)
+
+		// Act: Read the value.
+		var done = make(chan govdf.Token)
+		go func() {
+			tok, _ := decoder.Token()
+			done <- tok
+		}()
+
+		// Assert: Token should return the value without waiting for the rest of the stream.
+		select {
+		case tok := <-done:
+			require.Equal(t, govdf.Token{Kind: govdf.TokenValue, Value: "b", Line: 1, Column: 5}, tok)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Token did not return before the rest of the stream was written")
+		}
+		_ = writer.Close()
+	})
+
+	t.Run("seekable source", func(t *testing.T) {
+		t.Parallel()
+
+		// Arrange: Create a decoder for a file whose first read ends just after the value.
+		var input = []byte(`"a" "b" [$WIN32]` + "\n" + `"c" "d"`)
+		var decoder = govdf.NewDecoder(&splitReader{Reader: bytes.NewReader(input), split: 7})
+
+		// Act: Read every token.
+		var tokens = readTokens(t, decoder)
+
+		// Assert: The conditional should still be read with the value.
+		require.Equal(t, []govdf.Token{
+			{Kind: govdf.TokenKey, Value: "a", Line: 1, Column: 1},
+			{Kind: govdf.TokenValue, Value: "b", Condition: "$WIN32", Line: 1, Column: 5},
+			{Kind: govdf.TokenKey, Value: "c", Line: 2, Column: 1},
+			{Kind: govdf.TokenValue, Value: "d", Line: 2, Column: 5},
+		}, tokens)
+	})
+}